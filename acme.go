@@ -0,0 +1,63 @@
+package pinamicdns
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ACMEChallengeLabel is the label beneath which the TXT records of ACME DNS-01 challenges are published.
+const ACMEChallengeLabel = "_acme-challenge"
+
+// ACMEChallengeName gets the subdomain name of the TXT record that holds the DNS-01 challenge for the given subdomain
+// name. The apex of a domain may be given as either an empty name or "@". A wildcard name shares its challenge record
+// with the name it is a wildcard of.
+func ACMEChallengeName(name string) string {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || name == "@" || name == "*" {
+		return ACMEChallengeLabel
+	}
+
+	return ACMEChallengeLabel + "." + name
+}
+
+// PresentACMEChallenge publishes the given DNS-01 challenge value for the given subdomain name in the given domain,
+// with the given TTL. Any other challenge values that are already published are kept, so that several challenges for
+// the same name, such as those for both a name and its wildcard, can be satisfied at once.
+func PresentACMEChallenge(adder RecordAdder, domain, name, value string, ttl int) error {
+	record := Record{
+		Type:  TXTRecordType,
+		Name:  ACMEChallengeName(name),
+		Value: value,
+		TTL:   ttl,
+	}
+
+	err := adder.AddRecord(domain, record)
+	if err != nil {
+		return xerrors.Errorf("could not present ACME challenge: %w", err)
+	}
+
+	return nil
+}
+
+// CleanUpACMEChallenge removes the given DNS-01 challenge value for the given subdomain name in the given domain, once
+// it is no longer needed. Any other challenge values are left alone.
+func CleanUpACMEChallenge(remover RecordRemover, domain, name, value string) error {
+	if value == "" {
+		// An empty value would remove every challenge for the name, including those that are still needed.
+		return xerrors.New("could not clean up ACME challenge: no challenge value given")
+	}
+
+	record := Record{
+		Type:  TXTRecordType,
+		Name:  ACMEChallengeName(name),
+		Value: value,
+	}
+
+	err := remover.RemoveRecord(domain, record)
+	if err != nil {
+		return xerrors.Errorf("could not clean up ACME challenge: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package pinamicdns
+
+import "net/http"
+
+// RecordIDCache stores the IDs that a provider has assigned to records, so that they may be updated directly on
+// subsequent calls, rather than being looked up again. Implementations must be safe for concurrent use if the setter
+// that uses them is used concurrently.
+type RecordIDCache interface {
+	// RecordID gets the stored ID of the record with the given domain, subdomain name, and record type, if there is one.
+	RecordID(domain, name, recordType string) (string, bool)
+	// SetRecordID stores the ID of the record with the given domain, subdomain name, and record type.
+	SetRecordID(domain, name, recordType, id string)
+}
+
+// ResponseCache stores responses from a provider's API, so that they may be revalidated with conditional requests
+// rather than fetched again in full. Implementations must be safe for concurrent use if the setter that uses them is
+// used concurrently.
+type ResponseCache interface {
+	// CachedResponse gets the response stored under the given key, if there is one.
+	CachedResponse(key string) (CachedResponse, bool)
+	// SetCachedResponse stores the given response under the given key.
+	SetCachedResponse(key string, response CachedResponse)
+}
+
+// CachedResponse is a response body stored by a ResponseCache, along with the validators needed to revalidate it.
+type CachedResponse struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// setConditionalHeaders sets the headers on the given request that are needed to revalidate the given cached response.
+func (response CachedResponse) setConditionalHeaders(req *http.Request) {
+	if response.ETag != "" {
+		req.Header.Set("If-None-Match", response.ETag)
+	}
+
+	if response.LastModified != "" {
+		req.Header.Set("If-Modified-Since", response.LastModified)
+	}
+}
+
+// makeCachedResponse makes a CachedResponse from the given response headers and body. If the headers contain no
+// validators, false is returned, as the response could never be revalidated.
+func makeCachedResponse(header http.Header, body []byte) (CachedResponse, bool) {
+	response := CachedResponse{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Body:         body,
+	}
+
+	return response, response.ETag != "" || response.LastModified != ""
+}
@@ -0,0 +1,322 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/xerrors"
+)
+
+const cloudflareAPIBaseURL = "https://api.cloudflare.com/client/v4"
+
+// cloudflareAutomaticTTL is the TTL that asks Cloudflare to pick a TTL automatically.
+const cloudflareAutomaticTTL = 1
+
+func init() {
+	Register("cloudflare", newCloudflareIPSetterFromConfig)
+}
+
+// CloudflareIPSetter is an IPSetter that will update records in Cloudflare's DNS
+type CloudflareIPSetter struct {
+	apiToken        string
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+	duplicatePolicy DuplicateRecordPolicy
+}
+
+// cloudflareTransaction holds all elements necessary to talk to the Cloudflare API, in the context of a single
+// CloudflareIPSetter.SetIP call.
+type cloudflareTransaction struct {
+	client restClient
+}
+
+// cloudflareZone is a zone, as represented by the Cloudflare API.
+type cloudflareZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// cloudflareRecord is a DNS record, as represented by the Cloudflare API.
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// CloudflareRecordTTL should be passed to NewCloudflareIPSetter if a TTL is desired for the records it sets. If not
+// given, Cloudflare will choose the TTL automatically.
+func CloudflareRecordTTL(ttl int) func(*CloudflareIPSetter) error {
+	return func(setter *CloudflareIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// CloudflareHTTPConfig should be passed to NewCloudflareIPSetter to control how the HTTP client that talks to the
+// Cloudflare API is constructed, such as its timeouts.
+func CloudflareHTTPConfig(config HTTPConfig) func(*CloudflareIPSetter) error {
+	return func(setter *CloudflareIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// CloudflareRetryPolicy should be passed to NewCloudflareIPSetter to control how calls to the Cloudflare API are
+// retried when they fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func CloudflareRetryPolicy(policy RetryPolicy) func(*CloudflareIPSetter) error {
+	return func(setter *CloudflareIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// CloudflareDuplicateRecordPolicy should be passed to NewCloudflareIPSetter to control what is done when several
+// records exist for the same name. If not given, UpdateFirstDuplicate is used.
+func CloudflareDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*CloudflareIPSetter) error {
+	return func(setter *CloudflareIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// NewCloudflareIPSetter makes a new Cloudflare IPSetter, which authenticates with the given API token. The token must
+// have the Zone:Read and DNS:Edit permissions for any zones it will be used with.
+func NewCloudflareIPSetter(apiToken string, options ...func(*CloudflareIPSetter) error) (CloudflareIPSetter, error) {
+	setter := CloudflareIPSetter{
+		apiToken:    apiToken,
+		recordTTL:   cloudflareAutomaticTTL,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return CloudflareIPSetter{}, xerrors.Errorf("could not construct CloudflareIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeTransaction will make a new Cloudflare API transaction for the given setter.
+func (setter CloudflareIPSetter) makeTransaction(ctx context.Context) cloudflareTransaction {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+setter.apiToken)
+
+	return cloudflareTransaction{
+		client: newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, cloudflareAPIBaseURL, header),
+	}
+}
+
+// getZoneID gets the ID of the Cloudflare zone for the given domain.
+func (transaction cloudflareTransaction) getZoneID(domain string) (string, error) {
+	var response struct {
+		Result []cloudflareZone `json:"result"`
+	}
+
+	err := transaction.client.do(http.MethodGet, "/zones?name="+url.QueryEscape(domain), nil, &response)
+	if err != nil {
+		return "", xerrors.Errorf("could not ask Cloudflare API for zone: %w", err)
+	}
+
+	for _, zone := range response.Result {
+		if zone.Name == domain {
+			return zone.ID, nil
+		}
+	}
+
+	return "", xerrors.Errorf("no Cloudflare zone exists for domain %s", domain)
+}
+
+// listIDRecords gets all of the records with the given type and fully qualified name in the zone with the given ID.
+func (transaction cloudflareTransaction) listIDRecords(zoneID, recordType, name string) ([]idRecord, error) {
+	var response struct {
+		Result []cloudflareRecord `json:"result"`
+	}
+
+	query := url.Values{}
+	query.Set("type", recordType)
+	query.Set("name", name)
+	err := transaction.client.do(http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &response)
+	if err != nil {
+		return nil, xerrors.Errorf("could not ask Cloudflare API for records: %w", err)
+	}
+
+	records := make([]idRecord, len(response.Result))
+	for i, record := range response.Result {
+		records[i] = record.idRecord()
+	}
+
+	return records, nil
+}
+
+// createIDRecord creates the given record in the zone with the given ID.
+func (transaction cloudflareTransaction) createIDRecord(zoneID string, record idRecord) (idRecord, error) {
+	var response struct {
+		Result cloudflareRecord `json:"result"`
+	}
+
+	err := transaction.client.create("/zones/"+zoneID+"/dns_records", makeCloudflareRecord(record), &response)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not create record for zone: %w", err)
+	}
+
+	return response.Result.idRecord(), nil
+}
+
+// updateIDRecord updates the value and TTL of the record with the ID of the given record in the zone with the given
+// ID. Any other settings of the record, such as whether or not it is proxied, are left alone.
+func (transaction cloudflareTransaction) updateIDRecord(zoneID string, record idRecord) (idRecord, error) {
+	patch := struct {
+		Content string `json:"content"`
+		TTL     int    `json:"ttl"`
+	}{
+		Content: record.Value,
+		TTL:     record.TTL,
+	}
+
+	var response struct {
+		Result cloudflareRecord `json:"result"`
+	}
+
+	err := transaction.client.do(http.MethodPatch, "/zones/"+zoneID+"/dns_records/"+record.ID, patch, &response)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not update record for zone: %w", err)
+	}
+
+	return response.Result.idRecord(), nil
+}
+
+// deleteIDRecord deletes the record with the ID of the given record in the zone with the given ID.
+func (transaction cloudflareTransaction) deleteIDRecord(zoneID string, record idRecord) error {
+	err := transaction.client.do(http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+record.ID, nil, nil)
+	if err != nil {
+		return xerrors.Errorf("could not delete record for zone: %w", err)
+	}
+
+	return nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with Cloudflare.
+func (setter CloudflareIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter CloudflareIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	transaction := setter.makeTransaction(ctx)
+	zoneID, err := transaction.getZoneID(domain)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	record := setter.ipRecord(domain, name, ip)
+	_, err = setIDRecord(transaction, zoneID, record, setter.duplicatePolicy)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// PlanIP gets the changes that SetIP would make to Cloudflare's records, without making them.
+func (setter CloudflareIPSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	transaction := setter.makeTransaction(context.Background())
+	zoneID, err := transaction.getZoneID(domain)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	target := Target{Domain: domain, Name: name}
+	changes, err := planIDRecord(transaction, zoneID, target, setter.ipRecord(domain, name, ip), setter.duplicatePolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	return changes, nil
+}
+
+// ipRecord makes the record that associates the given ip with the given domain and subdomain name. Cloudflare names
+// records by their fully qualified names.
+func (setter CloudflareIPSetter) ipRecord(domain, name string, ip net.IP) idRecord {
+	return idRecord{
+		Type:  ipRecordType(ip),
+		Name:  fqdn(domain, name),
+		Value: ip.String(),
+		TTL:   setter.recordTTL,
+	}
+}
+
+// CheckAccess confirms that the setter's token is able to access the zone for the given domain.
+func (setter CloudflareIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	_, err := transaction.getZoneID(domain)
+	switch httpStatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return xerrors.Errorf("Cloudflare token lacks access to domain %s: %w", domain, err)
+	default:
+		return err
+	}
+}
+
+// idRecord converts the Cloudflare record into an idRecord.
+func (record cloudflareRecord) idRecord() idRecord {
+	return idRecord{
+		ID:    record.ID,
+		Type:  record.Type,
+		Name:  record.Name,
+		Value: record.Content,
+		TTL:   record.TTL,
+	}
+}
+
+// makeCloudflareRecord converts an idRecord into a Cloudflare record.
+func makeCloudflareRecord(record idRecord) cloudflareRecord {
+	return cloudflareRecord{
+		ID:      record.ID,
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Value,
+		TTL:     record.TTL,
+	}
+}
+
+// cloudflareConfig represents the JSON config of a CloudflareIPSetter, for use with NewSetterFromConfig.
+type cloudflareConfig struct {
+	AccessToken string `json:"access_token"`
+}
+
+// newCloudflareIPSetterFromConfig makes a CloudflareIPSetter from the given JSON config and shared settings.
+func newCloudflareIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := cloudflareConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*CloudflareIPSetter) error{
+		CloudflareHTTPConfig(options.HTTPConfig),
+		CloudflareRetryPolicy(options.retryPolicy()),
+		CloudflareDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+	}
+
+	// Without a TTL of its own, the record is left to Cloudflare's automatic TTL, as Cloudflare rejects a TTL of zero.
+	if options.RecordTTL != 0 {
+		setterOptions = append(setterOptions, CloudflareRecordTTL(options.RecordTTL))
+	}
+
+	return NewCloudflareIPSetter(config.AccessToken, setterOptions...)
+}
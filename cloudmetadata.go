@@ -0,0 +1,225 @@
+package pinamicdns
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// CloudProvider is a cloud provider whose instance metadata service a CloudMetadataIPSource may read from.
+type CloudProvider string
+
+// Cloud providers whose instance metadata services are supported
+const (
+	DigitalOceanCloud CloudProvider = "digitalocean"
+	EC2Cloud          CloudProvider = "ec2"
+	GCECloud          CloudProvider = "gce"
+)
+
+// Timeouts that a CloudMetadataIPSource's requests use, if no others are given. Metadata services are reached without
+// leaving the host, so they should respond far faster than other services.
+const (
+	defaultCloudMetadataConnectTimeout = 2 * time.Second
+	defaultCloudMetadataRequestTimeout = 5 * time.Second
+)
+
+// Base URLs of the cloud providers' instance metadata services
+const (
+	digitalOceanMetadataURL = "http://169.254.169.254/metadata/v1/"
+	ec2MetadataURL          = "http://169.254.169.254/latest/"
+	gceMetadataURL          = "http://metadata.google.internal/computeMetadata/v1/"
+)
+
+// ec2MetadataTokenTTL is how many seconds the session tokens that are requested from EC2's metadata service live for.
+// A token is only used for a single lookup, so it need not live long.
+const ec2MetadataTokenTTL = "60"
+
+// CloudMetadataIPSource is an IPSource that reads the public address of a cloud instance from its provider's instance
+// metadata service. This is authoritative, even for addresses that can be moved between instances, such as
+// DigitalOcean's reserved IPs, and it requires no traffic to leave the instance.
+type CloudMetadataIPSource struct {
+	provider   CloudProvider
+	baseURL    string
+	ipv6       bool
+	httpConfig HTTPConfig
+}
+
+// CloudMetadataIPv6 should be passed to NewCloudMetadataIPSource to read the instance's public IPv6 address, rather
+// than its IPv4 address. This is not supported for GCE.
+func CloudMetadataIPv6() func(*CloudMetadataIPSource) error {
+	return func(source *CloudMetadataIPSource) error {
+		if source.provider == GCECloud {
+			return xerrors.New("IPv6 addresses are not supported for GCE")
+		}
+
+		source.ipv6 = true
+		return nil
+	}
+}
+
+// CloudMetadataHTTPConfig should be passed to NewCloudMetadataIPSource to control how the HTTP client that reads from
+// the metadata service is constructed. If not given, short timeouts are used. Metadata services can't be reached
+// through a proxy, so any that is configured is ignored.
+func CloudMetadataHTTPConfig(config HTTPConfig) func(*CloudMetadataIPSource) error {
+	return func(source *CloudMetadataIPSource) error {
+		source.httpConfig = config
+		return nil
+	}
+}
+
+// CloudMetadataBaseURL should be passed to NewCloudMetadataIPSource if the metadata service is not at the provider's
+// usual URL, such as when it is being emulated.
+func CloudMetadataBaseURL(baseURL string) func(*CloudMetadataIPSource) error {
+	return func(source *CloudMetadataIPSource) error {
+		if baseURL == "" {
+			return xerrors.New("base URL must not be empty")
+		}
+
+		source.baseURL = strings.TrimSuffix(baseURL, "/") + "/"
+		return nil
+	}
+}
+
+// NewCloudMetadataIPSource makes a new CloudMetadataIPSource, which will read from the instance metadata service of the
+// given provider.
+func NewCloudMetadataIPSource(provider CloudProvider, options ...func(*CloudMetadataIPSource) error) (CloudMetadataIPSource, error) {
+	source := CloudMetadataIPSource{
+		provider: provider,
+		httpConfig: HTTPConfig{
+			ConnectTimeout: defaultCloudMetadataConnectTimeout,
+			RequestTimeout: defaultCloudMetadataRequestTimeout,
+		},
+	}
+
+	switch provider {
+	case DigitalOceanCloud:
+		source.baseURL = digitalOceanMetadataURL
+	case EC2Cloud:
+		source.baseURL = ec2MetadataURL
+	case GCECloud:
+		source.baseURL = gceMetadataURL
+	default:
+		return CloudMetadataIPSource{}, xerrors.Errorf("could not construct CloudMetadataIPSource: unknown provider %q", provider)
+	}
+
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return CloudMetadataIPSource{}, xerrors.Errorf("could not construct CloudMetadataIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the public IP address of the instance from the source's metadata service.
+func (source CloudMetadataIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source CloudMetadataIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	client := source.httpConfig.Client()
+	client.Transport.(*http.Transport).Proxy = nil
+
+	var rawIP string
+	var err error
+	switch source.provider {
+	case DigitalOceanCloud:
+		rawIP, err = source.digitalOceanIP(ctx, client)
+	case EC2Cloud:
+		rawIP, err = source.ec2IP(ctx, client)
+	default:
+		rawIP, err = source.get(ctx, client, "instance/network-interfaces/0/access-configs/0/external-ip", http.Header{
+			"Metadata-Flavor": []string{"Google"},
+		})
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("could not read IP from %s metadata: %w", source.provider, err)
+	}
+
+	ip := net.ParseIP(rawIP)
+	if ip == nil {
+		return nil, xerrors.Errorf("%s metadata has no public address: %q", source.provider, rawIP)
+	}
+
+	return ip, nil
+}
+
+// digitalOceanIP reads the droplet's public address from DigitalOcean's metadata service. If the droplet has a reserved
+// IP, that is used instead, as it is the address through which the droplet is meant to be reached.
+func (source CloudMetadataIPSource) digitalOceanIP(ctx context.Context, client *http.Client) (string, error) {
+	family := "ipv4"
+	if source.ipv6 {
+		family = "ipv6"
+	}
+
+	reserved, err := source.get(ctx, client, "reserved_ip/"+family+"/active", nil)
+	if err == nil && reserved == "true" {
+		return source.get(ctx, client, "reserved_ip/"+family+"/ip_address", nil)
+	}
+
+	return source.get(ctx, client, "interfaces/public/0/"+family+"/address", nil)
+}
+
+// ec2IP reads the instance's public address from EC2's metadata service, using a session token as IMDSv2 requires.
+func (source CloudMetadataIPSource) ec2IP(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, source.baseURL+"api/token", nil)
+	if err != nil {
+		return "", xerrors.Errorf("could not make token request: %w", err)
+	}
+
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", ec2MetadataTokenTTL)
+	token, err := source.do(ctx, client, req)
+	if err != nil {
+		return "", xerrors.Errorf("could not get session token: %w", err)
+	}
+
+	path := "meta-data/public-ipv4"
+	if source.ipv6 {
+		path = "meta-data/ipv6"
+	}
+
+	return source.get(ctx, client, path, http.Header{"X-aws-ec2-metadata-token": []string{token}})
+}
+
+// get reads the metadata at the given path, relative to the metadata service's base URL, with the given headers.
+func (source CloudMetadataIPSource) get(ctx context.Context, client *http.Client, path string, header http.Header) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, source.baseURL+path, nil)
+	if err != nil {
+		return "", xerrors.Errorf("could not make request for %s: %w", path, err)
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	return source.do(ctx, client, req)
+}
+
+// do makes the given request to the metadata service, returning the body of a successful response.
+func (source CloudMetadataIPSource) do(ctx context.Context, client *http.Client, req *http.Request) (string, error) {
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", xerrors.Errorf("%s returned status %s", req.URL.Path, res.Status)
+	}
+
+	resData, err := ioutil.ReadAll(io.LimitReader(res.Body, maxIPResponseSize))
+	if err != nil {
+		return "", xerrors.Errorf("could not read %s: %w", req.URL.Path, err)
+	}
+
+	return strings.TrimSpace(string(resData)), nil
+}
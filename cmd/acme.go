@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// acmeChallengeTTL is the TTL of the TXT records published for ACME challenges. They only need to live for as long as
+// the challenge does, so there's no reason to have resolvers hold on to them.
+const acmeChallengeTTL = 60
+
+// Actions that may be given to the acme command
+const (
+	acmeActionPresent = "present"
+	acmeActionCleanup = "cleanup"
+)
+
+// runACMECommand publishes or cleans up an ACME DNS-01 challenge with the given setter, in correspondence with the
+// given arguments. These take the form of an action, optionally followed by the name that is being validated and the
+// challenge value, as given to a lego exec hook. If the name and value are not given, they are taken from the
+// environment variables given to a certbot manual hook.
+func runACMECommand(args []string, config Config, setter pinamicdns.IPSetter) error {
+	if len(args) != 1 && len(args) != 3 {
+		return errors.New("usage: acme present|cleanup [name value]")
+	} else if args[0] != acmeActionPresent && args[0] != acmeActionCleanup {
+		return fmt.Errorf("unknown acme action %q; must be %s or %s", args[0], acmeActionPresent, acmeActionCleanup)
+	}
+
+	host, value := os.Getenv("CERTBOT_DOMAIN"), os.Getenv("CERTBOT_VALIDATION")
+	if len(args) == 3 {
+		host, value = args[1], args[2]
+	}
+
+	if host == "" || value == "" {
+		return errors.New("name and challenge value must be given, either as arguments or by certbot")
+	}
+
+	name, err := acmeChallengeSubdomain(host, config.DNSConfig.Domain)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case acmeActionPresent:
+		adder, ok := setter.(pinamicdns.RecordAdder)
+		if !ok {
+			return errors.New("the configured provider can not publish ACME challenges")
+		}
+
+		return pinamicdns.PresentACMEChallenge(adder, config.DNSConfig.Domain, name, value, acmeChallengeTTL)
+	default:
+		remover, ok := setter.(pinamicdns.RecordRemover)
+		if !ok {
+			return errors.New("the configured provider can not clean up ACME challenges")
+		}
+
+		return pinamicdns.CleanUpACMEChallenge(remover, config.DNSConfig.Domain, name, value)
+	}
+}
+
+// acmeChallengeSubdomain gets the subdomain name, within the given domain, that the given host is being validated for.
+// The host may be either the name being validated, or the name of its challenge record.
+func acmeChallengeSubdomain(host, domain string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain = strings.ToLower(domain)
+
+	var name string
+	if host != domain {
+		if !strings.HasSuffix(host, "."+domain) {
+			return "", fmt.Errorf("%s is not within the configured domain %s", host, domain)
+		}
+
+		name = strings.TrimSuffix(host, "."+domain)
+	}
+
+	if name == pinamicdns.ACMEChallengeLabel {
+		return "", nil
+	}
+
+	return strings.TrimPrefix(name, pinamicdns.ACMEChallengeLabel+"."), nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAPIHistory is the most changes to the records that the API remembers.
+const maxAPIHistory = 100
+
+// maxPendingEvents is the most changes that may be waiting to be sent to a client of /events. A client that falls
+// further behind is disconnected, rather than holding up the daemon, and may fetch /history once it reconnects.
+const maxPendingEvents = 16
+
+// eventKeepaliveInterval is how often a comment is sent to clients of /events while there are no changes, so that
+// proxies don't close their connections for being idle.
+const eventKeepaliveInterval = 30 * time.Second
+
+// apiServer serves an authenticated HTTP API with which the daemon can be asked to update the records, and its records
+// and their recent changes can be queried, such as by home automation. A nil apiServer serves nothing, so that it need
+// not be checked for when no API address is configured.
+type apiServer struct {
+	server *http.Server
+	token  string
+	// updateRequests receives when an update has been asked for. It holds at most one request, as any more would be
+	// covered by the same update.
+	updateRequests chan struct{}
+	mutex          sync.Mutex
+	records        []apiRecord
+	// history holds the most recent changes to the records, oldest first.
+	history []apiChange
+	// subscribers receive each change as it happens, for the clients of /events. Each is closed if its client falls
+	// too far behind.
+	subscribers map[chan apiChange]bool
+	// updateLimiter limits how many updates each client may ask for.
+	updateLimiter *requestLimiter
+}
+
+// apiRecord is one of the records that the daemon manages, as served by /records.
+type apiRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// IP is the address that was last published for the record, if any has been.
+	IP        string     `json:"ip"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	// LastResult is the result of the record in the last update, as in the status file, if it was part of the update.
+	LastResult string `json:"last_result,omitempty"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// apiChange is a change to a record's address, as served by /history.
+type apiChange struct {
+	Time       time.Time `json:"time"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	PreviousIP string    `json:"previous_ip"`
+	IP         string    `json:"ip"`
+}
+
+// apiError is the body of a response to a request that could not be served.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// startAPIServer starts serving the API on the given address, accepting requests that give the given bearer token.
+// The given records are those that the daemon manages when it starts. Any failure to serve once started is logged to
+// the given logger.
+func startAPIServer(address string, token string, records []apiRecord, logger *log.Logger) (*apiServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &apiServer{
+		token:          token,
+		updateRequests: make(chan struct{}, 1),
+		records:        records,
+		history:        []apiChange{},
+		subscribers:    map[chan apiChange]bool{},
+		updateLimiter:  newRequestLimiter(defaultMaxClientRequests, clientRequestWindow),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update", api.authorized(http.MethodPost, api.serveUpdate))
+	mux.HandleFunc("/records", api.authorized(http.MethodGet, api.serveRecords))
+	mux.HandleFunc("/history", api.authorized(http.MethodGet, api.serveHistory))
+	mux.HandleFunc("/events", api.authorized(http.MethodGet, api.serveEvents))
+	api.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := api.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			logger.Printf("API server stopped: %s", err)
+		}
+	}()
+
+	return api, nil
+}
+
+// close stops serving the API.
+func (api *apiServer) close() {
+	if api == nil {
+		return
+	}
+
+	api.server.Close()
+}
+
+// requests gets the channel that receives when an update has been asked for, which never does if there is no API.
+func (api *apiServer) requests() <-chan struct{} {
+	if api == nil {
+		return nil
+	}
+
+	return api.updateRequests
+}
+
+// recordUpdate records the records that the daemon manages after an update finished at the given time, noting any of
+// their addresses that changed.
+func (api *apiServer) recordUpdate(records []apiRecord, now time.Time) {
+	if api == nil {
+		return
+	}
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	previousIPs := map[string]string{}
+	for _, record := range api.records {
+		previousIPs[record.Name+" "+record.Type] = record.IP
+	}
+
+	for _, record := range records {
+		previousIP := previousIPs[record.Name+" "+record.Type]
+		if record.IP != "" && record.IP != previousIP {
+			change := apiChange{
+				Time:       now,
+				Name:       record.Name,
+				Type:       record.Type,
+				PreviousIP: previousIP,
+				IP:         record.IP,
+			}
+
+			api.history = append(api.history, change)
+			api.publish(change)
+		}
+	}
+
+	if len(api.history) > maxAPIHistory {
+		api.history = append([]apiChange{}, api.history[len(api.history)-maxAPIHistory:]...)
+	}
+
+	api.records = records
+}
+
+// publish sends the given change to each of the subscribers, disconnecting any that have fallen too far behind. The
+// API's mutex must be held.
+func (api *apiServer) publish(change apiChange) {
+	for subscriber := range api.subscribers {
+		select {
+		case subscriber <- change:
+		default:
+			delete(api.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// subscribe gets a channel that receives each change to the records from now on, until unsubscribe is called with it,
+// or it is closed for falling too far behind.
+func (api *apiServer) subscribe() chan apiChange {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	subscriber := make(chan apiChange, maxPendingEvents)
+	api.subscribers[subscriber] = true
+
+	return subscriber
+}
+
+// unsubscribe stops the given channel from receiving changes to the records, if it has not already been.
+func (api *apiServer) unsubscribe(subscriber chan apiChange) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	if api.subscribers[subscriber] {
+		delete(api.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// authorized wraps the given handler so that it only serves requests with the given method that give the API's token.
+func (api *apiServer) authorized(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "a valid bearer token must be given"})
+			return
+		} else if req.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: method + " must be used"})
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// serveUpdate asks the daemon to update the records as soon as it can, detecting the current address even if it was
+// detected within the recheck interval. It responds before the update is made, which /records shows the result of.
+// Clients that ask too often are refused.
+func (api *apiServer) serveUpdate(w http.ResponseWriter, req *http.Request) {
+	if wait, ok := api.updateLimiter.allow(time.Now(), requestClient(req)); !ok {
+		setRetryAfter(w, wait)
+		writeJSON(w, http.StatusTooManyRequests, apiError{Error: "too many updates have been asked for"})
+		return
+	}
+
+	select {
+	case api.updateRequests <- struct{}{}:
+	default:
+		// An update has already been asked for, and hasn't been made yet.
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+// serveRecords responds with the records that the daemon manages.
+func (api *apiServer) serveRecords(w http.ResponseWriter, req *http.Request) {
+	api.mutex.Lock()
+	records := api.records
+	api.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+// serveHistory responds with the most recent changes to the records, oldest first.
+func (api *apiServer) serveHistory(w http.ResponseWriter, req *http.Request) {
+	api.mutex.Lock()
+	history := api.history
+	api.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// serveEvents streams each change to the records' addresses as it happens, as server-sent events, until the client
+// goes away. Each is a change event whose data is the change, as /history gives it.
+func (api *apiServer) serveEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "events can't be streamed"})
+		return
+	}
+
+	subscriber := api.subscribe()
+	defer api.unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case change, ok := <-subscriber:
+			if !ok {
+				return
+			}
+
+			rawChange, err := json.Marshal(change)
+			if err != nil {
+				return
+			}
+
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", rawChange)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// apiRecords gets the records that the given updater manages, along with their results in the given status of the
+// last update, if any.
+func apiRecords(recordUpdater updater, status runStatus) []apiRecord {
+	stateKey, err := configStateKey(recordUpdater.config)
+	if err != nil {
+		return []apiRecord{}
+	}
+
+	configuredRecords, err := configRecords(recordUpdater.config)
+	if err != nil {
+		return []apiRecord{}
+	}
+
+	types := recordTypes(configuredRecords)
+	results := map[string]recordStatus{}
+	for _, record := range status.records {
+		results[record.Name+" "+record.Type] = record
+	}
+
+	recordState := recordUpdater.state.Records[stateKey]
+	var updatedAt *time.Time
+	if !recordState.UpdatedAt.IsZero() {
+		updatedAt = &recordState.UpdatedAt
+	}
+
+	records := []apiRecord{}
+	for _, name := range strings.Split(stateKey, ",") {
+		for _, recordType := range []string{"A", "AAAA"} {
+			if types[name] != "" && types[name] != recordType {
+				continue
+			}
+
+			ip := recordState.IP
+			if recordType == "AAAA" {
+				ip = recordState.IPv6
+			}
+
+			result, ok := results[name+" "+recordType]
+			if ip == "" && !ok {
+				continue
+			}
+
+			records = append(records, apiRecord{
+				Name:       name,
+				Type:       recordType,
+				IP:         ip,
+				UpdatedAt:  updatedAt,
+				LastResult: result.Result,
+				LastError:  result.Error,
+			})
+		}
+	}
+
+	return records
+}
@@ -1,67 +1,1313 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
-	"golang.org/x/oauth2"
+	pinamicdns "github.com/ollien/pinamic-dns"
 )
 
 const defaultConfigPath = "./config.json"
 
+// Defaults for CircuitBreakerConfig
+const (
+	defaultFailureThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Minute
+)
+
+// Defaults for FailoverConfig, if the failover section is present
+const (
+	defaultFailoverAttempts = 1
+	defaultFailoverBackoff  = 5 * time.Second
+	maxFailoverBackoff      = time.Minute
+)
+
+// Limits on what records may be given in the config
+const (
+	// maxRecordTTL is the largest TTL that RFC 2181 allows.
+	maxRecordTTL         = 2147483647
+	maxDomainNameLength  = 253
+	maxDomainLabelLength = 63
+)
+
+// defaultDaemonInterval is how long to wait between updates when running as a daemon, if no other interval is
+// configured.
+const defaultDaemonInterval = 5 * time.Minute
+
+// addressChangeSettleDelay is how long to wait after the addresses of this machine change before updating, so that an
+// interface being reconfigured has time to settle.
+const addressChangeSettleDelay = 2 * time.Second
+
+// Modes that IPDetectionConfig may use to find the current IP address
+const (
+	ipDetectionFallback  = "fallback"
+	ipDetectionConsensus = "consensus"
+)
+
+// Defaults for VerifyConfig, if the verify_updates section is present
+const (
+	defaultVerifyAttempts = 3
+	defaultResolveTimeout = 2 * time.Minute
+)
+
 // Config holds the configuration for the application
-// Implements oauth2.TokenSource
 type Config struct {
-	AccessToken string    `json:"access_token"`
-	DNSConfig   DNSConfig `json:"dns_config"`
+	Provider       string               `json:"provider"`
+	ProviderConfig json.RawMessage      `json:"provider_config"`
+	AccessToken    string               `json:"access_token"`
+	Providers      []ProviderEntry      `json:"providers"`
+	Failover       *FailoverConfig      `json:"failover"`
+	DNSConfig      DNSConfig            `json:"dns_config"`
+	Defaults       RecordDefaultsConfig `json:"defaults"`
+	HTTPConfig     HTTPConfig           `json:"http_config"`
+	IPDetection    IPDetectionConfig    `json:"ip_detection"`
+	Daemon         DaemonConfig         `json:"daemon"`
+	IPValidation   IPValidationConfig   `json:"ip_validation"`
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+	Retry          RetryConfig          `json:"retry"`
+	GeoIP          GeoIPConfig          `json:"geoip"`
+	// AccessTokenFile and AccessTokenEnv give the access token by the path of a file or the name of an environment
+	// variable, rather than in the config itself. AccessTokenCmd gives a command, run with the shell, that prints it,
+	// and AccessTokenKeyring reads it from the OS keyring instead. Any of them may also be given in a provider_config.
+	AccessTokenFile    string `json:"access_token_file"`
+	AccessTokenEnv     string `json:"access_token_env"`
+	AccessTokenCmd     string `json:"access_token_cmd"`
+	AccessTokenKeyring bool   `json:"access_token_keyring"`
+	// StatusFile, if given, is a file that describes the outcome of the last update as JSON, for monitoring.
+	StatusFile string `json:"status_file"`
+	// DyndnsServer is the config of the server that the serve command runs.
+	DyndnsServer *DyndnsServerConfig `json:"dyndns_server"`
 }
 
-// DNSConfig represents the config of the DNS records that will be updated.
-type DNSConfig struct {
+// ProviderEntry represents one of several providers that records will be set with.
+type ProviderEntry struct {
+	// Name identifies the provider in logs. If not given, the name of the provider is used.
+	Name           string          `json:"name"`
+	Provider       string          `json:"provider"`
+	ProviderConfig json.RawMessage `json:"provider_config"`
+	// Record, if given, is the record that is set with this provider, rather than the one in the DNSConfig.
+	Record *RecordConfig `json:"record"`
+	// Records, if given, are several records that are set with this provider, rather than the one in the DNSConfig.
+	Records []RecordConfig `json:"records"`
+	// RequestInterval, if given, is the least time between the records set with this provider, rather than the one in
+	// the DNSConfig.
+	RequestInterval pinamicdns.Duration `json:"request_interval"`
+}
+
+// FailoverConfig represents the config of how providers are fallen back on, if only the first of them to succeed
+// should set records.
+type FailoverConfig struct {
+	// Attempts is the number of times each provider is tried, if it fails for transient reasons, before the next is.
+	Attempts int `json:"attempts"`
+	// Backoff is how long to wait after the first failed attempt with a provider. It doubles for each attempt after.
+	Backoff pinamicdns.Duration `json:"backoff"`
+	// AbortOnPermanentError stops providers from being fallen back on when one fails for a reason other than a transient
+	// one, such as a rejected access token.
+	AbortOnPermanentError bool `json:"abort_on_permanent_error"`
+}
+
+// RecordConfig represents the config of a single record, which is set to the same address as the one in the
+// DNSConfig.
+type RecordConfig struct {
 	Domain string `json:"domain"`
 	Name   string `json:"name"`
+	// Type, if given, limits the record to being set as either an A or AAAA record, rather than both.
+	Type string `json:"type"`
+	// TTL, if given, is the TTL of the record, rather than the one in the DNSConfig.
+	TTL int `json:"ttl"`
+	// Provider, if given, is the name of the one of providers that sets the record, rather than all of those that set
+	// the records in the DNSConfig. It may only be given for records in the DNSConfig.
+	Provider string `json:"provider"`
+}
+
+// RecordDefaultsConfig holds the settings that each record given in a list of records, either in the DNSConfig or in
+// one of providers, is given unless it gives its own.
+type RecordDefaultsConfig struct {
+	Domain string `json:"domain"`
 	TTL    int    `json:"ttl"`
+	// Provider may only be given to records in the DNSConfig.
+	Provider string `json:"provider"`
+}
+
+// DNSConfig represents the config of the DNS records that will be updated.
+type DNSConfig struct {
+	Domain           string         `json:"domain"`
+	Name             string         `json:"name"`
+	Names            []string       `json:"names"`
+	Domains          []DomainConfig `json:"domains"`
+	TTL              int            `json:"ttl"`
+	DuplicateRecords string         `json:"duplicate_records"`
+	VerifyUpdates    *VerifyConfig  `json:"verify_updates"`
+	// MinUpdateInterval is the least time that must pass between writes to the provider. Updates that would come
+	// sooner are held back until it has passed, and made with whatever the address is then.
+	MinUpdateInterval pinamicdns.Duration `json:"min_update_interval"`
+	// Records are records that are set alongside any given by name, each of which may have its own type, TTL, and
+	// provider.
+	Records []RecordConfig `json:"records"`
+	// Concurrency is how many records may be set at once. If not given, defaultConcurrency is used.
+	Concurrency int `json:"concurrency"`
+	// RequestInterval is the least time between the start of setting any two records with the same provider, so that
+	// setting many records at once does not exceed its API's rate limits.
+	RequestInterval pinamicdns.Duration `json:"request_interval"`
+}
+
+// DomainConfig represents the config of the records in one of several domains that will be updated.
+type DomainConfig struct {
+	Domain string   `json:"domain"`
+	Names  []string `json:"names"`
+	// TTL, if given, is the TTL of each of the records in the domain, rather than the one in the DNSConfig.
+	TTL int `json:"ttl"`
+}
+
+// IPDetectionConfig represents the config of how the current IP addresses are found. Its own sources find the
+// address for A records, and may find one for AAAA records in its IPv6 section.
+type IPDetectionConfig struct {
+	IPSourcesConfig
+	// IPv6, if given, finds an IPv6 address to publish alongside the address its parent finds, so that both A and
+	// AAAA records are set.
+	IPv6 *IPSourcesConfig `json:"ipv6"`
+	// RecheckInterval is how long detected addresses are used for before they are detected again. If not given, they
+	// are detected on every run.
+	RecheckInterval pinamicdns.Duration `json:"recheck_interval"`
+}
+
+// OpenWrtSourceConfig represents the config of an OpenWrt router that the current IP address may be found with.
+type OpenWrtSourceConfig struct {
+	// URL is the URL of the router's ubus API, such as http://192.168.1.1/ubus.
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Interface is the name of the router's network interface to read the address from. If not given, wan is used, or
+	// wan6 for IPv6 addresses.
+	Interface string `json:"interface"`
+}
+
+// GeoIPConfig represents the config of how the networks and locations of addresses are looked up, so that changes to
+// the published IP can be logged with them.
+type GeoIPConfig struct {
+	// Enabled looks up the old and new addresses whenever the published IP changes.
+	Enabled bool `json:"enabled"`
+	// Token is an ipinfo.io access token, for more lookups than are allowed without one.
+	Token string `json:"token"`
+}
+
+// DaemonConfig represents the config of how pinamic-dns runs as a daemon.
+type DaemonConfig struct {
+	// Interval is how long to wait between updates. If not given, defaultDaemonInterval is used.
+	Interval pinamicdns.Duration `json:"interval"`
+	// Jitter, if given, is the most that is randomly added to each interval, so that many machines started at once don't
+	// all update at the same time.
+	Jitter pinamicdns.Duration `json:"jitter"`
+	// WatchAddresses updates the records as soon as the addresses of this machine's interfaces or its default routes
+	// change, rather than only every interval. This is only supported on Linux.
+	WatchAddresses bool `json:"watch_addresses"`
+	// HealthAddress, if given, is the address that the daemon serves /healthz and /status on, such as 127.0.0.1:8053.
+	HealthAddress string `json:"health_address"`
+	// HealthFile, if given, is a file that is written after each successful update, and removed after each failed one,
+	// so that its presence and age show whether or not the daemon is healthy.
+	HealthFile string `json:"health_file"`
+	// APIAddress, if given, is the address that the daemon serves its API on, such as 127.0.0.1:8054.
+	APIAddress string `json:"api_address"`
+	// APIToken is the bearer token that requests to the API must give.
+	APIToken string `json:"api_token"`
+	// RemoveOnExit removes the records when the daemon is asked to stop, so that they don't outlive the machine.
+	RemoveOnExit bool `json:"remove_on_exit"`
+}
+
+// DyndnsServerConfig represents the config of a server that accepts updates in the dyndns2 protocol, such as from a
+// router, and publishes the addresses they give.
+type DyndnsServerConfig struct {
+	// Address is the address to listen for updates on, such as :8245.
+	Address string `json:"address"`
+	// Username and Password are the credentials that updates must give.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// MaxClientRequests is the most requests, including those that fail, that one address may make in a minute. If
+	// not given, defaultMaxClientRequests is used.
+	MaxClientRequests int `json:"max_client_requests"`
+	// MinHostnameInterval is the least time between updates of any one hostname. If not given,
+	// defaultMinHostnameInterval is used.
+	MinHostnameInterval pinamicdns.Duration `json:"min_hostname_interval"`
+}
+
+// IPSourcesConfig represents the config of the sources that an IP address is found with.
+type IPSourcesConfig struct {
+	// Sources are asked for the current IP address in order, until one of them succeeds, unless the mode says
+	// otherwise.
+	Sources []IPSourceConfig `json:"sources"`
+	// Mode is how the sources are used to find the current IP address: either fallback or consensus.
+	Mode string `json:"mode"`
+	// Quorum is the number of sources that must agree upon an address in consensus mode. If not given, a majority must.
+	Quorum int `json:"quorum"`
+	// StaticIP, if given, is published rather than asking any sources for the current IP address.
+	StaticIP string `json:"static_ip"`
+	// Timeout is how long each of the sources may take to find the address, unless it gives its own. If not given, the
+	// timeouts of the HTTPConfig are used for sources that make HTTP requests, and each other source has its own default.
+	Timeout pinamicdns.Duration `json:"timeout"`
+	// Retries is how many more times each of the sources is asked for the address, unless it gives its own, when it
+	// fails for a transient reason such as a timeout.
+	Retries int `json:"retries"`
+}
+
+// IPSourceConfig represents the config of one of the sources that the current IP address may be found with.
+type IPSourceConfig struct {
+	// URL is the URL of a service that responds with the address that its requests come from.
+	URL string `json:"url"`
+	// Format is the format of the service's response: either plain, for just the address, or json. If not given, the
+	// response is expected to be plain.
+	Format string `json:"format"`
+	// JSONField is the field of a json response that holds the address. Fields of nested objects are separated by
+	// dots. If not given, the address is read from the ip field.
+	JSONField string `json:"json_field"`
+	// Interface is the name of a network interface of this machine to read the address from, rather than asking a
+	// service.
+	Interface string `json:"interface"`
+	// NATPMPGateway is the address of a router to ask for its external address with NAT-PMP.
+	NATPMPGateway string `json:"nat_pmp_gateway"`
+	// DNS is the name of a DNS resolver to ask for the address that queries come from: either opendns or cloudflare.
+	DNS string `json:"dns"`
+	// FritzBox is the host name or address of a FRITZ!Box router to ask for its external address.
+	FritzBox string `json:"fritzbox"`
+	// OpenWrt is the config of an OpenWrt router to read the address of its WAN interface from.
+	OpenWrt *OpenWrtSourceConfig `json:"openwrt"`
+	// Tailscale reads this machine's address on its tailnet from the local tailscaled.
+	Tailscale bool `json:"tailscale"`
+	// TailscaleSocket is the path of the socket that tailscaled serves its local API on, if not the usual one.
+	TailscaleSocket string `json:"tailscale_socket"`
+	// CloudMetadata is the cloud provider whose instance metadata service to read this machine's public address from:
+	// either digitalocean, ec2, or gce.
+	CloudMetadata string `json:"cloud_metadata"`
+	// Kubernetes is the config of a node or Service to read the address of from the Kubernetes API.
+	Kubernetes *KubernetesSourceConfig `json:"kubernetes"`
+	// Command is a command to run that writes the address to stdout. Only one of URL, Interface, NATPMPGateway, DNS,
+	// FritzBox, OpenWrt, Tailscale, CloudMetadata, Kubernetes, or Command may be given.
+	Command string `json:"command"`
+	// Args are the arguments given to the command.
+	Args []string `json:"args"`
+	// Timeout is how long the source may take to find the address, such as how long the command may run before it is
+	// killed.
+	Timeout pinamicdns.Duration `json:"timeout"`
+	// Retries is how many more times the source is asked for the address when it fails for a transient reason.
+	Retries int `json:"retries"`
+}
+
+// VerifyConfig represents the config of how records are confirmed to have taken effect after they are set.
+type VerifyConfig struct {
+	// Attempts is the number of times a record will be written before giving up on the provider reporting it.
+	Attempts int `json:"attempts"`
+	// Resolve requires that the provider's nameservers serve the new value as well.
+	Resolve bool `json:"resolve"`
+	// ResolveTimeout is how long to wait for the provider's nameservers to serve the new value.
+	ResolveTimeout pinamicdns.Duration `json:"resolve_timeout"`
+}
+
+// duplicateRecordPolicies maps the possible values of DNSConfig.DuplicateRecords to the policies they represent.
+var duplicateRecordPolicies = map[string]pinamicdns.DuplicateRecordPolicy{
+	"":             pinamicdns.UpdateFirstDuplicate,
+	"update_first": pinamicdns.UpdateFirstDuplicate,
+	"update_all":   pinamicdns.UpdateAllDuplicates,
+	"consolidate":  pinamicdns.ConsolidateDuplicates,
+}
+
+// providerConfig gets the provider_config of the config. Configs written before other providers were supported give
+// the access token at the top level, so it is included in the provider_config, unless the provider_config already
+// gives one.
+func (config Config) providerConfig() (json.RawMessage, error) {
+	if config.AccessToken == "" {
+		return config.ProviderConfig, nil
+	}
+
+	var providerConfig map[string]json.RawMessage
+	if len(config.ProviderConfig) > 0 {
+		err := json.Unmarshal(config.ProviderConfig, &providerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode provider_config: %s", err)
+		}
+	}
+
+	if providerConfig == nil {
+		providerConfig = map[string]json.RawMessage{}
+	}
+
+	if _, ok := providerConfig["access_token"]; !ok {
+		rawAccessToken, err := json.Marshal(config.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode access_token: %s", err)
+		}
+
+		providerConfig["access_token"] = rawAccessToken
+	}
+
+	return json.Marshal(providerConfig)
+}
+
+// providerNames gets the name of each provider that the config sets records with, as given by provider or in
+// providers.
+func (config Config) providerNames() []string {
+	if len(config.Providers) == 0 {
+		return []string{config.provider()}
+	}
+
+	names := make([]string, 0, len(config.Providers))
+	for _, entry := range config.Providers {
+		names = append(names, entry.Provider)
+	}
+
+	return names
+}
+
+// providerEntries gets all of the providers that the config specifies records should be set with. A config that
+// specifies only a single provider with provider and provider_config has a single entry.
+func (config Config) providerEntries() ([]ProviderEntry, error) {
+	if len(config.Providers) == 0 {
+		providerConfig, err := config.providerConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := ProviderEntry{
+			Name:           config.provider(),
+			Provider:       config.provider(),
+			ProviderConfig: providerConfig,
+		}
+
+		return []ProviderEntry{entry}, nil
+	}
+
+	entries := make([]ProviderEntry, 0, len(config.Providers))
+	for _, entry := range config.Providers {
+		if entry.Name == "" {
+			entry.Name = entry.Provider
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// entryRecords gets all of the records that the given entry's provider should set: those of its own, or else those in
+// the DNSConfig, along with any in the DNSConfig that name it as their provider.
+func (config Config) entryRecords(entry ProviderEntry) []RecordConfig {
+	records := entry.records()
+	if len(records) == 0 {
+		records = config.DNSConfig.records()
+	}
+
+	for _, record := range config.DNSConfig.Records {
+		if record.Provider != "" && record.Provider == entry.Name {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+// usesDNSConfigRecord checks whether or not any provider sets the record in the DNSConfig, rather than records of its
+// own.
+func (config Config) usesDNSConfigRecord() bool {
+	if len(config.Providers) == 0 {
+		return true
+	}
+
+	for _, entry := range config.Providers {
+		if len(entry.records()) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// records gets all of the records that the entry specifies should be set with its provider. If there are none, the
+// record in the DNSConfig should be.
+func (entry ProviderEntry) records() []RecordConfig {
+	records := make([]RecordConfig, 0, len(entry.Records)+1)
+	if entry.Record != nil {
+		records = append(records, *entry.Record)
+	}
+
+	return append(records, entry.Records...)
+}
+
+// provider gets the name of the provider specified by the config.
+func (config Config) provider() string {
+	if config.Provider == "" {
+		return providerDigitalOcean
+	}
+
+	return config.Provider
+}
+
+// names gets each of the subdomain names specified by the config.
+func (config DNSConfig) names() []string {
+	if len(config.Names) > 0 {
+		return config.Names
+	} else if config.Name == "" {
+		return nil
+	}
+
+	return []string{config.Name}
 }
 
-// NewConfig reads the file located at filepath and returns a new Config
+// records gets each of the records specified by the config, across all of its domains, that are set with every provider
+// that doesn't have records of its own.
+func (config DNSConfig) records() []RecordConfig {
+	records := []RecordConfig{}
+	for _, name := range config.names() {
+		records = append(records, RecordConfig{Domain: config.Domain, Name: name})
+	}
+
+	for _, domainConfig := range config.Domains {
+		for _, name := range domainConfig.Names {
+			records = append(records, RecordConfig{Domain: domainConfig.Domain, Name: name, TTL: domainConfig.TTL})
+		}
+	}
+
+	for _, record := range config.Records {
+		if record.Provider == "" {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
+
+// hasTopLevelRecords checks whether or not the config specifies records with its own domain, rather than only those in
+// its list of domains.
+func (config DNSConfig) hasTopLevelRecords() bool {
+	return (len(config.Domains) == 0 && len(config.Records) == 0) || config.Domain != "" || len(config.names()) > 0
+}
+
+// validate returns an error if the record is invalid. Errors name it by the given JSON path.
+func (config RecordConfig) validate(path string) error {
+	if config.Domain == "" || config.Name == "" {
+		return fmt.Errorf("%s must specify both domain and name", path)
+	} else if !validDomain(config.Domain) {
+		return fmt.Errorf("%s.domain %q is not a valid domain name", path, config.Domain)
+	} else if !validRecordName(config.Name) {
+		return fmt.Errorf("%s.name %q is not a valid record name", path, config.Name)
+	} else if config.Type != "" && config.Type != "A" && config.Type != "AAAA" {
+		return fmt.Errorf("%s.type must be A or AAAA", path)
+	}
+
+	return validateTTL(path+".ttl", config.TTL)
+}
+
+// KubernetesSourceConfig represents the config of a node or LoadBalancer Service that the current IP address may be
+// read from with the Kubernetes API, using the credentials of the pod that pinamic-dns runs in.
+type KubernetesSourceConfig struct {
+	// Node is the name of the node to read the address of. If neither it nor Service is given, the node named by the
+	// NODE_NAME environment variable is used, which can be set to the pod's own node with the downward API.
+	Node string `json:"node"`
+	// AddressType is the type of the node's address to read, such as InternalIP. If not given, its ExternalIP is read.
+	AddressType string `json:"address_type"`
+	// Service is the name of a LoadBalancer Service to read the address of, rather than a node's.
+	Service string `json:"service"`
+	// Namespace is the namespace of the Service. If not given, the pod's own namespace is used.
+	Namespace string `json:"namespace"`
+	// APIURL is the URL of the Kubernetes API, if it should not be found from the pod's environment.
+	APIURL string `json:"api_url"`
+}
+
+// kinds counts how many kinds of source the IPSourceConfig specifies, of which there must only be one.
+func (config IPSourceConfig) kinds() int {
+	kinds := 0
+	fields := []string{
+		config.URL, config.Interface, config.NATPMPGateway, config.DNS, config.FritzBox, config.CloudMetadata,
+		config.Command,
+	}
+
+	for _, field := range fields {
+		if field != "" {
+			kinds++
+		}
+	}
+
+	if config.OpenWrt != nil {
+		kinds++
+	}
+
+	if config.Tailscale {
+		kinds++
+	}
+
+	if config.Kubernetes != nil {
+		kinds++
+	}
+
+	return kinds
+}
+
+// duplicateRecordPolicy gets the policy that the DNSConfig specifies for handling duplicate records.
+func (config DNSConfig) duplicateRecordPolicy() pinamicdns.DuplicateRecordPolicy {
+	return duplicateRecordPolicies[config.DuplicateRecords]
+}
+
+// convergenceCheck gets the ConvergenceCheck that the DNSConfig specifies, if any.
+func (config DNSConfig) convergenceCheck() pinamicdns.ConvergenceCheck {
+	if config.VerifyUpdates == nil {
+		return pinamicdns.ConvergenceCheck{}
+	}
+
+	resolveTimeout := time.Duration(config.VerifyUpdates.ResolveTimeout)
+	if resolveTimeout == 0 {
+		resolveTimeout = defaultResolveTimeout
+	}
+
+	attempts := config.VerifyUpdates.Attempts
+	if attempts == 0 {
+		attempts = defaultVerifyAttempts
+	}
+
+	return pinamicdns.ConvergenceCheck{
+		MaxAttempts:    attempts,
+		Resolve:        config.VerifyUpdates.Resolve,
+		ResolveTimeout: resolveTimeout,
+	}
+}
+
+// HTTPConfig represents the config of all outbound HTTP clients.
+type HTTPConfig struct {
+	ConnectTimeout pinamicdns.Duration `json:"connect_timeout"`
+	RequestTimeout pinamicdns.Duration `json:"request_timeout"`
+	Proxy          ProxyConfig         `json:"proxy"`
+}
+
+// ProxyConfig represents the proxies that outbound HTTP requests are made through.
+// Proxies not specified here fall back to the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.
+type ProxyConfig struct {
+	// Provider is the URL of the proxy used to talk to the provider's API.
+	Provider string `json:"provider"`
+	// IPCheck is the URL of the proxy used to check the current IP.
+	IPCheck string `json:"ip_check"`
+}
+
+// proxySchemes are the URL schemes that may be used for proxies.
+var proxySchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"socks5":  true,
+	"socks5h": true,
+}
+
+// IPValidationConfig represents the config of the checks performed on a detected IP before it is published.
+type IPValidationConfig struct {
+	// AllowPrivate allows IPs in private and otherwise non-public ranges to be published.
+	AllowPrivate bool `json:"allow_private"`
+	// AllowedPrefixes, if given, restricts published IPs to those within one of the given CIDR prefixes.
+	AllowedPrefixes []string `json:"allowed_prefixes"`
+	// StableChecks, if given, is the number of consecutive checks a new IP must be detected on before it is published.
+	StableChecks int `json:"stable_checks"`
+}
+
+// CircuitBreakerConfig represents the config of how updates are paused when the provider continuously fails.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed runs after which updates will be paused.
+	FailureThreshold int `json:"failure_threshold"`
+	// Cooldown is how long updates will be paused for.
+	Cooldown pinamicdns.Duration `json:"cooldown"`
+}
+
+// RetryConfig represents the config of how calls to providers are retried when they fail for transient reasons, such
+// as server errors or timeouts. Any setting that is not given is taken from pinamicdns.DefaultRetryPolicy.
+type RetryConfig struct {
+	// Attempts is the number of times each call is made before giving up.
+	Attempts int `json:"attempts"`
+	// Backoff is how long to wait after the first failed attempt. It doubles for each attempt after, up to MaxBackoff.
+	Backoff    pinamicdns.Duration `json:"backoff"`
+	MaxBackoff pinamicdns.Duration `json:"max_backoff"`
+	// MaxElapsed, if given, is the longest that each call may be retried for, across all of its attempts.
+	MaxElapsed pinamicdns.Duration `json:"max_elapsed"`
+}
+
+// NewConfig reads the file located at filepath, along with any fragments in the conf.d directory beside it, and returns
+// a new Config
 func NewConfig(filepath string) (Config, error) {
-	configReader, err := os.Open(filepath)
+	envFields, haveEnvFields, err := environmentConfig(os.Environ())
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config in environment: %w", err)
+	}
+
+	fragments, err := readConfigFragments(configFragmentDir(filepath))
 	if err != nil {
 		return Config{}, err
 	}
 
-	defer configReader.Close()
+	rawConfig, err := ioutil.ReadFile(filepath)
+	// The environment or the fragments may give the entire config, such as in a container, in which case there need not
+	// be a file.
+	if err != nil && !(os.IsNotExist(err) && (haveEnvFields || len(fragments) > 0)) {
+		return Config{}, err
+	} else if err == nil {
+		rawConfig, err = decryptConfig(filepath, rawConfig)
+		if err != nil {
+			return Config{}, err
+		}
+
+		rawConfig, err = expandConfigVariables(rawConfig)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if len(fragments) > 0 {
+		rawConfig, err = mergeConfigWithFragments(rawConfig, fragments)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if haveEnvFields {
+		rawConfig, err = mergeConfigWithFields(rawConfig, envFields)
+		if err != nil {
+			return Config{}, err
+		}
+	}
 
-	configDecoder := json.NewDecoder(configReader)
 	var config Config
-	err = configDecoder.Decode(&config)
+	err = decodeConfig(rawConfig, &config)
 	if err != nil {
 		return Config{}, err
 	}
 
+	err = config.loadAccessTokens()
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.applyDefaults()
+
 	return config, config.validate()
 }
 
+// mergeConfigWithFields gets the JSON of the given config, which may be empty, after merging the given JSON fields into
+// it.
+func mergeConfigWithFields(rawConfig []byte, fields map[string]interface{}) ([]byte, error) {
+	configFields := map[string]interface{}{}
+	if len(rawConfig) > 0 {
+		configDecoder := json.NewDecoder(bytes.NewReader(rawConfig))
+		// Numbers must be passed through as they were written, rather than rounded to floats.
+		configDecoder.UseNumber()
+		err := configDecoder.Decode(&configFields)
+		if err != nil {
+			return nil, describeSyntaxError(rawConfig, err)
+		}
+	}
+
+	mergeConfigFields(configFields, fields)
+
+	return json.Marshal(configFields)
+}
+
+// applyDefaults fills in any values that the config may leave out, but that can't be left as their zero values.
+func (config *Config) applyDefaults() {
+	for i := range config.DNSConfig.Records {
+		config.Defaults.apply(&config.DNSConfig.Records[i], true)
+	}
+
+	for _, entry := range config.Providers {
+		if entry.Record != nil {
+			config.Defaults.apply(entry.Record, false)
+		}
+
+		for i := range entry.Records {
+			config.Defaults.apply(&entry.Records[i], false)
+		}
+	}
+
+	if len(config.Providers) == 0 && config.provider() == providerDuckDNS && config.DNSConfig.Domain == "" &&
+		len(config.DNSConfig.Domains) == 0 {
+		config.DNSConfig.Domain = pinamicdns.DuckDNSDomain
+	}
+
+	for i, record := range config.DNSConfig.Records {
+		if len(config.Providers) == 0 && config.provider() == providerDuckDNS && record.Domain == "" {
+			config.DNSConfig.Records[i].Domain = pinamicdns.DuckDNSDomain
+		}
+	}
+
+	for _, entry := range config.Providers {
+		if entry.Provider != providerDuckDNS {
+			continue
+		}
+
+		name := entry.Name
+		if name == "" {
+			name = entry.Provider
+		}
+
+		for i, record := range config.DNSConfig.Records {
+			if record.Provider == name && record.Domain == "" {
+				config.DNSConfig.Records[i].Domain = pinamicdns.DuckDNSDomain
+			}
+		}
+
+		if entry.Record != nil && entry.Record.Domain == "" {
+			entry.Record.Domain = pinamicdns.DuckDNSDomain
+		}
+
+		for i := range entry.Records {
+			if entry.Records[i].Domain == "" {
+				entry.Records[i].Domain = pinamicdns.DuckDNSDomain
+			}
+		}
+	}
+}
+
+// apply gives the given record each of the defaults that it does not give itself. The provider is only given if the
+// record may have one.
+func (defaults RecordDefaultsConfig) apply(record *RecordConfig, withProvider bool) {
+	if record.Domain == "" {
+		record.Domain = defaults.Domain
+	}
+
+	if record.TTL == 0 {
+		record.TTL = defaults.TTL
+	}
+
+	if record.Provider == "" && withProvider {
+		record.Provider = defaults.Provider
+	}
+}
+
 // validate returns an error if the config is invalid.
 func (config Config) validate() error {
-	if config.AccessToken == "" {
-		return errors.New("access token must be specified in config")
-	} else if config.DNSConfig.Domain == "" {
-		return errors.New("domain must be specified in config")
-	} else if config.DNSConfig.Name == "" {
-		return errors.New("name must be specified in config")
-	} else if config.DNSConfig.TTL == 0 {
-		return errors.New("ttl must be specified in config")
+	if len(config.Providers) > 0 && (config.Provider != "" || len(config.ProviderConfig) > 0 || config.AccessToken != "") {
+		return errors.New("provider, provider_config, and access_token must be given in each of providers instead")
+	} else if !isKnownProvider(config.provider()) && len(config.Providers) == 0 {
+		return fmt.Errorf("provider must be one of %s", strings.Join(pinamicdns.Providers(), ", "))
+	} else if config.DNSConfig.Domain == "" && config.DNSConfig.hasTopLevelRecords() && config.usesDNSConfigRecord() {
+		return errors.New("dns_config.domain must be specified")
+	} else if len(config.DNSConfig.names()) == 0 && config.DNSConfig.hasTopLevelRecords() && config.usesDNSConfigRecord() {
+		return errors.New("dns_config.name or dns_config.names must be specified")
+	} else if config.DNSConfig.Name != "" && len(config.DNSConfig.Names) > 0 {
+		return errors.New("only one of dns_config.name and dns_config.names may be specified")
+	} else if config.Failover != nil && len(config.DNSConfig.records()) > 1 {
+		return errors.New("only a single name may be specified in dns_config when using failover")
+	} else if _, ok := duplicateRecordPolicies[config.DNSConfig.DuplicateRecords]; !ok {
+		return errors.New("dns_config.duplicate_records must be one of update_first, update_all, or consolidate")
+	} else if config.HTTPConfig.ConnectTimeout < 0 || config.HTTPConfig.RequestTimeout < 0 {
+		return errors.New("http_config.connect_timeout and http_config.request_timeout must not be negative")
+	} else if config.DNSConfig.VerifyUpdates != nil && config.DNSConfig.VerifyUpdates.Attempts < 0 {
+		return errors.New("dns_config.verify_updates.attempts must not be negative")
+	} else if config.IPValidation.StableChecks < 0 {
+		return errors.New("ip_validation.stable_checks must not be negative")
+	} else if config.CircuitBreaker.FailureThreshold < 0 || config.CircuitBreaker.Cooldown < 0 {
+		return errors.New("circuit_breaker.failure_threshold and circuit_breaker.cooldown must not be negative")
+	} else if config.DNSConfig.MinUpdateInterval < 0 {
+		return errors.New("dns_config.min_update_interval must not be negative")
+	} else if config.DNSConfig.Concurrency < 0 || config.DNSConfig.RequestInterval < 0 {
+		return errors.New("dns_config.concurrency and dns_config.request_interval must not be negative")
+	} else if config.IPDetection.RecheckInterval < 0 || config.Daemon.Interval < 0 || config.Daemon.Jitter < 0 {
+		return errors.New("ip_detection.recheck_interval, daemon.interval, and daemon.jitter must not be negative")
+	} else if _, _, err := net.SplitHostPort(config.Daemon.HealthAddress); config.Daemon.HealthAddress != "" && err != nil {
+		return fmt.Errorf("daemon.health_address is invalid: %w", err)
+	} else if _, _, err := net.SplitHostPort(config.Daemon.APIAddress); config.Daemon.APIAddress != "" && err != nil {
+		return fmt.Errorf("daemon.api_address is invalid: %w", err)
+	} else if config.Daemon.APIAddress != "" && config.Daemon.APIToken == "" {
+		return errors.New("daemon.api_token must be given along with daemon.api_address")
+	} else if config.Retry.Attempts < 0 || config.Retry.Backoff < 0 || config.Retry.MaxBackoff < 0 || config.Retry.MaxElapsed < 0 {
+		return errors.New("retry.attempts, retry.backoff, retry.max_backoff, and retry.max_elapsed must not be negative")
+	} else if config.Failover != nil && len(config.Providers) == 0 {
+		return errors.New("failover requires providers to be given")
+	} else if config.Failover != nil && (config.Failover.Attempts < 0 || config.Failover.Backoff < 0) {
+		return errors.New("failover.attempts and failover.backoff must not be negative")
+	}
+
+	err := validateProviderEntries(config.Providers, config.Failover != nil)
+	if err != nil {
+		return err
+	}
+
+	err = config.validateRecords()
+	if err != nil {
+		return err
+	}
+
+	for _, proxyURL := range []string{config.HTTPConfig.Proxy.Provider, config.HTTPConfig.Proxy.IPCheck} {
+		err := validateProxyURL(proxyURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = config.IPDetection.validate("ip_detection")
+	if err != nil {
+		return err
+	}
+
+	if config.IPDetection.IPv6 != nil {
+		err = config.IPDetection.IPv6.validate("ip_detection.ipv6")
+		if err != nil {
+			return err
+		}
+
+		for i, source := range config.IPDetection.IPv6.Sources {
+			if source.NATPMPGateway != "" {
+				return fmt.Errorf("ip_detection.ipv6.sources[%d].nat_pmp_gateway may not be given for IPv6", i)
+			} else if source.CloudMetadata == string(pinamicdns.GCECloud) {
+				return fmt.Errorf("ip_detection.ipv6.sources[%d].cloud_metadata may not be %s for IPv6", i, pinamicdns.GCECloud)
+			}
+		}
+	}
+
+	staticIP := net.ParseIP(config.IPDetection.StaticIP)
+	publishesIPv6 := config.IPDetection.IPv6 != nil || (staticIP != nil && staticIP.To4() == nil)
+	for _, provider := range config.providerNames() {
+		if provider == providerNamecheap && publishesIPv6 {
+			return errors.New("namecheap can only set A records, so ip_detection may not give an IPv6 address")
+		}
+	}
+
+	for i, prefix := range config.IPValidation.AllowedPrefixes {
+		_, _, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("ip_validation.allowed_prefixes[%d] %q is invalid: %s", i, prefix, err)
+		}
+	}
+
+	if config.DyndnsServer != nil {
+		_, _, err := net.SplitHostPort(config.DyndnsServer.Address)
+		if err != nil {
+			return fmt.Errorf("dyndns_server.address is invalid: %w", err)
+		} else if config.DyndnsServer.Username == "" || config.DyndnsServer.Password == "" {
+			return errors.New("dyndns_server.username and dyndns_server.password must be specified")
+		} else if config.DyndnsServer.MaxClientRequests < 0 || config.DyndnsServer.MinHostnameInterval < 0 {
+			return errors.New(
+				"dyndns_server.max_client_requests and dyndns_server.min_hostname_interval must not be negative",
+			)
+		}
+	}
+
+	return nil
+}
+
+// options gets the options for a pinamicdns.FailoverSetter that the config specifies.
+func (config FailoverConfig) options() []func(*pinamicdns.FailoverSetter) {
+	retryPolicy := pinamicdns.RetryPolicy{
+		MaxAttempts:    config.Attempts,
+		InitialBackoff: time.Duration(config.Backoff),
+		MaxBackoff:     maxFailoverBackoff,
+	}
+
+	if retryPolicy.MaxAttempts == 0 {
+		retryPolicy.MaxAttempts = defaultFailoverAttempts
+	}
+
+	if retryPolicy.InitialBackoff == 0 {
+		retryPolicy.InitialBackoff = defaultFailoverBackoff
+	}
+
+	options := []func(*pinamicdns.FailoverSetter){pinamicdns.FailoverRetryPolicy(retryPolicy)}
+	if config.AbortOnPermanentError {
+		options = append(options, pinamicdns.FailoverAbortOnPermanentError())
+	}
+
+	return options
+}
+
+// retryPolicy gets the pinamicdns.RetryPolicy that the config specifies.
+func (config RetryConfig) retryPolicy() pinamicdns.RetryPolicy {
+	retryPolicy := pinamicdns.DefaultRetryPolicy
+	if config.Attempts != 0 {
+		retryPolicy.MaxAttempts = config.Attempts
+	}
+
+	if config.Backoff != 0 {
+		retryPolicy.InitialBackoff = time.Duration(config.Backoff)
+	}
+
+	if config.MaxBackoff != 0 {
+		retryPolicy.MaxBackoff = time.Duration(config.MaxBackoff)
+	}
+
+	retryPolicy.MaxElapsed = time.Duration(config.MaxElapsed)
+
+	return retryPolicy
+}
+
+// failureThreshold gets the number of consecutive failures the config allows before updates are paused.
+func (config CircuitBreakerConfig) failureThreshold() int {
+	if config.FailureThreshold == 0 {
+		return defaultFailureThreshold
+	}
+
+	return config.FailureThreshold
+}
+
+// cooldown gets how long the config specifies updates should be paused for.
+func (config CircuitBreakerConfig) cooldown() time.Duration {
+	if config.Cooldown == 0 {
+		return defaultCircuitCooldown
+	}
+
+	return time.Duration(config.Cooldown)
+}
+
+// interval gets how long the config specifies to wait between updates.
+func (config DaemonConfig) interval() time.Duration {
+	if config.Interval == 0 {
+		return defaultDaemonInterval
+	}
+
+	return time.Duration(config.Interval)
+}
+
+// withStartupSettings gives a copy of the config with the settings that only take effect when the daemon starts, such
+// as the addresses it serves on, taken from the given config that it was started with.
+func (config DaemonConfig) withStartupSettings(started DaemonConfig) DaemonConfig {
+	config.HealthAddress, config.APIAddress, config.APIToken = started.HealthAddress, started.APIAddress, started.APIToken
+	config.WatchAddresses = started.WatchAddresses
+
+	return config
+}
+
+// providerHTTPConfig converts the HTTPConfig into a pinamicdns.HTTPConfig, for use with the provider's API.
+func (config HTTPConfig) providerHTTPConfig() pinamicdns.HTTPConfig {
+	return config.httpConfig(config.Proxy.Provider)
+}
+
+// ipCheckHTTPConfig converts the HTTPConfig into a pinamicdns.HTTPConfig, for use when checking the current IP.
+func (config HTTPConfig) ipCheckHTTPConfig() pinamicdns.HTTPConfig {
+	return config.httpConfig(config.Proxy.IPCheck)
+}
+
+// httpConfig converts the HTTPConfig into a pinamicdns.HTTPConfig that uses the given proxy, if any.
+func (config HTTPConfig) httpConfig(rawProxyURL string) pinamicdns.HTTPConfig {
+	httpConfig := pinamicdns.HTTPConfig{
+		ConnectTimeout: time.Duration(config.ConnectTimeout),
+		RequestTimeout: time.Duration(config.RequestTimeout),
+	}
+
+	if rawProxyURL != "" {
+		// This has already been validated with the config
+		httpConfig.Proxy, _ = url.Parse(rawProxyURL)
+	}
+
+	return httpConfig
+}
+
+// validateRecords returns an error if any of the records in the DNSConfig are invalid, or if any are given more than
+// once, whichever provider sets them.
+func (config Config) validateRecords() error {
+	dnsConfig := config.DNSConfig
+	if dnsConfig.Domain != "" && !validDomain(dnsConfig.Domain) {
+		return fmt.Errorf("dns_config.domain %q is not a valid domain name", dnsConfig.Domain)
+	} else if dnsConfig.Name != "" && !validRecordName(dnsConfig.Name) {
+		return fmt.Errorf("dns_config.name %q is not a valid record name", dnsConfig.Name)
+	}
+
+	err := validateTTL("dns_config.ttl", dnsConfig.TTL)
+	if err != nil {
+		return err
+	}
+
+	err = validateRecordNames("dns_config.names", dnsConfig.Names)
+	if err != nil {
+		return err
+	}
+
+	for i, domainConfig := range dnsConfig.Domains {
+		path := fmt.Sprintf("dns_config.domains[%d]", i)
+		if domainConfig.Domain == "" {
+			return fmt.Errorf("%s.domain must be specified", path)
+		} else if !validDomain(domainConfig.Domain) {
+			return fmt.Errorf("%s.domain %q is not a valid domain name", path, domainConfig.Domain)
+		} else if len(domainConfig.Names) == 0 {
+			return fmt.Errorf("%s.names must be specified", path)
+		}
+
+		err := validateRecordNames(path+".names", domainConfig.Names)
+		if err != nil {
+			return err
+		}
+
+		err = validateTTL(path+".ttl", domainConfig.TTL)
+		if err != nil {
+			return err
+		}
+	}
+
+	providerNames := map[string]bool{}
+	if len(config.Providers) == 0 {
+		providerNames[config.provider()] = true
+	}
+
+	for _, entry := range config.Providers {
+		name := entry.Name
+		if name == "" {
+			name = entry.Provider
+		}
+
+		providerNames[name] = true
+	}
+
+	// The defaults are checked before the records that they are given to, so that a mistake in them is named as such.
+	defaults := config.Defaults
+	if defaults.Domain != "" && !validDomain(defaults.Domain) {
+		return fmt.Errorf("defaults.domain %q is not a valid domain name", defaults.Domain)
+	} else if defaults.Provider != "" && !providerNames[defaults.Provider] {
+		return fmt.Errorf("defaults.provider %q must be the name of a configured provider", defaults.Provider)
+	} else if defaults.Provider != "" && config.Failover != nil {
+		return errors.New("defaults.provider may not be given when using failover")
+	}
+
+	err = validateTTL("defaults.ttl", defaults.TTL)
+	if err != nil {
+		return err
+	}
+
+	for i, record := range dnsConfig.Records {
+		path := fmt.Sprintf("dns_config.records[%d]", i)
+		err := record.validate(path)
+		if err != nil {
+			return err
+		} else if record.Provider != "" && !providerNames[record.Provider] {
+			return fmt.Errorf("%s.provider %q must be the name of a configured provider", path, record.Provider)
+		} else if record.Provider != "" && config.Failover != nil {
+			return fmt.Errorf("%s.provider may not be given when using failover", path)
+		}
+	}
+
+	seenRecords := map[string]bool{}
+	records := dnsConfig.records()
+	for _, record := range dnsConfig.Records {
+		if record.Provider != "" {
+			records = append(records, record)
+		}
+	}
+
+	for _, record := range records {
+		key := recordKey(record.Domain, record.Name)
+		if seenRecords[key] {
+			return fmt.Errorf("%s is given more than once in dns_config", key)
+		}
+
+		seenRecords[key] = true
 	}
 
 	return nil
 }
 
-// Token returns a new oauth2.token object.
-// Required for config to implement oauth2.TokenSource
-func (config Config) Token() (*oauth2.Token, error) {
-	return &oauth2.Token{
-		AccessToken: config.AccessToken,
-	}, nil
+// validateRecordNames returns an error if any of the given record names, which are at the given JSON path, are invalid.
+func validateRecordNames(path string, names []string) error {
+	for i, name := range names {
+		if name == "" {
+			return fmt.Errorf("%s[%d] must not be empty", path, i)
+		} else if !validRecordName(name) {
+			return fmt.Errorf("%s[%d] %q is not a valid record name", path, i, name)
+		}
+	}
+
+	return nil
+}
+
+// validateTTL returns an error if the given TTL, which is at the given JSON path, can not be given to a record. A TTL
+// of zero is taken to not be given at all.
+func validateTTL(path string, ttl int) error {
+	if ttl < 0 {
+		return fmt.Errorf("%s must not be negative", path)
+	} else if ttl > maxRecordTTL {
+		return fmt.Errorf("%s must not be more than %d", path, maxRecordTTL)
+	}
+
+	return nil
+}
+
+// validDomain checks whether or not the given domain is a well formed domain name, without a trailing dot.
+// Internationalized domains must be given in their punycode form.
+func validDomain(domain string) bool {
+	if len(domain) > maxDomainNameLength {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if !validDomainLabel(label, false) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validRecordName checks whether or not the given subdomain name is one that a record may be given: @ for the domain
+// itself, or a name of one or more labels, the first of which may be a wildcard. Underscores are allowed, as they are
+// in the names of records such as _acme-challenge.
+func validRecordName(name string) bool {
+	if name == "@" {
+		return true
+	} else if len(name) > maxDomainNameLength {
+		return false
+	}
+
+	labels := strings.Split(name, ".")
+	if labels[0] == "*" && len(labels) > 1 {
+		labels = labels[1:]
+	} else if labels[0] == "*" {
+		return true
+	}
+
+	for _, label := range labels {
+		if !validDomainLabel(label, true) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validDomainLabel checks whether or not the given label of a domain name holds only letters, digits, and inner
+// hyphens, as well as underscores if allowed, and is no longer than a label may be.
+func validDomainLabel(label string, allowUnderscores bool) bool {
+	if label == "" || len(label) > maxDomainLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+
+	for _, char := range label {
+		isAlphanumeric := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+		if !isAlphanumeric && char != '-' && !(allowUnderscores && char == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateProviderEntries returns an error if any of the given provider entries are invalid.
+func validateProviderEntries(entries []ProviderEntry, failover bool) error {
+	names := map[string]bool{}
+	for i, entry := range entries {
+		path := fmt.Sprintf("providers[%d]", i)
+		name := entry.Name
+		if name == "" {
+			name = entry.Provider
+		}
+
+		if !isKnownProvider(entry.Provider) {
+			return fmt.Errorf("%s.provider must be one of %s", path, strings.Join(pinamicdns.Providers(), ", "))
+		} else if names[name] {
+			return fmt.Errorf("%s is used by more than one of providers; give each a unique name", name)
+		} else if entry.Record != nil && len(entry.Records) > 0 {
+			return fmt.Errorf("only one of %s.record and %s.records may be given", path, path)
+		} else if failover && len(entry.Records) > 1 {
+			return fmt.Errorf("only a single record may be given in %s.records when using failover", path)
+		} else if entry.RequestInterval < 0 {
+			return fmt.Errorf("%s.request_interval must not be negative", path)
+		}
+
+		recordKeys := map[string]bool{}
+		for j, record := range entry.records() {
+			recordPath := fmt.Sprintf("%s.records[%d]", path, j)
+			if entry.Record != nil {
+				recordPath = path + ".record"
+			}
+
+			key := recordKey(record.Domain, record.Name)
+			err := record.validate(recordPath)
+			if err != nil {
+				return err
+			} else if record.Provider != "" {
+				return fmt.Errorf("%s.provider may only be given for records in dns_config", recordPath)
+			} else if recordKeys[key] {
+				return fmt.Errorf("%s is given more than once in %s.records", key, path)
+			}
+
+			recordKeys[key] = true
+		}
+
+		names[name] = true
+	}
+
+	return nil
+}
+
+// validate checks that the IPSourcesConfig is well formed. Errors name it by the given JSON path.
+func (config IPSourcesConfig) validate(path string) error {
+	if mode := config.Mode; mode != "" && mode != ipDetectionFallback && mode != ipDetectionConsensus {
+		return fmt.Errorf("%s.mode must be one of %s or %s", path, ipDetectionFallback, ipDetectionConsensus)
+	} else if config.Quorum != 0 && config.Mode != ipDetectionConsensus {
+		return fmt.Errorf("%s.quorum may only be given with the consensus mode", path)
+	} else if config.Quorum < 0 || config.Quorum > len(config.Sources) {
+		return fmt.Errorf("%s.quorum must not be more than the number of sources", path)
+	} else if config.StaticIP != "" && net.ParseIP(config.StaticIP) == nil {
+		return fmt.Errorf("%s.static_ip %q is not an IP address", path, config.StaticIP)
+	} else if config.StaticIP != "" && (len(config.Sources) > 0 || config.Mode != "") {
+		return fmt.Errorf("%s.static_ip may not be given with sources or a mode", path)
+	} else if config.StaticIP != "" && (config.Timeout != 0 || config.Retries != 0) {
+		return fmt.Errorf("%s.static_ip may not be given with a timeout or retries", path)
+	} else if config.Timeout < 0 || config.Retries < 0 {
+		return fmt.Errorf("%s.timeout and %s.retries must not be negative", path, path)
+	}
+
+	for i, source := range config.Sources {
+		sourcePath := fmt.Sprintf("%s.sources[%d]", path, i)
+		if source.kinds() != 1 {
+			return fmt.Errorf(
+				"exactly one of url, interface, nat_pmp_gateway, dns, fritzbox, openwrt, tailscale, cloud_metadata, "+
+					"kubernetes, or command must be specified for %s",
+				sourcePath,
+			)
+		} else if source.NATPMPGateway != "" && net.ParseIP(source.NATPMPGateway) == nil {
+			return fmt.Errorf("%s.nat_pmp_gateway %q is not an IP address", sourcePath, source.NATPMPGateway)
+		} else if source.Format != "" && source.Format != ipSourceFormatPlain && source.Format != ipSourceFormatJSON {
+			return fmt.Errorf("%s.format must be one of %s or %s", sourcePath, ipSourceFormatPlain, ipSourceFormatJSON)
+		} else if (source.Format != "" || source.JSONField != "") && source.URL == "" {
+			return fmt.Errorf("%s.format and %s.json_field may only be given with a url", sourcePath, sourcePath)
+		} else if source.JSONField != "" && source.Format != ipSourceFormatJSON {
+			return fmt.Errorf("%s.json_field may only be given with the json format", sourcePath)
+		} else if len(source.Args) > 0 && source.Command == "" {
+			return fmt.Errorf("%s.args may only be given with a command", sourcePath)
+		} else if source.Timeout != 0 && source.Interface != "" {
+			return fmt.Errorf("%s.timeout may not be given with an interface", sourcePath)
+		} else if source.Timeout < 0 || source.Retries < 0 {
+			return fmt.Errorf("%s.timeout and %s.retries must not be negative", sourcePath, sourcePath)
+		} else if source.TailscaleSocket != "" && !source.Tailscale {
+			return fmt.Errorf("%s.tailscale_socket may only be given with tailscale", sourcePath)
+		} else if source.OpenWrt != nil && (source.OpenWrt.URL == "" || source.OpenWrt.Username == "") {
+			return fmt.Errorf("%s.openwrt.url and %s.openwrt.username must be specified", sourcePath, sourcePath)
+		} else if source.Kubernetes != nil && source.Kubernetes.Node != "" && source.Kubernetes.Service != "" {
+			return fmt.Errorf("only one of %s.kubernetes.node and %s.kubernetes.service may be given", sourcePath, sourcePath)
+		} else if source.Kubernetes != nil && source.Kubernetes.Service != "" && source.Kubernetes.AddressType != "" {
+			return fmt.Errorf("%s.kubernetes.address_type may only be given for a node", sourcePath)
+		} else if source.Kubernetes != nil && source.Kubernetes.Service == "" && source.Kubernetes.Namespace != "" {
+			return fmt.Errorf("%s.kubernetes.namespace may only be given for a service", sourcePath)
+		} else if _, ok := dnsIPSources[source.DNS]; source.DNS != "" && !ok {
+			return fmt.Errorf("%s.dns must be one of %s or %s", sourcePath, dnsIPSourceOpenDNS, dnsIPSourceCloudflare)
+		} else if _, ok := cloudProviders[source.CloudMetadata]; source.CloudMetadata != "" && !ok {
+			return fmt.Errorf(
+				"%s.cloud_metadata must be one of %s, %s, or %s",
+				sourcePath,
+				pinamicdns.DigitalOceanCloud,
+				pinamicdns.EC2Cloud,
+				pinamicdns.GCECloud,
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateProxyURL returns an error if the given proxy URL is not one that can be used.
+func validateProxyURL(rawProxyURL string) error {
+	if rawProxyURL == "" {
+		return nil
+	}
+
+	proxyURL, err := url.Parse(rawProxyURL)
+	if err != nil {
+		return fmt.Errorf("proxy %q is invalid: %s", rawProxyURL, err)
+	} else if !proxySchemes[proxyURL.Scheme] {
+		return fmt.Errorf("proxy %q must use one of the http, https, socks5, or socks5h schemes", rawProxyURL)
+	}
+
+	return nil
 }
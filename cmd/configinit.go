@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// defaultInitTTL is the TTL that config init gives the record, which can be changed in the config afterwards.
+const defaultInitTTL = 300
+
+// initialConfig is the config written by config init, which holds only what it asked for.
+type initialConfig struct {
+	Provider    string           `json:"provider"`
+	AccessToken string           `json:"access_token"`
+	DNSConfig   initialDNSConfig `json:"dns_config"`
+}
+
+// initialDNSConfig is the dns_config of an initialConfig.
+type initialDNSConfig struct {
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	TTL    int    `json:"ttl"`
+}
+
+// prompter asks the questions of config init and reads their answers.
+type prompter struct {
+	input  *os.File
+	reader *bufio.Reader
+	output io.Writer
+}
+
+// runConfigCommand runs the given subcommand of the config command, which manages the config file at the path given
+// in the given options, and the access tokens that it may read from the keyring. The config may be encrypted or
+// decrypted into another file, or migrated from a legacy config.
+func runConfigCommand(args []string, options commandOptions) error {
+	switch {
+	case len(args) == 1 && args[0] == "init":
+		return initConfig(options.configPath, os.Stdin, os.Stdout)
+	case len(args) <= 2 && len(args) > 0 && args[0] == "store-token":
+		// Tokens are stored under the name of the provider they are for, which is the provider itself unless several
+		// are given.
+		providerName := providerDigitalOcean
+		if len(args) == 2 {
+			providerName = args[1]
+		}
+
+		return storeTokenInKeyring(providerName, os.Stdin, os.Stdout)
+	case len(args) == 2 && args[0] == "encrypt":
+		return encryptConfigFile(options.configPath, args[1], os.Stdin, os.Stdout)
+	case len(args) == 2 && args[0] == "decrypt":
+		return decryptConfigFile(options.configPath, args[1], os.Stdin, os.Stdout)
+	case len(args) <= 2 && len(args) > 0 && args[0] == "migrate":
+		outputPath := ""
+		if len(args) == 2 {
+			outputPath = args[1]
+		}
+
+		return migrateConfig(options.configPath, outputPath, options.statePath, os.Stdout)
+	default:
+		return errors.New(
+			"usage: config init | config store-token [provider name] | config encrypt <output> | " +
+				"config decrypt <output> | config migrate [output]",
+		)
+	}
+}
+
+// initConfig asks for the provider, access token, domain, and record name of a new config on the given input, checks
+// that the access token works with the provider, and writes the config to the given path, readable only by the current
+// user. An existing config is never replaced.
+func initConfig(path string, input *os.File, output io.Writer) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; remove it first, or give another path with --config", path)
+	}
+
+	prompt := prompter{input: input, reader: bufio.NewReader(input), output: output}
+	fmt.Fprintf(output, "Providers: %s\n", strings.Join(pinamicdns.Providers(), ", "))
+	provider, err := prompt.ask("Provider", providerDigitalOcean, func(provider string) error {
+		if !isKnownProvider(provider) {
+			return fmt.Errorf("%s is not one of the providers", provider)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := prompt.askSecret("Access token")
+	if err != nil {
+		return err
+	}
+
+	config := initialConfig{Provider: provider, AccessToken: accessToken, DNSConfig: initialDNSConfig{TTL: defaultInitTTL}}
+	setter, err := initialSetter(config)
+	if err != nil {
+		return fmt.Errorf("could not set up provider: %w", err)
+	}
+
+	// The token is checked as soon as possible, so that a wrong one is caught before anything else is asked for.
+	domains, err := listDomains(setter)
+	if err != nil {
+		return fmt.Errorf("could not verify access token: %w", err)
+	} else if domains != nil && len(domains) == 0 {
+		return fmt.Errorf("the access token works, but there are no domains in the %s account to set records in", provider)
+	} else if domains != nil {
+		fmt.Fprintf(output, "The access token works, and can set records in: %s\n", strings.Join(domains, ", "))
+	}
+
+	defaultDomain := ""
+	if len(domains) == 1 {
+		defaultDomain = domains[0]
+	}
+
+	config.DNSConfig.Domain, err = prompt.ask("Domain", defaultDomain, func(domain string) error {
+		if !validDomain(domain) {
+			return fmt.Errorf("%q is not a valid domain name", domain)
+		} else if domains != nil && !containsString(domains, domain) {
+			return fmt.Errorf("%s is not one of the domains that the access token can set records in", domain)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if domains == nil {
+		err = verifyAccess(setter, provider, config.DNSConfig.Domain, output)
+		if err != nil {
+			return fmt.Errorf("could not verify access token: %w", err)
+		}
+	}
+
+	config.DNSConfig.Name, err = prompt.ask("Record name (@ for the domain itself)", "", func(name string) error {
+		if !validRecordName(name) {
+			return fmt.Errorf("%q is not a valid record name", name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeInitialConfig(path, config)
+	if err != nil {
+		return fmt.Errorf("could not write config: %w", err)
+	}
+
+	record := recordKey(config.DNSConfig.Domain, config.DNSConfig.Name)
+	fmt.Fprintf(output, "Wrote config to %s; run pinamic-dns to set %s\n", path, record)
+
+	return nil
+}
+
+// ask asks the given question, until it is given an answer that the given function accepts. If no answer is given, the
+// given default is used, if there is one.
+func (prompt prompter) ask(question string, defaultAnswer string, validate func(string) error) (string, error) {
+	for {
+		if defaultAnswer != "" {
+			fmt.Fprintf(prompt.output, "%s [%s]: ", question, defaultAnswer)
+		} else {
+			fmt.Fprintf(prompt.output, "%s: ", question)
+		}
+
+		answer, err := prompt.readAnswer()
+		if err != nil {
+			return "", err
+		} else if answer == "" && defaultAnswer != "" {
+			answer = defaultAnswer
+		} else if answer == "" {
+			continue
+		}
+
+		err = validate(answer)
+		if err == nil {
+			return answer, nil
+		}
+
+		fmt.Fprintln(prompt.output, err)
+	}
+}
+
+// askSecret asks the given question, without showing the answer as it is typed, until one is given.
+func (prompt prompter) askSecret(question string) (string, error) {
+	for {
+		fmt.Fprintf(prompt.output, "%s (not shown): ", question)
+		answer, err := readWithoutEcho(prompt.input, prompt.readAnswer)
+		if err != nil || answer != "" {
+			return answer, err
+		}
+	}
+}
+
+// readAnswer reads a single line of input, without any surrounding whitespace.
+func (prompt prompter) readAnswer() (string, error) {
+	line, err := prompt.reader.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", errors.New("input ended before every question was answered")
+	} else if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// initialSetter makes the setter for the provider of the given config, as it will be made once the config is read.
+func initialSetter(config initialConfig) (pinamicdns.IPSetter, error) {
+	providerConfig, err := Config{Provider: config.Provider, AccessToken: config.AccessToken}.providerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	options := pinamicdns.SetterOptions{RecordTTL: defaultInitTTL}
+
+	return pinamicdns.NewSetterFromConfig(config.Provider, providerConfig, options)
+}
+
+// listDomains lists the domains that the given setter can set records in, which confirms that its credentials work.
+// If it can't list domains, they are nil.
+func listDomains(setter pinamicdns.IPSetter) ([]string, error) {
+	lister, ok := setter.(pinamicdns.DomainLister)
+	if !ok {
+		return nil, nil
+	}
+
+	domains, err := lister.Domains()
+	if err != nil {
+		return nil, err
+	} else if domains == nil {
+		domains = []string{}
+	}
+
+	return domains, nil
+}
+
+// verifyAccess confirms that the given setter of the given provider can set records in the given domain, if it is
+// able to check, writing the outcome to the given writer.
+func verifyAccess(setter pinamicdns.IPSetter, provider string, domain string, output io.Writer) error {
+	if _, ok := setter.(pinamicdns.AccessChecker); !ok {
+		fmt.Fprintf(output, "%s can't check the access token until records are set, which the first run will do\n", provider)
+		return nil
+	}
+
+	err := checkAccess(setter, domain)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "The access token can set records in %s\n", domain)
+
+	return nil
+}
+
+// writeInitialConfig writes the given config to the given path, after checking that it will be read back as a valid
+// config. As it holds the access token, it is only readable by the current user.
+func writeInitialConfig(path string, config initialConfig) error {
+	err := checkInitialConfig(config)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, 0600, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+
+		return encoder.Encode(config)
+	})
+}
+
+// checkInitialConfig checks that the given config is valid, as it would be once it is written and read back.
+func checkInitialConfig(config initialConfig) error {
+	rawConfig, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	var decodedConfig Config
+	err = decodeConfig(rawConfig, &decodedConfig)
+	if err != nil {
+		return err
+	}
+
+	decodedConfig.applyDefaults()
+
+	return decodedConfig.validate()
+}
+
+// containsString checks whether or not the given strings include the given string.
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
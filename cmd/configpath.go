@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// configDirName is the name of the directory that holds the config within each of the directories that it is searched
+// for in.
+const configDirName = "pinamic-dns"
+
+// configFileNames are the names that the config is searched for under in each directory, in order. Encrypted configs
+// are found by content rather than by name, but are usually given one of these names.
+var configFileNames = []string{"config.json", "config.json.age", "config.json.enc"}
+
+// findConfig finds the config when no path is given for it, searching the working directory first, so that the config
+// is found wherever it was before the others were searched, then $XDG_CONFIG_HOME, ~/.config, and the directory for
+// system-wide configs. If none is found, the path that it is searched for at first is given back, at which config init
+// writes one, and which may be missing entirely if the environment gives the config. A directory that only holds
+// fragments of the config, in conf.d, is found as if it held the config too.
+func findConfig() string {
+	for _, dir := range configSearchDirs() {
+		for _, name := range configFileNames {
+			path := filepath.Join(dir, name)
+			info, err := os.Stat(path)
+			if err == nil && !info.IsDir() {
+				return path
+			}
+		}
+
+		path := filepath.Join(dir, configFileNames[0])
+		info, err := os.Stat(configFragmentDir(path))
+		if err == nil && info.IsDir() {
+			return path
+		}
+	}
+
+	return defaultConfigPath
+}
+
+// configSearchDirs gets the directories that findConfig searches for the config in, in order.
+func configSearchDirs() []string {
+	dirs := []string{"."}
+	// Relative paths in $XDG_CONFIG_HOME are to be ignored, as in the XDG Base Directory Specification.
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if filepath.IsAbs(configHome) {
+		dirs = append(dirs, filepath.Join(configHome, configDirName))
+	}
+
+	home, err := os.UserHomeDir()
+	if err == nil && filepath.Join(home, ".config") != filepath.Clean(configHome) {
+		dirs = append(dirs, filepath.Join(home, ".config", configDirName))
+	}
+
+	if runtime.GOOS != "windows" {
+		dirs = append(dirs, filepath.Join("/etc", configDirName))
+	} else if programData := os.Getenv("ProgramData"); programData != "" {
+		dirs = append(dirs, filepath.Join(programData, configDirName))
+	}
+
+	return dirs
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// wakeReason is why waitForNextUpdate stopped waiting.
+type wakeReason int
+
+// Reasons that waitForNextUpdate may stop waiting
+const (
+	wakeForInterval wakeReason = iota
+	wakeForAddressChange
+	wakeForReload
+	wakeForRequest
+	wakeForShutdown
+)
+
+// daemonEvents are the events, other than the interval passing, that wake the daemon to update the records.
+type daemonEvents struct {
+	// addressChanges receives when the addresses of this machine have changed, if they are being watched.
+	addressChanges <-chan struct{}
+	// reloads receives when the config should be loaded again.
+	reloads <-chan os.Signal
+	// updateRequests receives when an update has been asked for through the API.
+	updateRequests <-chan struct{}
+}
+
+// runDaemon updates the records with the given updater every interval, until the given context is done. If run by
+// systemd, it is kept informed of how the updates are going. On SIGHUP, the config is loaded again with the given
+// function, and the records are updated in correspondence with it, without losing the state. It returns whether or not
+// an update was interrupted by the context finishing, in which case the records may be out of date.
+func runDaemon(ctx context.Context, recordUpdater updater, loadConfig func() (Config, error)) bool {
+	config := recordUpdater.config.Daemon
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer signal.Stop(reloads)
+
+	events := daemonEvents{reloads: reloads}
+	if config.WatchAddresses {
+		events.addressChanges = watchAddressChanges(recordUpdater.logger)
+	}
+
+	notifier := newSystemdNotifier(recordUpdater.logger)
+	var health *healthServer
+	if config.HealthAddress != "" {
+		var err error
+		health, err = startHealthServer(config.HealthAddress, recordUpdater.publishedIPs(), recordUpdater.logger)
+		if err != nil {
+			recordUpdater.logger.Fatalf("Could not start health server: %s", err)
+		}
+
+		defer health.close()
+	}
+
+	var api *apiServer
+	if config.APIAddress != "" {
+		var err error
+		records := apiRecords(recordUpdater, runStatus{})
+		api, err = startAPIServer(config.APIAddress, config.APIToken, records, recordUpdater.logger)
+		if err != nil {
+			recordUpdater.logger.Fatalf("Could not start API server: %s", err)
+		}
+
+		defer api.close()
+		events.updateRequests = api.requests()
+	}
+
+	if _, ok := recordUpdater.setter.(pinamicdns.IPRemover); config.RemoveOnExit && !ok {
+		recordUpdater.logger.Fatal("remove_on_exit is set, but the configured provider can not remove records")
+	}
+
+	// This must see any config that has been reloaded since.
+	defer func() {
+		if config.RemoveOnExit {
+			removeRecordsOnExit(recordUpdater)
+		}
+	}()
+
+	interval := config.interval()
+	if config.Jitter > 0 {
+		recordUpdater.logger.Printf("Updating records every %s, plus up to %s", interval, time.Duration(config.Jitter))
+	} else {
+		recordUpdater.logger.Printf("Updating records every %s", interval)
+	}
+
+	// Each machine must choose differently, which the global source won't do unless it's been seeded.
+	jitterRand := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ready := false
+	defer notifier.notify("STOPPING=1")
+	for {
+		status, err := recordUpdater.update(ctx)
+		ok := err == nil
+		if ctx.Err() != nil {
+			return !ok
+		}
+
+		// Pruning and forcing detection only need to happen once, rather than on every update.
+		recordUpdater.prune, recordUpdater.force = false, false
+
+		if ok && !ready {
+			notifier.notify("READY=1")
+			ready = true
+		}
+
+		health.recordUpdate(err, recordUpdater.publishedIPs(), time.Now())
+		api.recordUpdate(apiRecords(recordUpdater, status), time.Now())
+		if config.HealthFile != "" {
+			healthErr := updateHealthFile(config.HealthFile, ok, time.Now())
+			if healthErr != nil {
+				recordUpdater.logger.Printf("Could not update health file: %s", healthErr)
+			}
+		}
+
+		notifier.notify("STATUS=" + daemonStatus(recordUpdater, ok))
+		notifier.notify("WATCHDOG=1")
+
+		wait := interval
+		if config.Jitter > 0 {
+			wait += time.Duration(jitterRand.Int63n(int64(config.Jitter)))
+		}
+
+		// An update that was held back is made as soon as it is allowed to be, rather than at the next interval.
+		if untilAllowed := time.Until(status.heldUntil); !status.heldUntil.IsZero() && untilAllowed < wait {
+			wait = untilAllowed
+		}
+
+		switch waitForNextUpdate(ctx, wait, events, notifier) {
+		case wakeForShutdown:
+			return false
+		case wakeForReload:
+			reloadedUpdater, err := reloadUpdater(recordUpdater, loadConfig)
+			if err != nil {
+				recordUpdater.logger.Printf("Could not reload config; keeping the current one: %s", err)
+				continue
+			}
+
+			recordUpdater = reloadedUpdater
+			reloaded := recordUpdater.config.Daemon
+			config = reloaded.withStartupSettings(config)
+			if config != reloaded {
+				recordUpdater.logger.Printf(
+					"health_address, api_address, api_token, and watch_addresses only change once the daemon is restarted",
+				)
+			}
+
+			interval = config.interval()
+			recordUpdater.logger.Printf("Reloaded config; updating records")
+		case wakeForRequest:
+			recordUpdater.logger.Printf("Update requested through the API; updating records")
+			recordUpdater.force = true
+		case wakeForAddressChange:
+			select {
+			case <-time.After(addressChangeSettleDelay):
+			case <-ctx.Done():
+				return false
+			}
+
+			// Any changes made while settling are covered by this update.
+			select {
+			case <-events.addressChanges:
+			default:
+			}
+
+			recordUpdater.logger.Printf("Network addresses changed; updating records")
+			// The recheck interval can't be trusted once the addresses have changed.
+			recordUpdater.force = true
+		}
+	}
+}
+
+// reloadUpdater makes a copy of the given updater with the config loaded by the given function, and a setter made
+// from it. The state is shared with the given updater, so that nothing that was learned about the records is lost.
+func reloadUpdater(recordUpdater updater, loadConfig func() (Config, error)) (updater, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return updater{}, err
+	}
+
+	setter, err := makeSetter(config, *recordUpdater.state)
+	if err != nil {
+		return updater{}, fmt.Errorf("could not set up provider: %w", err)
+	}
+
+	recordUpdater.config = config
+	recordUpdater.setter = setter
+
+	return recordUpdater, nil
+}
+
+// removeRecordsOnExit removes the records that the given updater sets, as the daemon is exiting. Any failure to do so is
+// logged.
+func removeRecordsOnExit(recordUpdater updater) {
+	recordUpdater.logger.Print("Removing records before exiting")
+	err := removeRecords(recordUpdater.config, recordUpdater.setter, *recordUpdater.state)
+	if err != nil {
+		recordUpdater.logger.Printf("Could not remove records: %s", err)
+		return
+	}
+
+	saveState(*recordUpdater.state, recordUpdater.statePath, recordUpdater.logger)
+	recordUpdater.logger.Print("Removed records")
+}
+
+// waitForNextUpdate waits for the given interval to pass, for one of the given events, or for the given context to
+// finish, and returns which happened. While waiting, systemd's watchdog is kept from firing, as the daemon is still
+// doing what it should.
+func waitForNextUpdate(ctx context.Context, interval time.Duration, events daemonEvents, notifier systemdNotifier) wakeReason {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	var watchdogTicks <-chan time.Time
+	if notifier.watchdogInterval > 0 {
+		// systemd recommends pinging at half of the watchdog's timeout, so that a late ping is not mistaken for a hang.
+		ticker := time.NewTicker(notifier.watchdogInterval / 2)
+		defer ticker.Stop()
+		watchdogTicks = ticker.C
+	}
+
+	for {
+		select {
+		case <-timer.C:
+			return wakeForInterval
+		case <-ctx.Done():
+			return wakeForShutdown
+		case <-events.addressChanges:
+			return wakeForAddressChange
+		case <-events.reloads:
+			return wakeForReload
+		case <-events.updateRequests:
+			return wakeForRequest
+		case <-watchdogTicks:
+			notifier.notify("WATCHDOG=1")
+		}
+	}
+}
+
+// daemonStatus describes the published addresses for systemd's status, along with whether or not the last update
+// succeeded.
+func daemonStatus(recordUpdater updater, ok bool) string {
+	published := "no IP published yet"
+	if ips := recordUpdater.publishedIPs(); len(ips) > 0 {
+		published = "published " + strings.Join(ips, ", ")
+	}
+
+	if !ok {
+		return "Last update failed; " + published
+	}
+
+	return "Up to date; " + published
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// runDeleteCommand removes the records specified by the given config with the given setter, and forgets about them in
+// the given state, so that they will be set again if pinamic-dns is run normally afterwards.
+func runDeleteCommand(args []string, config Config, setter pinamicdns.IPSetter, state State) error {
+	if len(args) != 0 {
+		return errors.New("usage: delete")
+	}
+
+	return removeRecords(config, setter, state)
+}
+
+// removeRecords removes the records specified by the given config with the given setter, and forgets about them in the
+// given state.
+func removeRecords(config Config, setter pinamicdns.IPSetter, state State) error {
+	remover, ok := setter.(pinamicdns.IPRemover)
+	if !ok {
+		return errors.New("the configured provider can not remove records")
+	}
+
+	err := remover.RemoveIP(config.DNSConfig.Domain, config.DNSConfig.Name)
+	if err != nil {
+		return err
+	}
+
+	stateKey, err := configStateKey(config)
+	if err != nil {
+		return err
+	}
+
+	records, err := configRecords(config)
+	if err != nil {
+		return err
+	}
+
+	delete(state.Records, stateKey)
+	for _, record := range records {
+		delete(state.Records, recordKey(record.Domain, record.Name))
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// dryRun detects the current IP addresses and prints the changes that setting the records to them would make to the
+// given writer, without making any of them. Records are looked up with the provider, but nothing is written to it, the
+// state, or the status file. Addresses are always detected, and the records always looked up, as if they had changed.
+func (updater updater) dryRun(ctx context.Context, output io.Writer) error {
+	config, state := updater.config, updater.state
+	ips, err := detectIPs(ctx, config)
+	if len(ips) == 0 {
+		return fmt.Errorf("could not get IP to update with: %w", err)
+	} else if err != nil {
+		updater.logger.Printf("Could not get every IP to update with; planning with those that were found: %s", err)
+	}
+
+	for _, ip := range ips {
+		err := validateIP(ip, config.IPValidation)
+		if err != nil {
+			return fmt.Errorf("an update would refuse to set the records: %w", err)
+		}
+	}
+
+	stateKey, err := configStateKey(config)
+	if err != nil {
+		return fmt.Errorf("could not determine records to update: %w", err)
+	}
+
+	records, err := configRecords(config)
+	if err != nil {
+		return fmt.Errorf("could not determine records to update: %w", err)
+	}
+
+	err = checkAccess(updater.setter, config.DNSConfig.Domain)
+	if err != nil {
+		return fmt.Errorf("could not look up records: %w", err)
+	}
+
+	types := recordTypes(records)
+	changes := []pinamicdns.RecordChange{}
+	var planErr error
+	for _, ip := range ips {
+		if !setsRecordType(types, ipRecordType(ip)) {
+			continue
+		}
+
+		fmt.Fprintf(output, "Detected IP %s\n", updater.describeIP(ip))
+		if state.publishedIP(stateKey, ip) == ip.String() && !updater.prune {
+			fmt.Fprintf(
+				output,
+				"%s was already published, so an update would not look up the records unless --prune is given\n",
+				ip,
+			)
+		}
+
+		// Changes that could be planned are still worth printing, even if others couldn't be.
+		ipChanges, err := pinamicdns.PlanIP(updater.setter, config.DNSConfig.Domain, config.DNSConfig.Name, ip)
+		changes = append(changes, ipChanges...)
+		if err != nil {
+			planErr = err
+		}
+	}
+
+	err = printChanges(output, changes)
+	if err != nil {
+		return err
+	} else if planErr != nil {
+		return fmt.Errorf("could not plan every change: %w", planErr)
+	}
+
+	return nil
+}
+
+// printChanges prints the given planned changes to the given writer, as a table.
+func printChanges(writer io.Writer, changes []pinamicdns.RecordChange) error {
+	if len(changes) == 0 {
+		_, err := fmt.Fprintln(writer, "No records would be changed")
+		return err
+	}
+
+	tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tableWriter, "ACTION\tPROVIDER\tTYPE\tNAME\tOLD VALUE\tOLD TTL\tNEW VALUE\tNEW TTL\n")
+	unplanned := false
+	for _, change := range changes {
+		fmt.Fprintf(
+			tableWriter,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			change.Action,
+			orDash(change.Setter),
+			change.Type,
+			recordKey(change.Domain, change.Name),
+			orDash(change.OldValue),
+			ttlOrDash(change.OldTTL),
+			orDash(change.NewValue),
+			ttlOrDash(change.NewTTL),
+		)
+
+		unplanned = unplanned || change.Action == pinamicdns.ChangeSet
+	}
+
+	err := tableWriter.Flush()
+	if err != nil {
+		return err
+	} else if unplanned {
+		_, err = fmt.Fprintln(writer, "Providers that can't look up their records can only say what they would set")
+	}
+
+	return err
+}
+
+// orDash gets the given value, or a dash if it is empty, so that empty columns of a table still line up.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// ttlOrDash gets the given TTL as a column of a table, which is a dash if there is none.
+func ttlOrDash(ttl int) string {
+	if ttl == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(ttl)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dyndnsServer accepts updates in the dyndns2 protocol that routers speak to "custom" dynamic DNS providers, and
+// publishes the addresses that they give, rather than detecting them.
+type dyndnsServer struct {
+	// ctx finishes once the server is shutting down, so that updates in progress can be given up on.
+	ctx    context.Context
+	config DyndnsServerConfig
+	// stateKey is the key that the state of the records is stored under.
+	stateKey string
+	// hostnames are the names of the records that may be updated. Updating any of them updates all of them.
+	hostnames map[string]bool
+	// mutex is held while updating, as the updater's state may only be touched by one update at a time.
+	mutex         sync.Mutex
+	recordUpdater updater
+	// clientLimiter limits how many requests each client may make, and hostnameLimiter how often each hostname may be
+	// written to the provider, so that a misconfigured router can't get us banned by the provider.
+	clientLimiter   *requestLimiter
+	hostnameLimiter *requestLimiter
+}
+
+// serveDyndns serves dyndns2 updates on the address given in the given updater's config, publishing the addresses
+// they give with the updater, until the given context is done.
+func serveDyndns(ctx context.Context, recordUpdater updater) error {
+	stateKey, err := configStateKey(recordUpdater.config)
+	if err != nil {
+		return err
+	}
+
+	config := *recordUpdater.config.DyndnsServer
+	maxClientRequests := config.MaxClientRequests
+	if maxClientRequests == 0 {
+		maxClientRequests = defaultMaxClientRequests
+	}
+
+	minHostnameInterval := time.Duration(config.MinHostnameInterval)
+	if minHostnameInterval == 0 {
+		minHostnameInterval = defaultMinHostnameInterval
+	}
+
+	dyndns := &dyndnsServer{
+		ctx:             ctx,
+		config:          config,
+		stateKey:        stateKey,
+		hostnames:       map[string]bool{},
+		recordUpdater:   recordUpdater,
+		clientLimiter:   newRequestLimiter(maxClientRequests, clientRequestWindow),
+		hostnameLimiter: newRequestLimiter(1, minHostnameInterval),
+	}
+
+	for _, hostname := range strings.Split(stateKey, ",") {
+		dyndns.hostnames[strings.ToLower(hostname)] = true
+	}
+
+	listener, err := net.Listen("tcp", dyndns.config.Address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nic/update", dyndns.serveUpdate)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	shutdownDone := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		// Any update in progress is given up on, but should still be responded to.
+		server.Shutdown(context.Background())
+		close(shutdownDone)
+	}()
+
+	recordUpdater.logger.Printf("Serving dyndns2 updates on %s", listener.Addr())
+	err = server.Serve(listener)
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	<-shutdownDone
+
+	return nil
+}
+
+// serveUpdate publishes the address given in an update request, responding with one of the dyndns2 return codes for
+// each of the hostnames that the request gives. If no address is given, the one that the request came from is used.
+// Requests that come too often from one client, or that would write a hostname too soon after it was last written,
+// are refused with 911 and a Retry-After header. Addresses that are already published are not written again.
+func (dyndns *dyndnsServer) serveUpdate(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	logger := dyndns.recordUpdater.logger
+	// Clients are limited before they are authenticated, so that they can't guess the password quickly either.
+	if wait, ok := dyndns.clientLimiter.allow(time.Now(), requestClient(req)); !ok {
+		logger.Printf("Refusing dyndns2 update from %s, which has made too many requests", req.RemoteAddr)
+		setRetryAfter(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok || !dyndns.authorized(username, password) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="pinamic-dns"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "badauth")
+		return
+	}
+
+	hostnames := strings.Split(req.FormValue("hostname"), ",")
+	for _, hostname := range hostnames {
+		if hostname == "" {
+			fmt.Fprintln(w, "notfqdn")
+			return
+		} else if !dyndns.hostnames[strings.ToLower(strings.TrimSuffix(hostname, "."))] {
+			fmt.Fprintln(w, "nohost")
+			return
+		}
+	}
+
+	rawIPs := req.FormValue("myip")
+	if rawIPs == "" {
+		rawIPs, _, _ = net.SplitHostPort(req.RemoteAddr)
+	}
+
+	detection, err := staticIPDetection(strings.Split(rawIPs, ","))
+	if err != nil {
+		logger.Printf("Ignoring dyndns2 update from %s: %s", req.RemoteAddr, err)
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	dyndns.mutex.Lock()
+	defer dyndns.mutex.Unlock()
+
+	// Routers often repeat their address whether or not it has changed, which needn't go anywhere near the provider.
+	if dyndns.published(strings.Split(rawIPs, ",")) {
+		for range hostnames {
+			fmt.Fprintf(w, "nochg %s\n", rawIPs)
+		}
+
+		return
+	}
+
+	hostnameKeys := make([]string, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		hostnameKeys = append(hostnameKeys, strings.ToLower(strings.TrimSuffix(hostname, ".")))
+	}
+
+	if wait := dyndns.hostnameLimiter.wait(time.Now(), hostnameKeys...); wait > 0 {
+		logger.Printf("Refusing dyndns2 update from %s, as %s was updated too recently", req.RemoteAddr,
+			strings.Join(hostnames, ","))
+		setRetryAfter(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+		for range hostnames {
+			fmt.Fprintln(w, "911")
+		}
+
+		return
+	}
+
+	// The given addresses must be published, even if others were detected within the recheck interval.
+	recordUpdater := dyndns.recordUpdater
+	recordUpdater.config.IPDetection = detection
+	recordUpdater.force = true
+	status, err := recordUpdater.update(dyndns.ctx)
+	code := "nochg"
+	wrote := false
+	for _, record := range status.records {
+		wrote = wrote || record.Result == recordUpdated || record.Result == recordFailed
+		if record.Result != recordUnchanged {
+			code = "good"
+		}
+	}
+
+	// Only updates that wrote to the provider, or tried to, count against the hostnames.
+	if wrote {
+		dyndns.hostnameLimiter.count(time.Now(), hostnameKeys...)
+	}
+
+	if err != nil {
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	ips := make([]string, 0, len(status.detectedIPs))
+	for _, ip := range status.detectedIPs {
+		ips = append(ips, ip.String())
+	}
+
+	for range hostnames {
+		fmt.Fprintf(w, "%s %s\n", code, strings.Join(ips, ","))
+	}
+}
+
+// published checks whether or not each of the given addresses is the one that was last published for the records.
+func (dyndns *dyndnsServer) published(rawIPs []string) bool {
+	for _, rawIP := range rawIPs {
+		ip := net.ParseIP(rawIP)
+		if ip == nil || dyndns.recordUpdater.state.publishedIP(dyndns.stateKey, ip) != ip.String() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorized checks whether or not the given credentials are those of the server's config.
+func (dyndns *dyndnsServer) authorized(username, password string) bool {
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(dyndns.config.Username)) == 1
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(dyndns.config.Password)) == 1
+
+	return usernameMatches && passwordMatches
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// The environment variables that give the key of an encrypted config, either as the key itself or as the path of a
+// file holding it. They don't begin with configEnvPrefix, as they are not fields of the config.
+const (
+	configKeyEnv     = "PINAMIC_CONFIG_KEY"
+	configKeyFileEnv = "PINAMIC_CONFIG_KEY_FILE"
+)
+
+// The headers that an age-encrypted config begins with, in its binary and armored forms.
+const (
+	ageHeader      = "age-encryption.org/v1\n"
+	ageArmorHeader = armor.Header
+)
+
+// configKey is the key of an encrypted config, as given by the environment.
+type configKey struct {
+	// value is the key itself, if it was given in configKeyEnv.
+	value string
+	// path is the path of the file holding the key, if it was given in configKeyFileEnv.
+	path string
+}
+
+// decryptConfig decrypts the given contents of the config at the given path, if it is encrypted, with the key given by
+// the environment. Configs that are not encrypted are given back as they are.
+func decryptConfig(path string, rawConfig []byte) ([]byte, error) {
+	if !isEncrypted(rawConfig) {
+		return rawConfig, nil
+	}
+
+	key, err := environmentConfigKey()
+	if err != nil {
+		return nil, err
+	} else if !key.given() {
+		return nil, fmt.Errorf(
+			"%s is encrypted; give its key in %s, or the path of a file holding it in %s",
+			path,
+			configKeyEnv,
+			configKeyFileEnv,
+		)
+	}
+
+	return decryptConfigWithKey(path, rawConfig, key)
+}
+
+// decryptConfigWithKey decrypts the given age-encrypted contents of the config at the given path with the given key,
+// which is either a passphrase or age identities.
+func decryptConfigWithKey(path string, rawConfig []byte, key configKey) ([]byte, error) {
+	identities, err := key.identities()
+	if err != nil {
+		return nil, err
+	}
+
+	var encrypted io.Reader = bytes.NewReader(rawConfig)
+	if !bytes.HasPrefix(rawConfig, []byte(ageHeader)) {
+		encrypted = armor.NewReader(bytes.NewReader(bytes.TrimSpace(rawConfig)))
+	}
+
+	decrypted, err := age.Decrypt(encrypted, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s; the key is wrong, or the config has been changed: %w", path, err)
+	}
+
+	plaintext, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s; the config has been changed: %w", path, err)
+	}
+
+	return plaintext, nil
+}
+
+// isEncrypted checks whether or not the given contents of a config are encrypted with age, in either of its forms.
+func isEncrypted(rawConfig []byte) bool {
+	return bytes.HasPrefix(rawConfig, []byte(ageHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(rawConfig), []byte(ageArmorHeader))
+}
+
+// environmentConfigKey gets the key of an encrypted config that the environment gives, if any.
+func environmentConfigKey() (configKey, error) {
+	key := configKey{value: os.Getenv(configKeyEnv), path: os.Getenv(configKeyFileEnv)}
+	if key.value != "" && key.path != "" {
+		return configKey{}, fmt.Errorf("only one of %s and %s may be given", configKeyEnv, configKeyFileEnv)
+	}
+
+	return key, nil
+}
+
+// given checks whether or not a key was given at all.
+func (key configKey) given() bool {
+	return key.value != "" || key.path != ""
+}
+
+// text gets the text of the key, reading it from the key's file if need be. A line ending after the key in the file is
+// not part of it.
+func (key configKey) text() (string, error) {
+	if key.path == "" {
+		return key.value, nil
+	}
+
+	data, err := ioutil.ReadFile(key.path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %w", configKeyFileEnv, err)
+	}
+
+	text := strings.TrimRight(string(data), "\r\n")
+	if text == "" {
+		return "", fmt.Errorf("%s %s is empty", configKeyFileEnv, key.path)
+	}
+
+	return text, nil
+}
+
+// identities gets the age identities that the key gives. A key that is not a list of age identities, such as those
+// written by age-keygen, is a passphrase.
+func (key configKey) identities() ([]age.Identity, error) {
+	text, err := key.text()
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(text))
+	if err == nil {
+		return identities, nil
+	}
+
+	identity, err := age.NewScryptIdentity(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid passphrase: %w", err)
+	}
+
+	return []age.Identity{identity}, nil
+}
+
+// recipients gets the age recipients that a config must be encrypted to for the key to decrypt it. A passphrase is its
+// own recipient, and each identity gives one.
+func (key configKey) recipients() ([]age.Recipient, error) {
+	text, err := key.text()
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(text))
+	if err != nil {
+		recipient, err := age.NewScryptRecipient(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passphrase: %w", err)
+		}
+
+		return []age.Recipient{recipient}, nil
+	}
+
+	recipients := make([]age.Recipient, 0, len(identities))
+	for _, identity := range identities {
+		x25519Identity, ok := identity.(*age.X25519Identity)
+		if !ok {
+			return nil, errors.New("only X25519 age identities can be encrypted to")
+		}
+
+		recipients = append(recipients, x25519Identity.Recipient())
+	}
+
+	return recipients, nil
+}
+
+// encryptWithAge encrypts the given contents of a config to the given age recipients, in age's armored form, so that
+// the config stays text.
+func encryptWithAge(rawConfig []byte, recipients []age.Recipient) ([]byte, error) {
+	encrypted := bytes.Buffer{}
+	armorWriter := armor.NewWriter(&encrypted)
+	ageWriter, err := age.Encrypt(armorWriter, recipients...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ageWriter.Write(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ageWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = armorWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return encrypted.Bytes(), nil
+}
+
+// encryptConfigFile encrypts the config at the given path with age, writing it to the given output path, readable only
+// by the current user. It is encrypted to the key given by the environment, if any, which may be a passphrase or age
+// identities, and is otherwise encrypted with a passphrase that is asked for on the given input.
+func encryptConfigFile(path string, outputPath string, input *os.File, output io.Writer) error {
+	if filepath.Clean(path) == filepath.Clean(outputPath) {
+		return errors.New("the encrypted config must be written to another path than the config")
+	}
+
+	rawConfig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	} else if isEncrypted(rawConfig) {
+		return fmt.Errorf("%s is already encrypted", path)
+	}
+
+	// Mistakes are caught now, as they are harder to find once the config is encrypted.
+	var config Config
+	err = decodeConfig(rawConfig, &config)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid config: %w", path, err)
+	}
+
+	key, err := newConfigKey(input, output)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := key.recipients()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := encryptWithAge(rawConfig, recipients)
+	if err != nil {
+		return fmt.Errorf("could not encrypt config: %w", err)
+	}
+
+	err = writeFileAtomic(outputPath, 0600, func(w io.Writer) error {
+		_, err := w.Write(encrypted)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write encrypted config: %w", err)
+	}
+
+	fmt.Fprintf(output, "Wrote encrypted config to %s; give its key in %s or %s to use it\n",
+		outputPath, configKeyEnv, configKeyFileEnv)
+
+	return nil
+}
+
+// decryptConfigFile decrypts the encrypted config at the given path, writing it to the given output path, readable only
+// by the current user, so that it can be changed. The key is that given by the environment, if any. If it isn't given,
+// a passphrase is asked for on the given input.
+func decryptConfigFile(path string, outputPath string, input *os.File, output io.Writer) error {
+	if filepath.Clean(path) == filepath.Clean(outputPath) {
+		return errors.New("the decrypted config must be written to another path than the config")
+	}
+
+	rawConfig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !isEncrypted(rawConfig) {
+		return fmt.Errorf("%s is not encrypted", path)
+	}
+
+	key, err := environmentConfigKey()
+	if err != nil {
+		return err
+	} else if !key.given() {
+		prompt := prompter{input: input, reader: bufio.NewReader(input), output: output}
+		key.value, err = prompt.askSecret("Passphrase")
+		if err != nil {
+			return err
+		}
+	}
+
+	rawConfig, err = decryptConfigWithKey(path, rawConfig, key)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(outputPath, 0600, func(w io.Writer) error {
+		_, err := w.Write(rawConfig)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not write decrypted config: %w", err)
+	}
+
+	fmt.Fprintf(output, "Wrote decrypted config to %s\n", outputPath)
+
+	return nil
+}
+
+// newConfigKey gets the key to encrypt a config with, which is that given by the environment if any. Otherwise, a
+// passphrase is asked for twice on the given input, so that a typo doesn't leave the config unreadable.
+func newConfigKey(input *os.File, output io.Writer) (configKey, error) {
+	key, err := environmentConfigKey()
+	if err != nil || key.given() {
+		return key, err
+	}
+
+	prompt := prompter{input: input, reader: bufio.NewReader(input), output: output}
+	passphrase, err := prompt.askSecret("Passphrase")
+	if err != nil {
+		return configKey{}, err
+	}
+
+	confirmation, err := prompt.askSecret("Passphrase again")
+	if err != nil {
+		return configKey{}, err
+	} else if confirmation != passphrase {
+		return configKey{}, errors.New("the passphrases do not match")
+	}
+
+	return configKey{value: passphrase}, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// configEnvPrefix begins the name of each environment variable that sets a field of the config.
+const configEnvPrefix = "PINAMIC_DNS_"
+
+// configEnvSeparator separates the names of nested fields in the name of an environment variable, such as in
+// PINAMIC_DNS_DNS_CONFIG__TTL. Field names contain single underscores of their own.
+const configEnvSeparator = "__"
+
+// configEnvAliases are the environment variables that set the most commonly given fields of the config with shorter
+// names, along with the path of JSON names of the fields they set. These are checked before configEnvPrefix, which
+// some of them begin with.
+var configEnvAliases = map[string][]string{
+	"PINAMIC_PROVIDER":     {"provider"},
+	"PINAMIC_ACCESS_TOKEN": {"provider_config", "access_token"},
+	"PINAMIC_DNS_DOMAIN":   {"dns_config", "domain"},
+	"PINAMIC_DNS_NAME":     {"dns_config", "name"},
+	"PINAMIC_TTL":          {"dns_config", "ttl"},
+	"PINAMIC_INTERVAL":     {"daemon", "interval"},
+}
+
+// rawMessageType is the type of fields whose contents are not known until they are decoded by a provider.
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// environmentConfig gets the fields of the config that are set by the given environment, in the form of os.Environ,
+// as a JSON object that can be merged into that of a config file. It returns whether or not any fields were set.
+func environmentConfig(environ []string) (map[string]interface{}, bool, error) {
+	fields := map[string]interface{}{}
+	found := false
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		name := parts[0]
+		path, isAlias := configEnvAliases[name]
+		if len(parts) != 2 || (!isAlias && !strings.HasPrefix(name, configEnvPrefix)) {
+			continue
+		} else if !isAlias {
+			path = strings.Split(strings.ToLower(strings.TrimPrefix(name, configEnvPrefix)), configEnvSeparator)
+		}
+
+		fieldType, err := configFieldType(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", name, err)
+		}
+
+		err = setConfigField(fields, path, envFieldValue(parts[1], fieldType))
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", name, err)
+		}
+
+		found = true
+	}
+
+	return fields, found, nil
+}
+
+// configFieldType gets the type of the config field at the given path of JSON names. If the field is within a provider's
+// config, its type can't be known, and nil is returned.
+func configFieldType(path []string) (reflect.Type, error) {
+	fieldType := reflect.TypeOf(Config{})
+	for _, name := range path {
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		switch {
+		case fieldType == rawMessageType:
+			return nil, nil
+		case fieldType.Kind() == reflect.Map:
+			fieldType = fieldType.Elem()
+		case fieldType.Kind() == reflect.Struct:
+			field, ok := jsonField(fieldType, name)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a config field", name)
+			}
+
+			fieldType = field.Type
+		default:
+			return nil, fmt.Errorf("%s can not be set on its own; give its parent as JSON instead", name)
+		}
+	}
+
+	if fieldType == rawMessageType {
+		return nil, nil
+	}
+
+	return fieldType, nil
+}
+
+// jsonField finds the field of the given struct type that is decoded from the JSON field with the given name, including
+// those of any embedded structs.
+func jsonField(structType reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tagName := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if tagName == name {
+			return field, true
+		} else if field.Anonymous && tagName == "" && field.Type.Kind() == reflect.Struct {
+			embeddedField, ok := jsonField(field.Type, name)
+			if ok {
+				return embeddedField, true
+			}
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// envFieldValue converts the given value of an environment variable into the JSON for a field of the given type, or
+// of an unknown type if nil. Values are used as JSON if the field can be decoded from them, such as numbers or lists,
+// and as strings otherwise. As the fields of a provider's config are mostly strings, only objects, lists, and booleans
+// are used as JSON for fields of an unknown type, so that tokens that look like numbers are kept intact.
+func envFieldValue(value string, fieldType reflect.Type) json.RawMessage {
+	quoted, _ := json.Marshal(value)
+	if fieldType == nil {
+		trimmed := strings.TrimSpace(value)
+		if trimmed != "true" && trimmed != "false" && !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+			return quoted
+		}
+	} else if fieldType.Kind() == reflect.String {
+		return quoted
+	}
+
+	var decoded interface{} = new(interface{})
+	if fieldType != nil {
+		decoded = reflect.New(fieldType).Interface()
+	}
+
+	err := json.Unmarshal([]byte(value), decoded)
+	if err != nil {
+		return quoted
+	}
+
+	return json.RawMessage(value)
+}
+
+// setConfigField sets the field at the given path of JSON names within the given JSON object to the given value,
+// making any objects along the way that don't exist yet.
+func setConfigField(fields map[string]interface{}, path []string, value json.RawMessage) error {
+	for _, name := range path[:len(path)-1] {
+		child, ok := fields[name].(map[string]interface{})
+		if !ok && fields[name] != nil {
+			return errors.New("conflicts with another variable")
+		} else if !ok {
+			child = map[string]interface{}{}
+			fields[name] = child
+		}
+
+		fields = child
+	}
+
+	name := path[len(path)-1]
+	if fields[name] != nil {
+		return errors.New("conflicts with another variable")
+	}
+
+	fields[name] = value
+
+	return nil
+}
+
+// mergeConfigFields merges the given fields into the given JSON object, replacing any fields that are already set,
+// but keeping the others within objects that both set.
+func mergeConfigFields(base map[string]interface{}, fields map[string]interface{}) {
+	for name, value := range fields {
+		childFields, ok := value.(map[string]interface{})
+		if !ok {
+			base[name] = value
+			continue
+		}
+
+		childBase, ok := base[name].(map[string]interface{})
+		if !ok {
+			base[name] = childFields
+			continue
+		}
+
+		mergeConfigFields(childBase, childFields)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// writeFileAtomic writes the file at the given path with the given permissions, using write to produce its contents.
+// The contents are written to a temporary file which is synced and then renamed over the destination, so a crash
+// part way through will never leave a partially written file behind.
+func writeFileAtomic(path string, perm os.FileMode, write func(io.Writer) error) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tempFile, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+
+	// If anything goes wrong, the temporary file should not be left lying around.
+	// Once it is renamed, this will fail harmlessly.
+	defer os.Remove(tempFile.Name())
+
+	err = write(tempFile)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Chmod(perm)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Sync()
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempFile.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir flushes the directory at the given path to disk, so that any renames within it are durable.
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer dirFile.Close()
+
+	err = dirFile.Sync()
+	// Windows does not support syncing directories, so there is nothing more we can do there.
+	if err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// configFragmentDirName is the name of the directory alongside the config that holds fragments of it, each of which is
+// merged into it.
+const configFragmentDirName = "conf.d"
+
+// configFragmentSuffixes are the endings of the names of the files in the fragment directory that are read as
+// fragments. Any other file, such as an editor's backup, is ignored.
+var configFragmentSuffixes = []string{".json", ".json.age", ".json.enc"}
+
+// configFragmentDir gets the path of the directory that holds the fragments of the config at the given path.
+func configFragmentDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), configFragmentDirName)
+}
+
+// readConfigFragments reads the JSON fields of each of the fragments in the given directory, in order of their names.
+// Like the config, each is decrypted and has its environment variables expanded, and each is checked on its own, so that
+// a mistake in one is reported along with its path. If there is no such directory, there are no fragments.
+func readConfigFragments(dir string) ([]map[string]interface{}, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read config fragments: %w", err)
+	}
+
+	fragments := []map[string]interface{}{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !isConfigFragmentName(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		fields, err := readConfigFragment(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		fragments = append(fragments, fields)
+	}
+
+	return fragments, nil
+}
+
+// isConfigFragmentName checks whether or not the given name of a file in the fragment directory is that of a fragment.
+func isConfigFragmentName(name string) bool {
+	for _, suffix := range configFragmentSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readConfigFragment reads the fragment at the given path into its JSON fields.
+func readConfigFragment(path string) (map[string]interface{}, error) {
+	rawFragment, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rawFragment, err = decryptConfig(path, rawFragment)
+	if err != nil {
+		return nil, err
+	}
+
+	rawFragment, err = expandConfigVariables(rawFragment)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(rawFragment))
+	// Numbers must be passed through as they were written, rather than rounded to floats.
+	decoder.UseNumber()
+	err = decoder.Decode(&fields)
+	if err != nil {
+		return nil, describeSyntaxError(rawFragment, err)
+	}
+
+	err = checkConfigJSON(rawFragment, "", reflect.TypeOf(Config{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// mergeConfigWithFragments gets the JSON of the given config, which may be empty, after merging each of the given
+// fragments into it, in order.
+func mergeConfigWithFragments(rawConfig []byte, fragments []map[string]interface{}) ([]byte, error) {
+	configFields := map[string]interface{}{}
+	if len(rawConfig) > 0 {
+		configDecoder := json.NewDecoder(bytes.NewReader(rawConfig))
+		configDecoder.UseNumber()
+		err := configDecoder.Decode(&configFields)
+		if err != nil {
+			return nil, describeSyntaxError(rawConfig, err)
+		}
+	}
+
+	for _, fragment := range fragments {
+		appendConfigFields(configFields, fragment)
+	}
+
+	return json.Marshal(configFields)
+}
+
+// appendConfigFields merges the given fields into the given JSON object, as mergeConfigFields does, except that lists
+// that both set are joined, rather than replaced, so that each fragment can add records or providers of its own.
+func appendConfigFields(base map[string]interface{}, fields map[string]interface{}) {
+	for name, value := range fields {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			childBase, ok := base[name].(map[string]interface{})
+			if !ok {
+				base[name] = value
+				continue
+			}
+
+			appendConfigFields(childBase, value)
+		case []interface{}:
+			baseList, ok := base[name].([]interface{})
+			if !ok {
+				base[name] = value
+				continue
+			}
+
+			base[name] = append(baseList, value...)
+		default:
+			base[name] = value
+		}
+	}
+}
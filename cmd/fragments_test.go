@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAppendConfigFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		fields string
+		want   string
+	}{
+		{
+			name:   "new fields are added",
+			base:   `{"provider": "cloudflare"}`,
+			fields: `{"dns_config": {"ttl": 300}}`,
+			want:   `{"provider": "cloudflare", "dns_config": {"ttl": 300}}`,
+		},
+		{
+			name:   "values replace those of the base",
+			base:   `{"provider": "cloudflare", "dns_config": {"ttl": 60}}`,
+			fields: `{"provider": "linode", "dns_config": {"ttl": 300}}`,
+			want:   `{"provider": "linode", "dns_config": {"ttl": 300}}`,
+		},
+		{
+			name:   "objects are merged",
+			base:   `{"dns_config": {"domain": "example.com", "ttl": 60}}`,
+			fields: `{"dns_config": {"ttl": 300}}`,
+			want:   `{"dns_config": {"domain": "example.com", "ttl": 300}}`,
+		},
+		{
+			name:   "lists are joined",
+			base:   `{"dns_config": {"records": [{"name": "home"}]}}`,
+			fields: `{"dns_config": {"records": [{"name": "vpn"}, {"name": "nas"}]}}`,
+			want:   `{"dns_config": {"records": [{"name": "home"}, {"name": "vpn"}, {"name": "nas"}]}}`,
+		},
+		{
+			name:   "a list replaces a value that is not a list",
+			base:   `{"dns_config": {"names": "home"}}`,
+			fields: `{"dns_config": {"names": ["vpn"]}}`,
+			want:   `{"dns_config": {"names": ["vpn"]}}`,
+		},
+		{
+			name:   "an object replaces a value that is not an object",
+			base:   `{"failover": null}`,
+			fields: `{"failover": {"providers": ["a"]}}`,
+			want:   `{"failover": {"providers": ["a"]}}`,
+		},
+		{
+			name:   "a value replaces an object",
+			base:   `{"failover": {"providers": ["a"]}}`,
+			fields: `{"failover": null}`,
+			want:   `{"failover": null}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := decodeTestFields(t, test.base)
+			appendConfigFields(base, decodeTestFields(t, test.fields))
+			if want := decodeTestFields(t, test.want); !reflect.DeepEqual(base, want) {
+				t.Errorf("got %v, want %v", base, want)
+			}
+		})
+	}
+}
+
+// decodeTestFields decodes the given JSON object into the form that appendConfigFields is given.
+func decodeTestFields(t *testing.T, rawFields string) map[string]interface{} {
+	fields := map[string]interface{}{}
+	err := json.Unmarshal([]byte(rawFields), &fields)
+	if err != nil {
+		t.Fatalf("could not decode %s: %s", rawFields, err)
+	}
+
+	return fields
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ipInfoURL is the URL of the service that addresses are looked up with when GeoIP lookups are enabled.
+const ipInfoURL = "https://ipinfo.io/"
+
+// ipInfoTimeout is how long a GeoIP lookup may take. Lookups only serve to make logs more helpful, so a slow one
+// should not hold up an update for long.
+const ipInfoTimeout = 5 * time.Second
+
+// maxIPInfoResponseSize is the most of a response to a GeoIP lookup that will be read.
+const maxIPInfoResponseSize = 64 * 1024
+
+// ipInfo is what a GeoIP lookup finds out about an address.
+type ipInfo struct {
+	// Org is the ASN and name of the network the address belongs to, such as "AS15169 Google LLC".
+	Org     string `json:"org"`
+	City    string `json:"city"`
+	Region  string `json:"region"`
+	Country string `json:"country"`
+	// Bogon is set if the address is not one that can be routed on the Internet.
+	Bogon bool `json:"bogon"`
+}
+
+// String describes the network and location of the address.
+func (info ipInfo) String() string {
+	if info.Bogon {
+		return "not a routable address"
+	}
+
+	parts := []string{}
+	for _, part := range []string{info.Org, info.City, info.Region, info.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "unknown network"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// lookupIPInfo looks up the network and rough location of the given address with ipinfo.io, in correspondence with the
+// given config. Requests are made in the same manner as checks of the current IP address.
+func lookupIPInfo(ip net.IP, config GeoIPConfig, httpConfig HTTPConfig) (ipInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, ipInfoURL+ip.String()+"/json", nil)
+	if err != nil {
+		return ipInfo{}, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+
+	lookupHTTPConfig := httpConfig.ipCheckHTTPConfig()
+	lookupHTTPConfig.RequestTimeout = ipInfoTimeout
+	res, err := lookupHTTPConfig.Client().Do(req)
+	if err != nil {
+		return ipInfo{}, err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return ipInfo{}, fmt.Errorf("%s returned status %s", ipInfoURL, res.Status)
+	}
+
+	info := ipInfo{}
+	err = json.NewDecoder(io.LimitReader(res.Body, maxIPInfoResponseSize)).Decode(&info)
+	if err != nil {
+		return ipInfo{}, fmt.Errorf("could not decode response from %s: %w", ipInfoURL, err)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// healthServer serves how the daemon's updates are going over HTTP, for uptime monitors and liveness probes. A nil
+// healthServer serves nothing, so that it need not be checked for when no health address is configured.
+type healthServer struct {
+	server *http.Server
+	mutex  sync.Mutex
+	// ips are the addresses that were last published for the records.
+	ips []string
+	// lastUpdate is the time that the last update finished, or the zero time if none has yet.
+	lastUpdate time.Time
+	// lastChange is the time that the published addresses last changed, or the zero time if they haven't since the
+	// daemon started.
+	lastChange time.Time
+	// lastErr is the reason the last update failed, if it did.
+	lastErr error
+}
+
+// healthResponse is the body of a response from /healthz.
+type healthResponse struct {
+	// Status is one of ok, failing, or starting, if no update has finished yet.
+	Status    string `json:"status"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// statusResponse is the body of a response from /status.
+type statusResponse struct {
+	IPs        []string   `json:"ips"`
+	LastUpdate *time.Time `json:"last_update"`
+	LastChange *time.Time `json:"last_change"`
+	LastError  *string    `json:"last_error"`
+}
+
+// startHealthServer starts serving the daemon's health on the given address, which should be local. The given IPs are
+// those that were already published when the daemon started. Any failure to serve once started is logged to the given
+// logger.
+func startHealthServer(address string, ips []string, logger *log.Logger) (*healthServer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &healthServer{ips: ips}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.serveHealth)
+	mux.HandleFunc("/status", health.serveStatus)
+	health.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := health.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			logger.Printf("Health server stopped: %s", err)
+		}
+	}()
+
+	return health, nil
+}
+
+// close stops serving the daemon's health.
+func (health *healthServer) close() {
+	if health == nil {
+		return
+	}
+
+	health.server.Close()
+}
+
+// recordUpdate records that an update finished at the given time, with the given error, if it failed, leaving the
+// given IPs published.
+func (health *healthServer) recordUpdate(err error, ips []string, now time.Time) {
+	if health == nil {
+		return
+	}
+
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+	if !sameStrings(ips, health.ips) {
+		health.lastChange = now
+	}
+
+	health.ips = ips
+	health.lastUpdate = now
+	health.lastErr = err
+}
+
+// serveHealth responds with whether or not the last update succeeded. Anything but a success is served with a 503, so
+// that probes need not read the body.
+func (health *healthServer) serveHealth(w http.ResponseWriter, req *http.Request) {
+	health.mutex.Lock()
+	res := healthResponse{Status: "ok"}
+	statusCode := http.StatusOK
+	if health.lastUpdate.IsZero() {
+		res.Status = "starting"
+		statusCode = http.StatusServiceUnavailable
+	} else if health.lastErr != nil {
+		res.Status = "failing"
+		res.LastError = health.lastErr.Error()
+		statusCode = http.StatusServiceUnavailable
+	}
+	health.mutex.Unlock()
+
+	writeJSON(w, statusCode, res)
+}
+
+// serveStatus responds with the published addresses, and when they were last updated and changed.
+func (health *healthServer) serveStatus(w http.ResponseWriter, req *http.Request) {
+	health.mutex.Lock()
+	res := statusResponse{IPs: health.ips}
+	if !health.lastUpdate.IsZero() {
+		lastUpdate := health.lastUpdate
+		res.LastUpdate = &lastUpdate
+	}
+
+	if !health.lastChange.IsZero() {
+		lastChange := health.lastChange
+		res.LastChange = &lastChange
+	}
+
+	if health.lastErr != nil {
+		lastErr := health.lastErr.Error()
+		res.LastError = &lastErr
+	}
+	health.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// updateHealthFile writes the time of the update that finished at the given time to the health file at the given path, if
+// it succeeded, or removes the file if it failed.
+func updateHealthFile(path string, ok bool, now time.Time) error {
+	if !ok {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return writeFileAtomic(path, 0644, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, now.Format(time.RFC3339))
+		return err
+	})
+}
+
+// writeJSON writes the given value as the JSON body of a response with the given status code.
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	// There's nothing to be done if the client has gone away.
+	json.NewEncoder(w).Encode(value)
+}
+
+// sameStrings checks whether or not the given slices hold the same strings, in the same order.
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// expandConfigVariables expands each reference to an environment variable, in the form ${VAR}, within the string
+// values of the given JSON config, so that secrets can be kept out of the file while its structure is kept in it. A
+// reference to a variable that is not set is an error that names the field it is in. $${ is left as a literal ${.
+func expandConfigVariables(rawConfig []byte) ([]byte, error) {
+	// Configs without any references are given back as they are, so that any error in them is found where it was made.
+	if !bytes.Contains(rawConfig, []byte("${")) {
+		return rawConfig, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawConfig))
+	// Numbers must be passed through as they were written, rather than rounded to floats.
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, describeSyntaxError(rawConfig, err)
+	}
+
+	value, err = expandValueVariables(value, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// expandValueVariables expands the references to environment variables within each string in the given JSON value,
+// which is at the given path of the config.
+func expandValueVariables(value interface{}, path string) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		expanded, err := expandVariables(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %w", describePath(path), err)
+		}
+
+		return expanded, nil
+	case []interface{}:
+		for i, element := range value {
+			expanded, err := expandValueVariables(element, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+
+			value[i] = expanded
+		}
+	case map[string]interface{}:
+		// Fields are expanded in order, so that the same error is given for a config each time it is read.
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			expanded, err := expandValueVariables(value[key], joinPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+
+			value[key] = expanded
+		}
+	}
+
+	return value, nil
+}
+
+// expandVariables expands the references to environment variables in the given string. The error given if any
+// variable is not set is phrased to follow the path of the value that the string is in.
+func expandVariables(value string) (string, error) {
+	expanded := strings.Builder{}
+	for {
+		start := strings.Index(value, "${")
+		if start == -1 {
+			expanded.WriteString(value)
+			return expanded.String(), nil
+		} else if start > 0 && value[start-1] == '$' {
+			expanded.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+
+		length := strings.IndexByte(value[start:], '}')
+		if length == -1 {
+			return "", errors.New("has a ${ that is never closed; write $${ for a literal ${")
+		}
+
+		name := value[start+2 : start+length]
+		if !validVariableName(name) {
+			return "", fmt.Errorf("refers to ${%s}, which is not a valid environment variable name", name)
+		}
+
+		variable, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("refers to ${%s}, which is not set", name)
+		}
+
+		expanded.WriteString(value[:start])
+		expanded.WriteString(variable)
+		value = value[start+length+1:]
+	}
+}
+
+// validVariableName checks whether or not the given name is that of an environment variable that can be referred to,
+// consisting of letters, digits, and underscores, and not beginning with a digit.
+func validVariableName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+
+	for _, char := range name {
+		isLetter := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+		if !isLetter && !(char >= '0' && char <= '9') && char != '_' {
+			return false
+		}
+	}
+
+	return true
+}
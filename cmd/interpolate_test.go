@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	os.Setenv("PINAMIC_TEST_HOST", "home")
+	os.Setenv("PINAMIC_TEST_EMPTY", "")
+	os.Unsetenv("PINAMIC_TEST_UNSET")
+	defer os.Unsetenv("PINAMIC_TEST_HOST")
+	defer os.Unsetenv("PINAMIC_TEST_EMPTY")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{name: "no references", value: "home.example.com", want: "home.example.com"},
+		{name: "a reference", value: "${PINAMIC_TEST_HOST}.example.com", want: "home.example.com"},
+		{name: "several references", value: "${PINAMIC_TEST_HOST}-${PINAMIC_TEST_HOST}", want: "home-home"},
+		{name: "an empty variable", value: "a${PINAMIC_TEST_EMPTY}b", want: "ab"},
+		{name: "a lone dollar sign", value: "pa$$word$", want: "pa$$word$"},
+		{name: "an escaped reference", value: "$${PINAMIC_TEST_HOST}", want: "${PINAMIC_TEST_HOST}"},
+		{
+			name:  "an escaped reference beside a reference",
+			value: "$${PINAMIC_TEST_HOST}=${PINAMIC_TEST_HOST}",
+			want:  "${PINAMIC_TEST_HOST}=home",
+		},
+		{
+			name:    "an unset variable",
+			value:   "${PINAMIC_TEST_UNSET}",
+			wantErr: "refers to ${PINAMIC_TEST_UNSET}, which is not set",
+		},
+		{
+			name:    "an unclosed reference",
+			value:   "${PINAMIC_TEST_HOST",
+			wantErr: "has a ${ that is never closed; write $${ for a literal ${",
+		},
+		{
+			name:    "an invalid name",
+			value:   "${1HOST}",
+			wantErr: "refers to ${1HOST}, which is not a valid environment variable name",
+		},
+		{
+			name:    "an empty name",
+			value:   "${}",
+			wantErr: "refers to ${}, which is not a valid environment variable name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expanded, err := expandVariables(test.value)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got (%q, %v), want error %q", expanded, err, test.wantErr)
+				}
+			} else if err != nil || expanded != test.want {
+				t.Errorf("got (%q, %v), want %q", expanded, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// defaultIPCheckURL is the URL of the service that is asked for the current IP address, if no others are configured.
+const defaultIPCheckURL = "https://checkip.amazonaws.com/"
+
+// defaultIPv6CheckURL is the URL of the service that is asked for the current IPv6 address, if no others are
+// configured.
+const defaultIPv6CheckURL = "https://api6.ipify.org/"
+
+// defaultIPSourceJSONField is the field of a JSON response that the address is read from, if no other is configured.
+const defaultIPSourceJSONField = "ip"
+
+// Durations that a source is waited for between retries, which double after each failed attempt up to the maximum.
+const (
+	ipSourceRetryBackoff    = time.Second
+	maxIPSourceRetryBackoff = 10 * time.Second
+)
+
+// maxIPFromSize is the most that readStaticIPDetection will read, which is far more than two addresses need.
+const maxIPFromSize = 1024
+
+// Formats that the response of an IPSourceConfig's URL may be in
+const (
+	ipSourceFormatPlain = "plain"
+	ipSourceFormatJSON  = "json"
+)
+
+// Resolvers that may be given as the DNS of an IPSourceConfig
+const (
+	dnsIPSourceOpenDNS    = "opendns"
+	dnsIPSourceCloudflare = "cloudflare"
+)
+
+// dnsIPSources maps the resolvers that may be given as the DNS of an IPSourceConfig to the functions that make their
+// IPSources.
+var dnsIPSources = map[string]func(...func(*pinamicdns.DNSIPSource) error) (pinamicdns.DNSIPSource, error){
+	dnsIPSourceOpenDNS:    pinamicdns.NewOpenDNSIPSource,
+	dnsIPSourceCloudflare: pinamicdns.NewCloudflareIPSource,
+}
+
+// dnsIPv6Sources maps the resolvers that may be given as the DNS of an IPSourceConfig to the functions that make their
+// IPSources for IPv6 addresses.
+var dnsIPv6Sources = map[string]func(...func(*pinamicdns.DNSIPSource) error) (pinamicdns.DNSIPSource, error){
+	dnsIPSourceOpenDNS:    pinamicdns.NewOpenDNSIPv6Source,
+	dnsIPSourceCloudflare: pinamicdns.NewCloudflareIPv6Source,
+}
+
+// cloudProviders are the cloud providers that may be given as the CloudMetadata of an IPSourceConfig.
+var cloudProviders = map[string]pinamicdns.CloudProvider{
+	string(pinamicdns.DigitalOceanCloud): pinamicdns.DigitalOceanCloud,
+	string(pinamicdns.EC2Cloud):          pinamicdns.EC2Cloud,
+	string(pinamicdns.GCECloud):          pinamicdns.GCECloud,
+}
+
+// ipFamily is a version of IP that an address may be detected for.
+type ipFamily int
+
+// Families that addresses may be detected for. An address detected for ipFamilyAny may be of either version.
+const (
+	ipFamilyAny ipFamily = iota
+	ipFamilyIPv4
+	ipFamilyIPv6
+)
+
+// nonPublicIPRanges holds the ranges of IP addresses that should never be published as a public address, unless
+// explicitly allowed. These are the private, loopback, link-local, carrier-grade NAT, documentation, and otherwise
+// reserved ranges.
+var nonPublicIPRanges = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// detectIPs finds the current IP addresses to publish in correspondence with the given config: one for A records,
+// and, if an ipv6 section is configured, one for AAAA records. If either can't be found, the other is still returned,
+// along with an error describing the failure.
+func detectIPs(ctx context.Context, config Config) ([]net.IP, error) {
+	family := ipFamilyAny
+	if config.IPDetection.IPv6 != nil {
+		family = ipFamilyIPv4
+	}
+
+	ips := []net.IP{}
+	failures := []string{}
+	ip, err := detectIP(ctx, config.IPDetection.IPSourcesConfig, config.HTTPConfig, family)
+	if err != nil {
+		failures = append(failures, err.Error())
+	} else {
+		ips = append(ips, ip)
+	}
+
+	if config.IPDetection.IPv6 != nil {
+		ip, err = detectIP(ctx, *config.IPDetection.IPv6, config.HTTPConfig, ipFamilyIPv6)
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else {
+			ips = append(ips, ip)
+		}
+	}
+
+	if len(failures) > 0 {
+		return ips, errors.New(strings.Join(failures, "; "))
+	}
+
+	return ips, nil
+}
+
+// readStaticIPDetection reads the addresses to publish from the file at the given path, or from stdin if the path is
+// -, and gives an IPDetectionConfig that publishes them. The file must hold one address, or an IPv4 and an IPv6 address
+// to publish both, separated by whitespace.
+func readStaticIPDetection(path string) (IPDetectionConfig, error) {
+	reader := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return IPDetectionConfig{}, err
+		}
+
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxIPFromSize))
+	if err != nil {
+		return IPDetectionConfig{}, fmt.Errorf("could not read IP: %w", err)
+	}
+
+	return staticIPDetection(strings.Fields(string(data)))
+}
+
+// staticIPDetection gives an IPDetectionConfig that publishes the given addresses, which must be one address, or an
+// IPv4 and an IPv6 address to publish both.
+func staticIPDetection(rawIPs []string) (IPDetectionConfig, error) {
+	ips := []net.IP{}
+	for _, rawIP := range rawIPs {
+		ip := net.ParseIP(rawIP)
+		if ip == nil {
+			return IPDetectionConfig{}, fmt.Errorf("%q is not an IP address", rawIP)
+		}
+
+		ips = append(ips, ip)
+	}
+
+	switch {
+	case len(ips) == 1:
+		return IPDetectionConfig{IPSourcesConfig: IPSourcesConfig{StaticIP: ips[0].String()}}, nil
+	case len(ips) == 2 && ipFamilyIPv4.matches(ips[1]) && ipFamilyIPv6.matches(ips[0]):
+		ips[0], ips[1] = ips[1], ips[0]
+		fallthrough
+	case len(ips) == 2 && ipFamilyIPv4.matches(ips[0]) && ipFamilyIPv6.matches(ips[1]):
+		return IPDetectionConfig{
+			IPSourcesConfig: IPSourcesConfig{StaticIP: ips[0].String()},
+			IPv6:            &IPSourcesConfig{StaticIP: ips[1].String()},
+		}, nil
+	default:
+		return IPDetectionConfig{}, errors.New("expected one IP address, or one IPv4 and one IPv6 address")
+	}
+}
+
+// detectIP finds the current IP address of the given family with the IPSource described by the given config.
+func detectIP(ctx context.Context, sourcesConfig IPSourcesConfig, httpConfig HTTPConfig, family ipFamily) (net.IP, error) {
+	ipSource, err := makeIPSource(sourcesConfig, httpConfig, family)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up %s detection: %w", family, err)
+	}
+
+	ip, err := pinamicdns.IPContext(ctx, ipSource)
+	if err != nil {
+		return nil, err
+	} else if !family.matches(ip) {
+		return nil, fmt.Errorf("detected %s, which is not an %s address", ip, family)
+	}
+
+	return ip, nil
+}
+
+// makeIPSource makes an IPSource that will find the current IP address of the given family in correspondence with the
+// given config.
+func makeIPSource(sourcesConfig IPSourcesConfig, httpConfig HTTPConfig, family ipFamily) (pinamicdns.IPSource, error) {
+	if sourcesConfig.StaticIP != "" {
+		// This has already been validated with the config
+		return pinamicdns.NewStaticIPSource(net.ParseIP(sourcesConfig.StaticIP)), nil
+	}
+
+	sourceConfigs := sourcesConfig.Sources
+	if len(sourceConfigs) == 0 && family == ipFamilyIPv6 {
+		sourceConfigs = []IPSourceConfig{{URL: defaultIPv6CheckURL}}
+	} else if len(sourceConfigs) == 0 {
+		sourceConfigs = []IPSourceConfig{{URL: defaultIPCheckURL}}
+	}
+
+	sources := make([]pinamicdns.IPSource, 0, len(sourceConfigs))
+	for _, sourceConfig := range sourceConfigs {
+		if sourceConfig.Timeout == 0 {
+			sourceConfig.Timeout = sourcesConfig.Timeout
+		}
+
+		if sourceConfig.Retries == 0 {
+			sourceConfig.Retries = sourcesConfig.Retries
+		}
+
+		source, err := makeSingleIPSource(sourceConfig, httpConfig, family)
+		if err != nil {
+			return nil, err
+		} else if sourceConfig.Retries > 0 {
+			source = pinamicdns.NewRetryingIPSource(source, pinamicdns.RetryPolicy{
+				MaxAttempts:    sourceConfig.Retries + 1,
+				InitialBackoff: ipSourceRetryBackoff,
+				MaxBackoff:     maxIPSourceRetryBackoff,
+			})
+		}
+
+		sources = append(sources, source)
+	}
+
+	if sourcesConfig.Mode == ipDetectionConsensus {
+		options := []func(*pinamicdns.ConsensusIPSource) error{}
+		if sourcesConfig.Quorum != 0 {
+			options = append(options, pinamicdns.ConsensusQuorum(sourcesConfig.Quorum))
+		}
+
+		return pinamicdns.NewConsensusIPSource(sources, options...)
+	} else if len(sources) == 1 {
+		return sources[0], nil
+	}
+
+	return pinamicdns.NewFallbackIPSource(sources...), nil
+}
+
+// makeSingleIPSource makes the IPSource described by the given source config, which will find the current IP address
+// of the given family. Any HTTP requests it makes are made in correspondence with the given HTTP config, unless the
+// source config gives its own timeout.
+func makeSingleIPSource(sourceConfig IPSourceConfig, httpConfig HTTPConfig, family ipFamily) (pinamicdns.IPSource, error) {
+	timeout := time.Duration(sourceConfig.Timeout)
+	ipCheckHTTPConfig := httpConfig.ipCheckHTTPConfig()
+	if timeout != 0 {
+		ipCheckHTTPConfig.RequestTimeout = timeout
+	}
+
+	if sourceConfig.Interface != "" && family == ipFamilyIPv6 {
+		return pinamicdns.NewInterfaceIPSource(sourceConfig.Interface, pinamicdns.InterfaceIPv6())
+	} else if sourceConfig.Interface != "" {
+		return pinamicdns.NewInterfaceIPSource(sourceConfig.Interface)
+	} else if sourceConfig.NATPMPGateway != "" {
+		return makeNATPMPIPSource(sourceConfig.NATPMPGateway, timeout)
+	} else if sourceConfig.FritzBox != "" {
+		return makeFritzBoxIPSource(sourceConfig.FritzBox, ipCheckHTTPConfig, family)
+	} else if sourceConfig.OpenWrt != nil {
+		return makeOpenWrtIPSource(*sourceConfig.OpenWrt, ipCheckHTTPConfig, family)
+	} else if sourceConfig.Tailscale {
+		return makeTailscaleIPSource(sourceConfig.TailscaleSocket, timeout, family)
+	} else if sourceConfig.CloudMetadata != "" {
+		return makeCloudMetadataIPSource(sourceConfig.CloudMetadata, timeout, family)
+	} else if sourceConfig.Kubernetes != nil {
+		return makeKubernetesIPSource(*sourceConfig.Kubernetes, ipCheckHTTPConfig, family)
+	} else if sourceConfig.Command != "" {
+		return makeCommandIPSource(sourceConfig)
+	} else if sourceConfig.DNS != "" {
+		return makeDNSIPSource(sourceConfig.DNS, timeout, family)
+	}
+
+	ipCheckHTTPConfig.Network = family.network()
+	options := []func(*pinamicdns.HTTPIPSource) error{
+		pinamicdns.HTTPIPSourceHTTPConfig(ipCheckHTTPConfig),
+	}
+
+	if sourceConfig.Format == ipSourceFormatJSON {
+		jsonField := sourceConfig.JSONField
+		if jsonField == "" {
+			jsonField = defaultIPSourceJSONField
+		}
+
+		options = append(options, pinamicdns.HTTPIPSourceJSONField(jsonField))
+	}
+
+	return pinamicdns.NewHTTPIPSource(sourceConfig.URL, options...)
+}
+
+// makeNATPMPIPSource makes a NATPMPIPSource that will ask the given gateway for its external address, waiting for the
+// given timeout, if any, for it to respond.
+func makeNATPMPIPSource(gateway string, timeout time.Duration) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.NATPMPIPSource) error{}
+	if timeout != 0 {
+		options = append(options, pinamicdns.NATPMPTimeout(timeout))
+	}
+
+	return pinamicdns.NewNATPMPIPSource(gateway, options...)
+}
+
+// makeDNSIPSource makes a DNSIPSource that will ask the given resolver for the current IP address of the given family,
+// waiting for the given timeout, if any, for it to respond.
+func makeDNSIPSource(resolver string, timeout time.Duration, family ipFamily) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.DNSIPSource) error{}
+	if timeout != 0 {
+		options = append(options, pinamicdns.DNSIPSourceTimeout(timeout))
+	}
+
+	// This has already been validated with the config
+	if family == ipFamilyIPv6 {
+		return dnsIPv6Sources[resolver](options...)
+	}
+
+	return dnsIPSources[resolver](options...)
+}
+
+// makeCloudMetadataIPSource makes a CloudMetadataIPSource that will read the instance's current IP address of the
+// given family from the metadata service of the given cloud provider. If a timeout is given, requests to the service
+// may take no longer than it.
+func makeCloudMetadataIPSource(provider string, timeout time.Duration, family ipFamily) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.CloudMetadataIPSource) error{}
+	if timeout != 0 {
+		options = append(options, pinamicdns.CloudMetadataHTTPConfig(pinamicdns.HTTPConfig{RequestTimeout: timeout}))
+	}
+
+	if family == ipFamilyIPv6 {
+		options = append(options, pinamicdns.CloudMetadataIPv6())
+	}
+
+	// This has already been validated with the config
+	return pinamicdns.NewCloudMetadataIPSource(cloudProviders[provider], options...)
+}
+
+// makeFritzBoxIPSource makes a FritzBoxIPSource that will ask the FRITZ!Box with the given host for its current IP
+// address of the given family. Its HTTP requests are made in correspondence with the given HTTP config, but always over
+// the local network, regardless of the family.
+func makeFritzBoxIPSource(host string, httpConfig pinamicdns.HTTPConfig, family ipFamily) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.FritzBoxIPSource) error{
+		pinamicdns.FritzBoxHost(host),
+		pinamicdns.FritzBoxHTTPConfig(httpConfig),
+	}
+
+	if family == ipFamilyIPv6 {
+		options = append(options, pinamicdns.FritzBoxIPv6())
+	}
+
+	return pinamicdns.NewFritzBoxIPSource(options...)
+}
+
+// makeOpenWrtIPSource makes an OpenWrtIPSource that will read the current IP address of the given family from the
+// OpenWrt router with the given config. Its HTTP requests are made in the same manner as makeFritzBoxIPSource's.
+func makeOpenWrtIPSource(config OpenWrtSourceConfig, httpConfig pinamicdns.HTTPConfig, family ipFamily) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.OpenWrtIPSource) error{
+		pinamicdns.OpenWrtHTTPConfig(httpConfig),
+	}
+
+	if config.Interface != "" {
+		options = append(options, pinamicdns.OpenWrtInterface(config.Interface))
+	}
+
+	if family == ipFamilyIPv6 {
+		options = append(options, pinamicdns.OpenWrtIPv6())
+	}
+
+	return pinamicdns.NewOpenWrtIPSource(config.URL, config.Username, config.Password, options...)
+}
+
+// makeTailscaleIPSource makes a TailscaleIPSource that will get this node's Tailscale address of the given family from
+// the tailscaled serving the given socket, or the usual one if none is given, waiting for the given timeout, if any, for
+// it to respond.
+func makeTailscaleIPSource(socket string, timeout time.Duration, family ipFamily) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.TailscaleIPSource) error{}
+	if socket != "" {
+		options = append(options, pinamicdns.TailscaleSocket(socket))
+	}
+
+	if timeout != 0 {
+		options = append(options, pinamicdns.TailscaleTimeout(timeout))
+	}
+
+	if family == ipFamilyIPv6 {
+		options = append(options, pinamicdns.TailscaleIPv6())
+	}
+
+	return pinamicdns.NewTailscaleIPSource(options...)
+}
+
+// makeKubernetesIPSource makes a KubernetesIPSource that will read the current IP address of the given family from the
+// node or Service with the given config, making its requests in correspondence with the given HTTP config.
+func makeKubernetesIPSource(config KubernetesSourceConfig, httpConfig pinamicdns.HTTPConfig, family ipFamily) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.KubernetesIPSource) error{
+		pinamicdns.KubernetesHTTPConfig(httpConfig),
+	}
+
+	if config.APIURL != "" {
+		options = append(options, pinamicdns.KubernetesAPIURL(config.APIURL))
+	}
+
+	if family == ipFamilyIPv6 {
+		options = append(options, pinamicdns.KubernetesIPv6())
+	}
+
+	if config.Service != "" {
+		return pinamicdns.NewKubernetesServiceIPSource(config.Namespace, config.Service, options...)
+	}
+
+	if config.AddressType != "" {
+		options = append(options, pinamicdns.KubernetesNodeAddressType(config.AddressType))
+	}
+
+	node := config.Node
+	if node == "" {
+		node = os.Getenv("NODE_NAME")
+	}
+
+	if node == "" {
+		return nil, errors.New("kubernetes sources need a node or service, or NODE_NAME to be set")
+	}
+
+	return pinamicdns.NewKubernetesNodeIPSource(node, options...)
+}
+
+// makeCommandIPSource makes the CommandIPSource described by the given source config.
+func makeCommandIPSource(sourceConfig IPSourceConfig) (pinamicdns.IPSource, error) {
+	options := []func(*pinamicdns.CommandIPSource) error{pinamicdns.CommandIPSourceArgs(sourceConfig.Args...)}
+	if sourceConfig.Timeout != 0 {
+		options = append(options, pinamicdns.CommandIPSourceTimeout(time.Duration(sourceConfig.Timeout)))
+	}
+
+	return pinamicdns.NewCommandIPSource(sourceConfig.Command, options...)
+}
+
+// String gets the name of the family.
+func (family ipFamily) String() string {
+	switch family {
+	case ipFamilyIPv4:
+		return "IPv4"
+	case ipFamilyIPv6:
+		return "IPv6"
+	default:
+		return "IP"
+	}
+}
+
+// matches checks whether or not the given IP belongs to the family.
+func (family ipFamily) matches(ip net.IP) bool {
+	switch family {
+	case ipFamilyIPv4:
+		return ip.To4() != nil
+	case ipFamilyIPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// network gets the network that connections to detect an address of the family must be made over, if any.
+func (family ipFamily) network() string {
+	switch family {
+	case ipFamilyIPv4:
+		return "tcp4"
+	case ipFamilyIPv6:
+		return "tcp6"
+	default:
+		return ""
+	}
+}
+
+// validateIP checks that the given IP is reasonable to publish, in correspondence with the given config.
+func validateIP(ip net.IP, config IPValidationConfig) error {
+	if !config.AllowPrivate {
+		for _, ipRange := range nonPublicIPRanges {
+			if ipRange.Contains(ip) {
+				return fmt.Errorf("%s is within %s, which is not a public range", ip, ipRange)
+			}
+		}
+	}
+
+	if len(config.AllowedPrefixes) == 0 {
+		return nil
+	}
+
+	for _, rawPrefix := range config.AllowedPrefixes {
+		// These have already been validated with the config
+		_, prefix, _ := net.ParseCIDR(rawPrefix)
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s is not within any of the allowed prefixes", ip)
+}
+
+// mustParseCIDRs parses all of the given CIDR strings, panicking if any are invalid.
+func mustParseCIDRs(rawCIDRs ...string) []*net.IPNet {
+	cidrs := make([]*net.IPNet, len(rawCIDRs))
+	for i, rawCIDR := range rawCIDRs {
+		_, cidr, err := net.ParseCIDR(rawCIDR)
+		if err != nil {
+			panic(err)
+		}
+
+		cidrs[i] = cidr
+	}
+
+	return cidrs
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStaticIPDetection(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawIPs  []string
+		want    IPDetectionConfig
+		wantErr bool
+	}{
+		{
+			name:   "an IPv4 address",
+			rawIPs: []string{"203.0.113.1"},
+			want:   IPDetectionConfig{IPSourcesConfig: IPSourcesConfig{StaticIP: "203.0.113.1"}},
+		},
+		{
+			name:   "an IPv6 address",
+			rawIPs: []string{"2001:db8::1"},
+			want:   IPDetectionConfig{IPSourcesConfig: IPSourcesConfig{StaticIP: "2001:db8::1"}},
+		},
+		{
+			name:   "addresses are normalized",
+			rawIPs: []string{"2001:DB8:0::1"},
+			want:   IPDetectionConfig{IPSourcesConfig: IPSourcesConfig{StaticIP: "2001:db8::1"}},
+		},
+		{
+			name:   "an IPv4 and an IPv6 address",
+			rawIPs: []string{"203.0.113.1", "2001:db8::1"},
+			want: IPDetectionConfig{
+				IPSourcesConfig: IPSourcesConfig{StaticIP: "203.0.113.1"},
+				IPv6:            &IPSourcesConfig{StaticIP: "2001:db8::1"},
+			},
+		},
+		{
+			name:   "an IPv6 and an IPv4 address",
+			rawIPs: []string{"2001:db8::1", "203.0.113.1"},
+			want: IPDetectionConfig{
+				IPSourcesConfig: IPSourcesConfig{StaticIP: "203.0.113.1"},
+				IPv6:            &IPSourcesConfig{StaticIP: "2001:db8::1"},
+			},
+		},
+		{name: "no addresses", rawIPs: []string{}, wantErr: true},
+		{name: "an address that is not one", rawIPs: []string{"home.example.com"}, wantErr: true},
+		{name: "two IPv4 addresses", rawIPs: []string{"203.0.113.1", "203.0.113.2"}, wantErr: true},
+		{name: "two IPv6 addresses", rawIPs: []string{"2001:db8::1", "2001:db8::2"}, wantErr: true},
+		{name: "three addresses", rawIPs: []string{"203.0.113.1", "2001:db8::1", "203.0.113.2"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			detection, err := staticIPDetection(test.rawIPs)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", detection)
+				}
+			} else if err != nil || !reflect.DeepEqual(detection, test.want) {
+				t.Errorf("got (%+v, %v), want %+v", detection, err, test.want)
+			}
+		})
+	}
+}
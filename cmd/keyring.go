@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// keyringService is the service that access tokens are stored under in the OS keyring, along with the name of the
+// provider that each is for.
+const keyringService = "pinamic-dns"
+
+// storeTokenInKeyring asks for an access token on the given input and stores it in the OS keyring under the given
+// name of a provider, so that configs giving access_token_keyring can read it.
+func storeTokenInKeyring(providerName string, input *os.File, output io.Writer) error {
+	if providerName == "" {
+		return errors.New("the name of a provider must be given")
+	}
+
+	prompt := prompter{input: input, reader: bufio.NewReader(input), output: output}
+	token, err := prompt.askSecret(fmt.Sprintf("Access token for %s", providerName))
+	if err != nil {
+		return err
+	}
+
+	err = writeKeyringToken(providerName, token)
+	if err != nil {
+		return fmt.Errorf("could not store access token in the keyring: %w", err)
+	}
+
+	fmt.Fprintf(output, "Stored access token for %s in the keyring\n", providerName)
+
+	return nil
+}
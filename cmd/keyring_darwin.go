@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// itemNotFoundStatus is the status that security exits with when no item in the keychain matches.
+const itemNotFoundStatus = 44
+
+// readKeyringToken reads the access token stored under the given name of a provider from the login keychain.
+func readKeyringToken(providerName string) (string, error) {
+	cmd := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", providerName, "-w")
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	token, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == itemNotFoundStatus {
+		return "", fmt.Errorf("none is stored; store one with pinamic-dns config store-token %s", providerName)
+	} else if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(token), nil
+}
+
+// writeKeyringToken stores the given access token under the given name of a provider in the login keychain, replacing
+// any that is already stored. The command is given to security on its input, so that the token never appears in its
+// arguments.
+func writeKeyringToken(providerName string, token string) error {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	command := fmt.Sprintf(
+		`add-generic-password -U -s "%s" -a "%s" -w "%s"`+"\n",
+		quote.Replace(keyringService),
+		quote.Replace(providerName),
+		quote.Replace(token),
+	)
+
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(command)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
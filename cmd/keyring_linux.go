@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secretToolMissing explains what must be installed to use the keyring, if secret-tool can't be found.
+const secretToolMissing = "secret-tool was not found; install it, such as with the libsecret-tools package, to use " +
+	"the keyring"
+
+// readKeyringToken reads the access token stored under the given name of a provider from the Secret Service, such as
+// GNOME Keyring or KWallet, using libsecret's secret-tool.
+func readKeyringToken(providerName string) (string, error) {
+	cmd := exec.Command("secret-tool", "lookup", "service", keyringService, "account", providerName)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	token, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", errors.New(secretToolMissing)
+	} else if err != nil && stderr.Len() > 0 {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return "", fmt.Errorf("none is stored; store one with pinamic-dns config store-token %s", providerName)
+	}
+
+	return string(token), nil
+}
+
+// writeKeyringToken stores the given access token under the given name of a provider in the Secret Service. The token
+// is given to secret-tool on its input, so that it never appears in its arguments.
+func writeKeyringToken(providerName string, token string) error {
+	cmd := exec.Command(
+		"secret-tool",
+		"store",
+		"--label=pinamic-dns access token for "+providerName,
+		"service",
+		keyringService,
+		"account",
+		providerName,
+	)
+	cmd.Stdin = strings.NewReader(token)
+	output, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		return errors.New(secretToolMissing)
+	} else if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+import "errors"
+
+// errKeyringUnsupported is returned when the keyring is used on a platform whose keyring isn't supported.
+var errKeyringUnsupported = errors.New("the keyring is only supported on Linux, macOS, and Windows")
+
+// readKeyringToken would read the access token stored under the given name of a provider from the OS keyring, but
+// this is not supported on this platform.
+func readKeyringToken(providerName string) (string, error) {
+	return "", errKeyringUnsupported
+}
+
+// writeKeyringToken would store the given access token under the given name of a provider in the OS keyring, but
+// this is not supported on this platform.
+func writeKeyringToken(providerName string, token string) error {
+	return errKeyringUnsupported
+}
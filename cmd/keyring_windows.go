@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Values that Windows Credential Manager's credentials are given
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+)
+
+// maxCredentialBlobSize is the largest secret that Credential Manager will hold, in bytes.
+const maxCredentialBlobSize = 5 * 512
+
+var (
+	modAdvapi32    = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW  = modAdvapi32.NewProc("CredReadW")
+	procCredWriteW = modAdvapi32.NewProc("CredWriteW")
+	procCredFree   = modAdvapi32.NewProc("CredFree")
+)
+
+// credential is Credential Manager's CREDENTIALW.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// readKeyringToken reads the access token stored under the given name of a provider from Credential Manager.
+func readKeyringToken(providerName string) (string, error) {
+	target, err := windows.UTF16PtrFromString(keyringTarget(providerName))
+	if err != nil {
+		return "", err
+	}
+
+	var cred *credential
+	ok, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 && errors.Is(err, windows.ERROR_NOT_FOUND) {
+		return "", fmt.Errorf("none is stored; store one with pinamic-dns config store-token %s", providerName)
+	} else if ok == 0 {
+		return "", err
+	}
+
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return "", nil
+	}
+
+	// Tokens are stored as UTF-16, as they are by cmdkey and Credential Manager itself.
+	length := cred.CredentialBlobSize / 2
+	blob := (*[maxCredentialBlobSize / 2]uint16)(unsafe.Pointer(cred.CredentialBlob))[:length:length]
+
+	return string(utf16.Decode(blob)), nil
+}
+
+// writeKeyringToken stores the given access token under the given name of a provider in Credential Manager, replacing
+// any that is already stored.
+func writeKeyringToken(providerName string, token string) error {
+	target, err := windows.UTF16PtrFromString(keyringTarget(providerName))
+	if err != nil {
+		return err
+	}
+
+	userName, err := windows.UTF16PtrFromString(providerName)
+	if err != nil {
+		return err
+	}
+
+	blob := utf16.Encode([]rune(token))
+	if len(blob) == 0 || len(blob)*2 > maxCredentialBlobSize {
+		return fmt.Errorf("access token must be between 1 and %d bytes long", maxCredentialBlobSize/2)
+	}
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob) * 2),
+		CredentialBlob:     (*byte)(unsafe.Pointer(&blob[0])),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+
+	ok, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ok == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// keyringTarget gets the name that the access token for the given name of a provider is stored under.
+func keyringTarget(providerName string) string {
+	return keyringService + ":" + providerName
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// runListCommand prints the records that the given setter can see in the given domain, or in each of the domains of
+// the given config if none is given.
+func runListCommand(args []string, config Config, setter pinamicdns.IPSetter) error {
+	if len(args) > 1 {
+		return errors.New("usage: list [domain]")
+	}
+
+	lister, ok := setter.(pinamicdns.RecordLister)
+	if !ok {
+		return errors.New("the configured provider can not list records")
+	}
+
+	domains := args
+	if len(domains) == 0 {
+		domains = configDomains(config)
+	}
+
+	for _, domain := range domains {
+		records, err := lister.Records(domain)
+		if err != nil {
+			return err
+		}
+
+		err = printRecords(os.Stdout, domain, records)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printRecords prints the given records in the given domain to the given writer, as a table.
+func printRecords(writer io.Writer, domain string, records []pinamicdns.Record) error {
+	tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tableWriter, "%s\n", domain)
+	fmt.Fprintf(tableWriter, "TYPE\tNAME\tVALUE\tTTL\tPRIORITY\n")
+	for _, record := range records {
+		fmt.Fprintf(tableWriter, "%s\t%s\t%s\t%d\t%d\n", record.Type, record.Name, record.Value, record.TTL, record.Priority)
+	}
+
+	fmt.Fprintln(tableWriter)
+
+	return tableWriter.Flush()
+}
+
+// configDomains gets each of the domains that the given config specifies records in, in the order they are first given.
+func configDomains(config Config) []string {
+	// Records in the DNSConfig with a provider of their own are not part of its records, but are still in its domains.
+	records := append(config.DNSConfig.records(), config.DNSConfig.Records...)
+	for _, entry := range config.Providers {
+		records = append(records, entry.records()...)
+	}
+
+	domains := []string{}
+	seenDomains := map[string]bool{}
+	for _, record := range records {
+		if !seenDomains[record.Domain] {
+			domains = append(domains, record.Domain)
+			seenDomains[record.Domain] = true
+		}
+	}
+
+	return domains
+}
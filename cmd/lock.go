@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errLocked is returned by lockFile if another process already holds the lock.
+var errLocked = errors.New("file is locked by another process")
+
+// lockState takes a lock alongside the state file at the given path, so that no other instance of pinamic-dns using
+// the same state can run at the same time. The lock is held until the returned file is closed, or this process exits.
+func lockState(statePath string) (*os.File, error) {
+	lockPath := statePath + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file)
+	if err == errLocked {
+		file.Close()
+		return nil, fmt.Errorf("another instance of pinamic-dns is already running with %s", lockPath)
+	} else if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not lock %s: %w", lockPath, err)
+	}
+
+	// The lock file is never removed, as another process may be waiting to lock it, but it may help to know who holds it.
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not write to %s: %w", lockPath, err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import "os"
+
+// lockFile would lock the given file, but this is not supported on this platform, so instances of pinamic-dns are
+// trusted not to overlap.
+func lockFile(file *os.File) error {
+	return nil
+}
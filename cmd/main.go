@@ -1,16 +1,19 @@
 package main
 
 import (
-	"io/ioutil"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
-	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/ogier/pflag"
 	pinamicdns "github.com/ollien/pinamic-dns"
-	"github.com/ollien/xtrace"
 )
 
 //DNSStatusCode represents the result of what CreateOrUpdateRecord did.
@@ -29,73 +32,356 @@ const (
 	StatusIPAlreadySet
 )
 
-// Get the current external IP address
-func getIP() (net.IP, error) {
-	res, err := http.Get("http://checkip.amazonaws.com/")
-
-	if err != nil {
-		return nil, err
-	}
+// commandOptions are the options given on the command line, for any of the commands.
+type commandOptions struct {
+	configPath   string
+	logFilePath  string
+	statePath    string
+	prune        bool
+	staticIP     string
+	ipFrom       string
+	allowPrivate bool
+	force        bool
+	daemon       bool
+	healthFile   string
+	dryRun       bool
+	// searchedConfig is whether or not the config was searched for, rather than given with --config.
+	searchedConfig bool
+}
 
-	defer res.Body.Close()
-	resData, err := ioutil.ReadAll(res.Body)
+// commands are the commands that may be given as the first argument. If none is, the records are updated once, as with
+// the once command, so that invocations from before there were commands still work.
+var commands = map[string]bool{
+	"once":    true,
+	"run":     true,
+	"acme":    true,
+	"delete":  true,
+	"list":    true,
+	"service": true,
+	"serve":   true,
+	"config":  true,
+}
 
-	if err != nil {
-		return nil, err
+func main() {
+	command, args, options := parseCommandLine(os.Args[1:])
+	// The config is searched for once, so that reloading it never finds a different one.
+	if options.configPath == "" {
+		options.configPath = findConfig()
+		options.searchedConfig = true
 	}
 
-	rawIP := strings.Trim(string(resData), "\n")
+	daemon := command == "run"
+	inService := daemon && runningAsService()
 
-	return net.ParseIP(rawIP), nil
-}
-
-func main() {
-	configPath := ""
-	logFilePath := ""
-	pflag.StringVarP(&configPath, "config", "c", defaultConfigPath, "Set a path to a config.json")
-	pflag.StringVarP(&logFilePath, "logfile", "l", "", "Redirect output to a log file.")
-	pflag.Parse()
-
-	logWriter := os.Stderr
-	if logFilePath != "" {
-		logFile, err := os.OpenFile(logFilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	logWriter := io.Writer(os.Stderr)
+	logFlags := log.LstdFlags
+	if options.logFilePath != "" {
+		logFile, err := os.OpenFile(options.logFilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		defer logFile.Close()
 		logWriter = logFile
+	} else if inService {
+		// A service has nowhere to write to otherwise. The event log keeps its own timestamps.
+		serviceLog, err := openServiceLog()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer serviceLog.Close()
+		logWriter = serviceLog
+		logFlags = 0
+	}
+	logger := log.New(logWriter, "", logFlags)
+
+	if command == "service" {
+		err := runServiceCommand(args, options)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		return
+	}
+
+	// There is no config to load until config init has written one.
+	if command == "config" {
+		err := runConfigCommand(args, options)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		return
+	}
+
+	if options.daemon {
+		logger.Print("--daemon is deprecated; use pinamic-dns run instead")
+		daemon = true
+	}
+
+	if options.healthFile != "" && !daemon {
+		logger.Fatal("--write-healthfile may only be given when running as a daemon")
+	} else if options.dryRun && daemon {
+		logger.Fatal("--dry-run may not be given when running as a daemon")
 	}
-	logger := log.New(logWriter, "", log.LstdFlags)
 
-	config, err := NewConfig(configPath)
+	config, err := loadConfig(options)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	var setter pinamicdns.IPSetter
-	setter, err = pinamicdns.NewDigitalOceanIPSetter(config, pinamicdns.DigitalOceanRecordTTL(config.DNSConfig.TTL))
-	ip, err := getIP()
+	if options.ipFrom != "" {
+		if options.staticIP != "" || daemon {
+			logger.Fatal("--ip-from may not be given with --ip or --daemon")
+		}
+
+		config.IPDetection, err = readStaticIPDetection(options.ipFrom)
+		if err != nil {
+			logger.Fatalf("Could not read IP from %s: %s", options.ipFrom, err)
+		}
+	}
+
+	// Listing records, publishing ACME challenges, and dry runs don't touch the records in the state, and certificates
+	// must be able to be renewed while the daemon is running. Anything else must not overlap another instance, or they
+	// may each create a record.
+	readOnly := command == "list" || command == "acme" || options.dryRun
+	if !readOnly {
+		lock, err := lockState(options.statePath)
+		if err != nil {
+			logger.Fatalf("Could not lock state: %s", err)
+		}
+
+		defer lock.Close()
+	}
+
+	state, err := LoadState(options.statePath)
 	if err != nil {
-		logger.Fatalf("Could not get IP to update with: %s", err)
+		logger.Fatalf("Could not load state: %s", err)
 	}
 
-	err = setter.SetIP(config.DNSConfig.Domain, config.DNSConfig.Name, ip)
+	setter, err := makeSetter(config, state)
 	if err != nil {
-		logger.Printf("Could not update record: %s", err)
-		tracer, tracerErr := xtrace.NewTracer(err)
-		if tracerErr != nil {
-			logger.Fatalf("Could not produce error trace: %s", err)
+		logger.Fatalf("Could not set up provider: %s", err)
+	}
+
+	if command != "" && command != "once" && command != "run" && command != "serve" {
+		err = runCommand(append([]string{command}, args...), config, setter, state)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if !readOnly {
+			saveState(state, options.statePath, logger)
+		}
+
+		return
+	}
+
+	recordUpdater := updater{
+		config:    config,
+		setter:    setter,
+		state:     &state,
+		statePath: options.statePath,
+		prune:     options.prune,
+		force:     options.force,
+		logger:    logger,
+		logWriter: logWriter,
+	}
+
+	if command == "serve" {
+		if config.DyndnsServer == nil {
+			logger.Fatal("serve requires a dyndns_server section in config")
+		}
+
+		err = serveDyndns(shutdownContext(logger), recordUpdater)
+		if err != nil {
+			logger.Fatalf("Could not serve dyndns2 updates: %s", err)
+		}
+
+		return
+	}
+
+	if inService {
+		err = runService(func(ctx context.Context) bool {
+			return runDaemon(ctx, recordUpdater, func() (Config, error) { return loadConfig(options) })
+		})
+		if err != nil {
+			logger.Fatalf("Could not run as a service: %s", err)
+		}
+
+		return
+	}
+
+	ctx := shutdownContext(logger)
+	if options.dryRun {
+		err = recordUpdater.dryRun(ctx, os.Stdout)
+		if err != nil {
+			logger.Fatal(err)
 		}
 
-		traceErr := tracer.Trace(logWriter)
-		if traceErr != nil {
-			logger.Fatalf("Could not produce error trace: %s", err)
+		return
+	} else if !daemon {
+		_, err = recordUpdater.update(ctx)
+		if err != nil {
+			os.Exit(1)
 		}
-		// HACK: Write a newline so there's one after the trace
-		// Should probably be done in xtrace
-		logWriter.Write([]byte("\n"))
 
+		return
+	}
+
+	interrupted := runDaemon(ctx, recordUpdater, func() (Config, error) { return loadConfig(options) })
+	if interrupted {
 		os.Exit(1)
 	}
 }
+
+// loadConfig loads the config from the path given in the given options, and applies the other options to it.
+func loadConfig(options commandOptions) (Config, error) {
+	config, err := NewConfig(options.configPath)
+	if errors.Is(err, os.ErrNotExist) && options.searchedConfig {
+		dirs := strings.Join(configSearchDirs(), ", ")
+		return Config{}, fmt.Errorf("no config was found in any of %s; give the path of one with --config", dirs)
+	} else if err != nil {
+		return Config{}, legacyConfigError(options.configPath, err)
+	}
+
+	if options.prune {
+		config.DNSConfig.DuplicateRecords = "consolidate"
+	}
+
+	if options.allowPrivate {
+		config.IPValidation.AllowPrivate = true
+	}
+
+	if options.staticIP != "" {
+		if net.ParseIP(options.staticIP) == nil {
+			return Config{}, fmt.Errorf("%q is not an IP address", options.staticIP)
+		}
+
+		config.IPDetection = IPDetectionConfig{IPSourcesConfig: IPSourcesConfig{StaticIP: options.staticIP}}
+	}
+
+	if options.healthFile != "" {
+		config.Daemon.HealthFile = options.healthFile
+	}
+
+	return config, nil
+}
+
+// parseCommandLine parses the given arguments into the command they give, the arguments that follow it, and the options
+// that were given with it. Each command accepts only the flags that make sense for it. If the arguments are invalid,
+// usage is printed and the process exits.
+func parseCommandLine(args []string) (string, []string, commandOptions) {
+	command := ""
+	name := os.Args[0]
+	if len(args) > 0 && commands[args[0]] {
+		command = args[0]
+		name += " " + command
+		args = args[1:]
+	}
+
+	options := commandOptions{}
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+	flags.StringVarP(&options.configPath, "config", "c", "", "Set a path to a config.json, rather than searching for one")
+	flags.StringVarP(&options.logFilePath, "logfile", "l", "", "Redirect output to a log file.")
+	flags.StringVarP(&options.statePath, "statefile", "s", defaultStatePath, "Set a path to store state between runs in.")
+	switch command {
+	case "", "once", "run":
+		flags.BoolVarP(&options.prune, "prune", "p", false, "Delete all but one record for each name, even if the IP is unchanged.")
+		flags.StringVar(&options.staticIP, "ip", "", "Publish the given IP, rather than detecting the current one.")
+		flags.BoolVar(&options.allowPrivate, "allow-private", false, "Publish the IP even if it is not within a public range.")
+		flags.BoolVarP(&options.force, "force", "f", false, "Detect the IP, even if it was detected within the recheck interval.")
+		if command != "once" {
+			flags.StringVar(&options.healthFile, "write-healthfile", "", "Write a file after each successful update, for health checks.")
+		}
+
+		if command != "run" {
+			flags.StringVar(&options.ipFrom, "ip-from", "", "Publish the IP read from the given file, or from stdin if -.")
+			flags.BoolVar(&options.dryRun, "dry-run", false, "Print the changes that would be made to the records, without making them.")
+		}
+
+		if command == "" {
+			flags.BoolVarP(&options.daemon, "daemon", "d", false, "Keep running, updating the record every interval.")
+		}
+	case "config":
+		// Its subcommand takes no arguments that look like flags, so flags may come after it.
+	default:
+		// Arguments to these commands, such as ACME challenge values, may look like flags themselves.
+		flags.SetInterspersed(false)
+	}
+
+	if command == "" {
+		flags.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage of %s [once|run|serve|acme|delete|list|service|config]:\n", name)
+			flags.PrintDefaults()
+		}
+	}
+
+	flags.Parse(args)
+	switch command {
+	case "":
+		// Commands used to be given after any flags.
+		if flags.NArg() > 0 {
+			return flags.Arg(0), flags.Args()[1:], options
+		}
+	case "once", "run", "serve":
+		if flags.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "%s takes no arguments\nUsage of %s:\n", command, name)
+			flags.PrintDefaults()
+			os.Exit(2)
+		}
+	}
+
+	return command, flags.Args(), options
+}
+
+// shutdownContext makes a context that is cancelled once this process is asked to stop, by SIGINT or SIGTERM, so that
+// whatever is in progress can be given up on cleanly. A second signal stops the process immediately, as usual.
+func shutdownContext(logger *log.Logger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		logger.Printf("Received %s; shutting down", sig)
+		cancel()
+	}()
+
+	return ctx
+}
+
+// runCommand runs the command given by the first of the given arguments, rather than updating the record. The command
+// may change the given state, which should be saved afterwards.
+func runCommand(args []string, config Config, setter pinamicdns.IPSetter, state State) error {
+	switch args[0] {
+	case "acme":
+		return runACMECommand(args[1:], config, setter)
+	case "delete":
+		return runDeleteCommand(args[1:], config, setter, state)
+	case "list":
+		return runListCommand(args[1:], config, setter)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// checkAccess confirms the given setter can set records for the given domain, if the setter supports doing so.
+func checkAccess(setter pinamicdns.IPSetter, domain string) error {
+	accessChecker, ok := setter.(pinamicdns.AccessChecker)
+	if !ok {
+		return nil
+	}
+
+	return accessChecker.CheckAccess(domain)
+}
+
+// saveState saves the given state to the given path, logging any failure to do so.
+// As this happens after the fact, failing to save state is not fatal.
+func saveState(state State, statePath string, logger *log.Logger) {
+	err := state.Save(statePath)
+	if err != nil {
+		logger.Printf("Could not save state: %s", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// legacyConfigSuffix is added to the path of a legacy config that is migrated in place, to keep the original.
+const legacyConfigSuffix = ".legacy"
+
+// legacyConfig is the config.json of the versions of pinamic-dns that only supported DigitalOcean, and which kept the
+// ID of the record that they had created in the config, rather than in a state file.
+type legacyConfig struct {
+	AccessToken string          `json:"access_token"`
+	DNSConfig   legacyDNSConfig `json:"dns_config"`
+}
+
+// legacyDNSConfig is the dns_config of a legacyConfig.
+type legacyDNSConfig struct {
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	TTL    int    `json:"ttl"`
+	// ID is the ID that DigitalOcean gave the A record, once it had been created. It may be given as a number or a
+	// string.
+	ID json.Number `json:"id"`
+}
+
+// migrateConfig converts the legacy config at the given path to the current format, writing it to the given output
+// path, readable only by the current user, and the ID of its record to the state file at the given path, so that the
+// record that it set is updated rather than created again. If no output path is given, the config is replaced, and the
+// original is kept alongside it.
+func migrateConfig(path string, outputPath string, statePath string, output io.Writer) error {
+	rawConfig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var currentConfig Config
+	if decodeConfig(rawConfig, &currentConfig) == nil {
+		return fmt.Errorf("%s is already in the current format", path)
+	}
+
+	legacy, err := decodeLegacyConfig(rawConfig)
+	if err != nil {
+		return fmt.Errorf("%s is not a legacy config: %w", path, err)
+	}
+
+	recordID := string(legacy.DNSConfig.ID)
+	if _, err := strconv.ParseUint(recordID, 10, 64); err != nil {
+		return fmt.Errorf("%s is not a legacy config: dns_config.id must be a whole number", path)
+	}
+
+	config := initialConfig{
+		Provider:    providerDigitalOcean,
+		AccessToken: legacy.AccessToken,
+		DNSConfig: initialDNSConfig{
+			Domain: legacy.DNSConfig.Domain,
+			Name:   legacy.DNSConfig.Name,
+			TTL:    legacy.DNSConfig.TTL,
+		},
+	}
+
+	legacyPath := ""
+	if outputPath == "" {
+		outputPath, legacyPath = path, path+legacyConfigSuffix
+		if _, err := os.Stat(legacyPath); err == nil {
+			return fmt.Errorf("%s already exists; remove it first, or give a path to write the config to", legacyPath)
+		}
+	}
+
+	// The config is checked before anything is written, so that a failed migration leaves everything as it was.
+	err = checkInitialConfig(config)
+	if err != nil {
+		return fmt.Errorf("%s could not be migrated: %w", path, err)
+	}
+
+	if legacyPath != "" {
+		err = writeFileAtomic(legacyPath, 0600, func(w io.Writer) error {
+			_, err := w.Write(rawConfig)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("could not keep legacy config: %w", err)
+		}
+	}
+
+	err = writeInitialConfig(outputPath, config)
+	if err != nil {
+		return fmt.Errorf("could not write config: %w", err)
+	}
+
+	fmt.Fprintf(output, "Wrote config to %s\n", outputPath)
+	if legacyPath != "" {
+		fmt.Fprintf(output, "Kept the legacy config at %s\n", legacyPath)
+	}
+
+	record := recordKey(config.DNSConfig.Domain, config.DNSConfig.Name)
+	stored, err := storeLegacyRecordID(statePath, config.DNSConfig, recordID)
+	if err != nil {
+		return fmt.Errorf("could not write the ID of %s to the state: %w", record, err)
+	} else if !stored {
+		fmt.Fprintf(output, "%s already holds an ID for %s, so it was left as it was\n", statePath, record)
+		return nil
+	}
+
+	fmt.Fprintf(output, "Wrote the ID of %s to %s, so that the record is updated rather than created again\n",
+		record, statePath)
+
+	return nil
+}
+
+// decodeLegacyConfig decodes the given JSON as a legacyConfig, rejecting any field that a legacy config did not have.
+func decodeLegacyConfig(rawConfig []byte) (legacyConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(rawConfig))
+	decoder.DisallowUnknownFields()
+	var legacy legacyConfig
+	err := decoder.Decode(&legacy)
+	if err != nil {
+		return legacyConfig{}, describeSyntaxError(rawConfig, err)
+	}
+
+	return legacy, nil
+}
+
+// legacyConfigError gives the given error, which was returned when reading the config at the given path, unless the
+// config is a legacy one that holds the ID of its record, which is never valid in the current format. A legacy config
+// is instead said to need migrating, as the error it gives would only be that its id is not a config field.
+func legacyConfigError(path string, err error) error {
+	rawConfig, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return err
+	}
+
+	legacy, decodeErr := decodeLegacyConfig(rawConfig)
+	if decodeErr != nil || legacy.DNSConfig.ID == "" {
+		return err
+	}
+
+	return fmt.Errorf("%s is from an older version of pinamic-dns; convert it with pinamic-dns config migrate", path)
+}
+
+// storeLegacyRecordID stores the given ID of the A record of the given legacy dns_config in the state file at the given
+// path, holding its lock while doing so. If the state already holds an ID for the record, it is kept, and false is
+// given.
+func storeLegacyRecordID(statePath string, dnsConfig initialDNSConfig, recordID string) (bool, error) {
+	lock, err := lockState(statePath)
+	if err != nil {
+		return false, err
+	}
+
+	defer lock.Close()
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		return false, err
+	}
+
+	// Legacy configs only ever set an A record.
+	if _, ok := state.RecordID(dnsConfig.Domain, dnsConfig.Name, "A"); ok {
+		return false, nil
+	}
+
+	state.SetRecordID(dnsConfig.Domain, dnsConfig.Name, "A", recordID)
+	err = state.Save(statePath)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
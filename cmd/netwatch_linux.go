@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"syscall"
+)
+
+// netlinkGroups are the netlink groups that watchAddressChanges listens to: changes to the addresses of interfaces,
+// and to routes. Each group is bound to by setting the bit that is one less than its number.
+const netlinkGroups = 1<<(syscall.RTNLGRP_IPV4_IFADDR-1) | 1<<(syscall.RTNLGRP_IPV6_IFADDR-1) |
+	1<<(syscall.RTNLGRP_IPV4_ROUTE-1) | 1<<(syscall.RTNLGRP_IPV6_ROUTE-1)
+
+// watchAddressChanges watches for the addresses of this machine's interfaces, or its default routes, changing, such as
+// when a PPPoE connection is re-established. The returned channel receives a value after each change, though several
+// changes made in quick succession may only be reported once. If changes can't be watched for, this is logged, and
+// the channel never receives anything.
+func watchAddressChanges(logger *log.Logger) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		logger.Printf("Could not watch for address changes: %s", err)
+		return changes
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: netlinkGroups})
+	if err != nil {
+		syscall.Close(fd)
+		logger.Printf("Could not watch for address changes: %s", err)
+		return changes
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+		buf := make([]byte, syscall.Getpagesize())
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err == syscall.EINTR || err == syscall.ENOBUFS {
+				// If the kernel dropped messages because we fell behind, something has still changed.
+				if err == syscall.ENOBUFS {
+					notifyAddressChange(changes)
+				}
+
+				continue
+			} else if err != nil {
+				logger.Printf("Stopped watching for address changes: %s", err)
+				return
+			}
+
+			messages, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			for _, message := range messages {
+				if isAddressChange(message) {
+					notifyAddressChange(changes)
+					break
+				}
+			}
+		}
+	}()
+
+	return changes
+}
+
+// isAddressChange checks whether or not the given netlink message reports a change that may have changed the current
+// IP address. Changes to routes other than default routes are ignored, as those are made far more often.
+func isAddressChange(message syscall.NetlinkMessage) bool {
+	switch message.Header.Type {
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		return true
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		// The second byte of the message is the prefix length of the route's destination, which is zero for default
+		// routes.
+		return len(message.Data) >= syscall.SizeofRtMsg && message.Data[1] == 0
+	default:
+		return false
+	}
+}
+
+// notifyAddressChange reports a change on the given channel, unless one is already waiting to be received.
+func notifyAddressChange(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
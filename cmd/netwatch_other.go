@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "log"
+
+// watchAddressChanges would watch for the addresses of this machine's interfaces changing, but this is only supported
+// on Linux. It logs as much, and the returned channel never receives anything.
+func watchAddressChanges(logger *log.Logger) <-chan struct{} {
+	logger.Printf("Watching for address changes is only supported on Linux; updating every interval instead")
+
+	return nil
+}
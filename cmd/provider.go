@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// Names of the providers that the config treats specially
+const (
+	providerDigitalOcean = "digitalocean"
+	providerDuckDNS      = "duckdns"
+	providerNamecheap    = "namecheap"
+)
+
+// defaultConcurrency is how many records are set at once, if the config does not say.
+const defaultConcurrency = 4
+
+// makeSetter makes an IPSetter for the providers named in the given config, which will cache information about records
+// in the given state.
+func makeSetter(config Config, state State) (pinamicdns.IPSetter, error) {
+	entries, err := config.providerEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	options := pinamicdns.SetterOptions{
+		RecordTTL:             config.DNSConfig.TTL,
+		HTTPConfig:            config.HTTPConfig.providerHTTPConfig(),
+		DuplicateRecordPolicy: config.DNSConfig.duplicateRecordPolicy(),
+		ConvergenceCheck:      config.DNSConfig.convergenceCheck(),
+		RecordIDCache:         state,
+		ResponseCache:         state,
+		RetryPolicy:           config.Retry.retryPolicy(),
+	}
+
+	// A single provider of a single record is used directly, so that its access can be checked before it is set. The
+	// record must be the one given by name, as that is the only one that can be passed to SetIP.
+	singleRecord := len(entries) == 1 && len(config.entryRecords(entries[0])) == 1 && len(entries[0].records()) == 0
+	if singleRecord && config.DNSConfig.Name != "" && config.Failover == nil {
+		return pinamicdns.NewSetterFromConfig(entries[0].Provider, entries[0].ProviderConfig, options)
+	}
+
+	setters := make([]pinamicdns.NamedIPSetter, 0, len(entries))
+	for _, entry := range entries {
+		// Every record set with a provider shares its rate limit.
+		var rateLimiter *pinamicdns.RateLimiter
+		if interval := config.entryRequestInterval(entry); interval > 0 {
+			rateLimiter = pinamicdns.NewRateLimiter(interval)
+		}
+
+		// Records with a TTL of their own need a setter of their own, but those with the same TTL can share one.
+		entrySetters := map[int]pinamicdns.IPSetter{}
+		records := config.entryRecords(entry)
+		for _, record := range records {
+			ttl := record.TTL
+			if ttl == 0 {
+				ttl = config.DNSConfig.TTL
+			}
+
+			setter, ok := entrySetters[ttl]
+			if !ok {
+				recordOptions := options
+				recordOptions.RecordTTL = ttl
+				setter, err = pinamicdns.NewSetterFromConfig(entry.Provider, entry.ProviderConfig, recordOptions)
+				if err != nil {
+					return nil, err
+				}
+
+				entrySetters[ttl] = setter
+			}
+
+			namedSetter := pinamicdns.NamedIPSetter{
+				Name:        entry.Name,
+				Setter:      setter,
+				Target:      &pinamicdns.Target{Domain: record.Domain, Name: record.Name},
+				RecordType:  record.Type,
+				RateLimiter: rateLimiter,
+			}
+
+			// Each record needs a name of its own, so that a failure of one can be told apart from the others.
+			if len(records) > 1 {
+				namedSetter.Name = fmt.Sprintf("%s (%s)", entry.Name, recordKey(record.Domain, record.Name))
+			}
+
+			setters = append(setters, namedSetter)
+		}
+	}
+
+	if config.Failover != nil {
+		return pinamicdns.NewFailoverSetter(setters, config.Failover.options()...)
+	}
+
+	workers := config.DNSConfig.Concurrency
+	if workers == 0 {
+		workers = defaultConcurrency
+	}
+
+	return pinamicdns.NewMultiSetter(setters, pinamicdns.MultiSetterWorkers(workers))
+}
+
+// entryRequestInterval gets the least time between requests to the given provider entry.
+func (config Config) entryRequestInterval(entry ProviderEntry) time.Duration {
+	if entry.RequestInterval > 0 {
+		return time.Duration(entry.RequestInterval)
+	}
+
+	return time.Duration(config.DNSConfig.RequestInterval)
+}
+
+// isKnownProvider checks whether or not the given provider name is one that may be specified in the config.
+func isKnownProvider(provider string) bool {
+	for _, knownProvider := range pinamicdns.Providers() {
+		if provider == knownProvider {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults for how often updates may be asked for by the servers, so that a misconfigured router or automation can't
+// get the provider to ban us for making too many calls.
+const (
+	defaultMaxClientRequests   = 10
+	defaultMinHostnameInterval = time.Minute
+	clientRequestWindow        = time.Minute
+)
+
+// requestLimiter limits how many requests may be made for each of several keys, such as the addresses of clients,
+// within each window of time. It is safe for concurrent use.
+type requestLimiter struct {
+	limit  int
+	window time.Duration
+	// mutex guards windows
+	mutex   sync.Mutex
+	windows map[string]limitWindow
+}
+
+// limitWindow is the window of time in which a requestLimiter counts the requests made for a key.
+type limitWindow struct {
+	start    time.Time
+	requests int
+}
+
+// newRequestLimiter makes a new requestLimiter that allows up to the given number of requests for each key within each
+// window of the given length.
+func newRequestLimiter(limit int, window time.Duration) *requestLimiter {
+	return &requestLimiter{limit: limit, window: window, windows: map[string]limitWindow{}}
+}
+
+// allow checks whether or not a request for all of the given keys may be made at the given time, counting it against
+// each of them if so. If not, the time until it may be made is returned, and it is not counted against any of them.
+func (limiter *requestLimiter) allow(now time.Time, keys ...string) (time.Duration, bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	wait := limiter.waitLocked(now, keys)
+	if wait > 0 {
+		return wait, false
+	}
+
+	limiter.countLocked(now, keys)
+
+	return 0, true
+}
+
+// wait gets the time until a request for all of the given keys may be made, as of the given time, which is zero if it
+// may be made now. Unlike allow, the request is not counted against them; that is left to count, for requests that
+// should only be counted once they have been made.
+func (limiter *requestLimiter) wait(now time.Time, keys ...string) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	return limiter.waitLocked(now, keys)
+}
+
+// count counts a request made at the given time against each of the given keys.
+func (limiter *requestLimiter) count(now time.Time, keys ...string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.countLocked(now, keys)
+}
+
+// waitLocked is wait, for when the mutex is already held.
+func (limiter *requestLimiter) waitLocked(now time.Time, keys []string) time.Duration {
+	// Windows that have ended are forgotten, so that a client that goes away is not remembered forever.
+	for key, window := range limiter.windows {
+		if now.Sub(window.start) >= limiter.window {
+			delete(limiter.windows, key)
+		}
+	}
+
+	var wait time.Duration
+	for _, key := range keys {
+		window, ok := limiter.windows[key]
+		if ok && window.requests >= limiter.limit {
+			if keyWait := window.start.Add(limiter.window).Sub(now); keyWait > wait {
+				wait = keyWait
+			}
+		}
+	}
+
+	return wait
+}
+
+// countLocked is count, for when the mutex is already held.
+func (limiter *requestLimiter) countLocked(now time.Time, keys []string) {
+	for _, key := range keys {
+		window, ok := limiter.windows[key]
+		if !ok || now.Sub(window.start) >= limiter.window {
+			window = limitWindow{start: now}
+		}
+
+		window.requests++
+		limiter.windows[key] = window
+	}
+}
+
+// requestClient gets the address of the client that made the given request, which requests are limited by.
+func requestClient(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// setRetryAfter tells the client of the given response to wait for the given time before asking again.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	// Retry-After is given in whole seconds, so the wait is rounded up to not have the client come back too soon.
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
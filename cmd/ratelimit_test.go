@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestLimiterAllow(t *testing.T) {
+	start := time.Date(2026, time.January, 2, 15, 4, 5, 0, time.UTC)
+	type request struct {
+		after    time.Duration
+		keys     []string
+		wantWait time.Duration
+		wantOK   bool
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		requests []request
+	}{
+		{
+			name:  "requests up to the limit are allowed",
+			limit: 2,
+			requests: []request{
+				{keys: []string{"a"}, wantOK: true},
+				{after: 10 * time.Second, keys: []string{"a"}, wantOK: true},
+				{after: 20 * time.Second, keys: []string{"a"}, wantWait: 40 * time.Second},
+			},
+		},
+		{
+			name:  "keys are limited separately",
+			limit: 1,
+			requests: []request{
+				{keys: []string{"a"}, wantOK: true},
+				{keys: []string{"b"}, wantOK: true},
+				{keys: []string{"a"}, wantWait: time.Minute},
+			},
+		},
+		{
+			name:  "requests are allowed again once the window ends",
+			limit: 1,
+			requests: []request{
+				{keys: []string{"a"}, wantOK: true},
+				{after: 59 * time.Second, keys: []string{"a"}, wantWait: time.Second},
+				{after: time.Minute, keys: []string{"a"}, wantOK: true},
+			},
+		},
+		{
+			name:  "a request is refused if any of its keys are limited",
+			limit: 1,
+			requests: []request{
+				{after: 30 * time.Second, keys: []string{"b"}, wantOK: true},
+				{after: 40 * time.Second, keys: []string{"a", "b"}, wantWait: 50 * time.Second},
+				// The refused request must not have counted against a.
+				{after: 40 * time.Second, keys: []string{"a"}, wantOK: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := newRequestLimiter(test.limit, time.Minute)
+			for i, request := range test.requests {
+				wait, ok := limiter.allow(start.Add(request.after), request.keys...)
+				if wait != request.wantWait || ok != request.wantOK {
+					t.Errorf("request %d: got (%s, %t), want (%s, %t)", i, wait, ok, request.wantWait, request.wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLimiterWaitDoesNotCount(t *testing.T) {
+	now := time.Date(2026, time.January, 2, 15, 4, 5, 0, time.UTC)
+	limiter := newRequestLimiter(1, time.Minute)
+	for i := 0; i < 3; i++ {
+		if wait := limiter.wait(now, "a"); wait != 0 {
+			t.Fatalf("got a wait of %s before any request was counted", wait)
+		}
+	}
+
+	limiter.count(now, "a")
+	if wait := limiter.wait(now.Add(15*time.Second), "a"); wait != 45*time.Second {
+		t.Errorf("got a wait of %s after a request was counted, want 45s", wait)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+// durationType is the type of config fields that are given as durations, such as "5m".
+var durationType = reflect.TypeOf(pinamicdns.Duration(0))
+
+// unmarshalerType is the type of values that decode themselves from JSON, which are checked as a whole.
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// decodeConfig decodes the given JSON into the given Config. Unlike json.Unmarshal, fields that the config does not
+// have are rejected, and errors name the JSON path of the field that is wrong, such as dns_config.records[1].ttl, so
+// that typos are caught before they get as far as a provider.
+func decodeConfig(rawConfig []byte, config *Config) error {
+	var value interface{}
+	err := json.Unmarshal(rawConfig, &value)
+	if err != nil {
+		return describeSyntaxError(rawConfig, err)
+	}
+
+	err = checkConfigJSON(rawConfig, "", reflect.TypeOf(*config))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawConfig))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(config)
+}
+
+// describeSyntaxError describes where in the given JSON the given error occurred, if it is a syntax error, so that it
+// can be found in the config file.
+func describeSyntaxError(rawConfig []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+
+	before := rawConfig[:syntaxErr.Offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return fmt.Errorf("invalid JSON at line %d, column %d: %w", line, column, err)
+}
+
+// checkConfigJSON checks that the given JSON can be decoded into a value of the given type, returning an error that
+// names the given path, or the path of the field beneath it, that can't be.
+func checkConfigJSON(rawValue json.RawMessage, path string, valueType reflect.Type) error {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+
+	if bytes.Equal(bytes.TrimSpace(rawValue), []byte("null")) {
+		return nil
+	} else if reflect.PtrTo(valueType).Implements(unmarshalerType) {
+		return checkConfigValue(rawValue, path, valueType)
+	}
+
+	switch valueType.Kind() {
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(rawValue, &fields)
+		if err != nil {
+			return fmt.Errorf("%s must be an object", describePath(path))
+		}
+
+		for name, rawField := range fields {
+			field, ok := jsonField(valueType, name)
+			if !ok {
+				return unknownFieldError(joinPath(path, name), valueType)
+			}
+
+			err := checkConfigJSON(rawField, joinPath(path, name), field.Type)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		var elements []json.RawMessage
+		err := json.Unmarshal(rawValue, &elements)
+		if err != nil {
+			return fmt.Errorf("%s must be a list", describePath(path))
+		}
+
+		for i, rawElement := range elements {
+			err := checkConfigJSON(rawElement, fmt.Sprintf("%s[%d]", path, i), valueType.Elem())
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var values map[string]json.RawMessage
+		err := json.Unmarshal(rawValue, &values)
+		if err != nil {
+			return fmt.Errorf("%s must be an object", describePath(path))
+		}
+
+		for key, rawElement := range values {
+			err := checkConfigJSON(rawElement, joinPath(path, key), valueType.Elem())
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		// Anything can be decoded into an interface.
+	default:
+		return checkConfigValue(rawValue, path, valueType)
+	}
+
+	return nil
+}
+
+// checkConfigValue checks that the given JSON can be decoded into a single value of the given type, returning an error
+// that names the given path if it can't be.
+func checkConfigValue(rawValue json.RawMessage, path string, valueType reflect.Type) error {
+	err := json.Unmarshal(rawValue, reflect.New(valueType).Interface())
+	if err == nil {
+		return nil
+	} else if valueType == durationType {
+		return fmt.Errorf(`%s must be a duration, such as "5m" or "1h30m"`, describePath(path))
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return fmt.Errorf("%s is invalid: %w", describePath(path), err)
+	}
+
+	switch valueType.Kind() {
+	case reflect.String:
+		return fmt.Errorf("%s must be a string, not %s", describePath(path), typeErr.Value)
+	case reflect.Bool:
+		return fmt.Errorf("%s must be true or false, not %s", describePath(path), typeErr.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Errorf("%s must be a whole number, not %s", describePath(path), typeErr.Value)
+	default:
+		return fmt.Errorf("%s must not be %s", describePath(path), typeErr.Value)
+	}
+}
+
+// unknownFieldError makes the error for a field at the given path that the struct type it is in does not have,
+// suggesting the field that was most likely meant, if any is close enough.
+func unknownFieldError(path string, structType reflect.Type) error {
+	name := path[strings.LastIndexAny(path, ".]")+1:]
+	suggestion := ""
+	bestDistance := len(name)/3 + 1
+	for _, fieldName := range jsonFieldNames(structType) {
+		distance := editDistance(strings.ToLower(name), fieldName)
+		if distance <= bestDistance {
+			suggestion, bestDistance = fieldName, distance
+		}
+	}
+
+	if suggestion == "" {
+		return fmt.Errorf("%s is not a config field", path)
+	}
+
+	return fmt.Errorf("%s is not a config field; did you mean %s?", path, joinPath(path[:len(path)-len(name)], suggestion))
+}
+
+// jsonFieldNames gets the names of each of the JSON fields that the given struct type is decoded from, including those
+// of any embedded structs.
+func jsonFieldNames(structType reflect.Type) []string {
+	names := []string{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tagName := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if tagName != "" && tagName != "-" {
+			names = append(names, tagName)
+		} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFieldNames(field.Type)...)
+		}
+	}
+
+	return names
+}
+
+// editDistance gets the number of single character insertions, deletions, and substitutions that it takes to turn one
+// of the given strings into the other.
+func editDistance(a, b string) int {
+	previousRow := make([]int, len(b)+1)
+	for j := range previousRow {
+		previousRow[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		row := make([]int, len(b)+1)
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previousRow[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+
+			row[j] = minInt(substitution, minInt(previousRow[j]+1, row[j-1]+1))
+		}
+
+		previousRow = row
+	}
+
+	return previousRow[len(b)]
+}
+
+// minInt gets the lesser of the given integers.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// joinPath gets the JSON path of the field with the given name within the object at the given path.
+func joinPath(path, name string) string {
+	if path == "" || strings.HasSuffix(path, ".") {
+		return path + name
+	}
+
+	return path + "." + name
+}
+
+// describePath describes the JSON path of a value in errors, which is empty for the config as a whole.
+func describePath(path string) string {
+	if path == "" {
+		return "config"
+	}
+
+	return path
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckConfigJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:   "a valid config",
+			config: `{"dns_config": {"domain": "example.com", "records": [{"name": "home", "ttl": 300}]}}`,
+		},
+		{
+			name:   "null values are allowed",
+			config: `{"failover": null, "dns_config": {"records": null}}`,
+		},
+		{
+			name:   "provider_config is left to the provider",
+			config: `{"provider_config": {"anything": ["at", "all"]}}`,
+		},
+		{
+			name:    "a misspelled field is suggested",
+			config:  `{"dns_config": {"domian": "example.com"}}`,
+			wantErr: "dns_config.domian is not a config field; did you mean dns_config.domain?",
+		},
+		{
+			name:    "an unknown field with nothing close",
+			config:  `{"widgets": 3}`,
+			wantErr: "widgets is not a config field",
+		},
+		{
+			name:    "a misspelled field in a list names its element",
+			config:  `{"dns_config": {"records": [{"name": "home"}, {"nmae": "vpn"}]}}`,
+			wantErr: "dns_config.records[1].nmae is not a config field; did you mean dns_config.records[1].name?",
+		},
+		{
+			name:    "a value of the wrong type",
+			config:  `{"dns_config": {"records": [{"ttl": "300"}]}}`,
+			wantErr: "dns_config.records[0].ttl must be a whole number, not string",
+		},
+		{
+			name:    "a malformed duration",
+			config:  `{"daemon": {"interval": "ten minutes"}}`,
+			wantErr: `daemon.interval must be a duration, such as "5m" or "1h30m"`,
+		},
+		{
+			name:    "an object where a list is expected",
+			config:  `{"dns_config": {"names": {"home": true}}}`,
+			wantErr: "dns_config.names must be a list",
+		},
+		{
+			name:    "the config as a whole must be an object",
+			config:  `[]`,
+			wantErr: "config must be an object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkConfigJSON([]byte(test.config), "", reflect.TypeOf(Config{}))
+			if test.wantErr == "" && err != nil {
+				t.Errorf("got error %q, want none", err)
+			} else if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Errorf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnknownFieldError(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "dns_config.TTL", want: "dns_config.TTL is not a config field; did you mean dns_config.ttl?"},
+		{path: "dns_config.record", want: "dns_config.record is not a config field; did you mean dns_config.records?"},
+		{path: "dns_config.x", want: "dns_config.x is not a config field"},
+		{path: "dns_config.zone", want: "dns_config.zone is not a config field"},
+	}
+
+	for _, test := range tests {
+		err := unknownFieldError(test.path, reflect.TypeOf(DNSConfig{}))
+		if err.Error() != test.want {
+			t.Errorf("%s: got %q, want %q", test.path, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// accessTokenCommandTimeout is how long the command given by access_token_cmd may run, such as while a password
+// manager waits to be unlocked, before it is killed.
+const accessTokenCommandTimeout = time.Minute
+
+// maxAccessTokenCommandErrorSize is the maximum number of bytes of the stderr of the command given by access_token_cmd
+// that will be included in an error.
+const maxAccessTokenCommandErrorSize = 1024
+
+// errConflictingAccessTokens is returned when more than one way of giving an access token is used at once.
+var errConflictingAccessTokens = errors.New(
+	"only one of access_token, access_token_file, access_token_env, access_token_cmd, and access_token_keyring " +
+		"may be given",
+)
+
+// loadAccessTokens reads the access tokens that the config gives with access_token_file, access_token_env,
+// access_token_cmd, or access_token_keyring, whether at the top level or in a provider_config, into their access_token,
+// so that the secrets need not be kept in the config. Tokens in the keyring are stored under the name of the provider
+// they are for.
+func (config *Config) loadAccessTokens() error {
+	keyringName := ""
+	if config.AccessTokenKeyring {
+		keyringName = config.provider()
+	}
+
+	token, err := readAccessToken(config.AccessTokenFile, config.AccessTokenEnv, config.AccessTokenCmd, keyringName)
+	if err != nil {
+		return err
+	} else if token != "" && config.AccessToken != "" {
+		return errConflictingAccessTokens
+	} else if token != "" {
+		config.AccessToken = token
+	}
+
+	config.ProviderConfig, err = loadProviderAccessToken(config.ProviderConfig, config.provider())
+	if err != nil {
+		return fmt.Errorf("provider_config: %w", err)
+	}
+
+	for i, entry := range config.Providers {
+		name := entry.Name
+		if name == "" {
+			name = entry.Provider
+		}
+
+		config.Providers[i].ProviderConfig, err = loadProviderAccessToken(entry.ProviderConfig, name)
+		if err != nil {
+			return fmt.Errorf("provider_config of %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// loadProviderAccessToken reads the access token that the given provider_config gives with access_token_file,
+// access_token_env, access_token_cmd, or access_token_keyring, if any, and gives the provider_config with it as its
+// access_token instead. A token in the keyring is read from under the given name of the provider.
+func loadProviderAccessToken(providerConfig json.RawMessage, providerName string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(providerConfig, &fields)
+	if len(providerConfig) == 0 || err != nil {
+		// Any problem with the provider_config itself is for the provider to report.
+		return providerConfig, nil
+	}
+
+	var path, variable, command string
+	sourceFields := map[string]*string{
+		"access_token_file": &path,
+		"access_token_env":  &variable,
+		"access_token_cmd":  &command,
+	}
+	for field, value := range sourceFields {
+		if len(fields[field]) == 0 {
+			continue
+		}
+
+		err := json.Unmarshal(fields[field], value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a string", field)
+		}
+
+		delete(fields, field)
+	}
+
+	keyringName := ""
+	if len(fields["access_token_keyring"]) > 0 {
+		var useKeyring bool
+		err := json.Unmarshal(fields["access_token_keyring"], &useKeyring)
+		if err != nil {
+			return nil, errors.New("access_token_keyring must be true or false")
+		} else if useKeyring {
+			keyringName = providerName
+		}
+
+		delete(fields, "access_token_keyring")
+	}
+
+	token, err := readAccessToken(path, variable, command, keyringName)
+	if err != nil {
+		return nil, err
+	} else if token == "" {
+		return json.Marshal(fields)
+	} else if _, ok := fields["access_token"]; ok {
+		return nil, errConflictingAccessTokens
+	}
+
+	fields["access_token"], err = json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
+
+// readAccessToken reads an access token from the file at the given path, from the environment variable with the given
+// name, from the output of the given command, or from the keyring under the given name, whichever is given.
+// Environment variables in the path are expanded, so that systemd credentials can be read from $CREDENTIALS_DIRECTORY.
+// If none is given, the token is empty.
+func readAccessToken(path string, variable string, command string, keyringName string) (string, error) {
+	given := 0
+	for _, source := range []string{path, variable, command, keyringName} {
+		if source != "" {
+			given++
+		}
+	}
+
+	switch {
+	case given > 1:
+		return "", errors.New(
+			"only one of access_token_file, access_token_env, access_token_cmd, and access_token_keyring may be given",
+		)
+	case path != "":
+		path = os.ExpandEnv(path)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read access_token_file: %w", err)
+		}
+
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("access_token_file %s is empty", path)
+		}
+
+		return token, nil
+	case variable != "":
+		token := strings.TrimSpace(os.Getenv(variable))
+		if token == "" {
+			return "", fmt.Errorf("access_token_env %s is not set", variable)
+		}
+
+		return token, nil
+	case command != "":
+		token, err := runAccessTokenCommand(command)
+		if err != nil {
+			return "", fmt.Errorf("could not run access_token_cmd: %w", err)
+		}
+
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return "", fmt.Errorf("access_token_cmd %q printed nothing", command)
+		}
+
+		return token, nil
+	case keyringName != "":
+		token, err := readKeyringToken(keyringName)
+		if err != nil {
+			return "", fmt.Errorf("could not read access token for %s from the keyring: %w", keyringName, err)
+		}
+
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return "", fmt.Errorf("access token for %s in the keyring is empty", keyringName)
+		}
+
+		return token, nil
+	default:
+		return "", nil
+	}
+}
+
+// runAccessTokenCommand runs the given command with the shell, as given by access_token_cmd, and gets what it writes to
+// stdout. stdin is passed through, so that a password manager can ask to be unlocked, but its stderr is only included
+// in any error, which never includes its stdout, as that may hold part of the token.
+func runAccessTokenCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), accessTokenCommandTimeout)
+	defer cancel()
+
+	shell, shellArgs := "sh", []string{"-c", command}
+	if runtime.GOOS == "windows" {
+		shell, shellArgs = "cmd", []string{"/C", command}
+	}
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, shell, shellArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%q did not finish within %s", command, accessTokenCommandTimeout)
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > maxAccessTokenCommandErrorSize {
+			message = message[:maxAccessTokenCommandErrorSize] + "..."
+		}
+
+		if message == "" {
+			return "", fmt.Errorf("%q exited with status %d", command, exitErr.ExitCode())
+		}
+
+		return "", fmt.Errorf("%q exited with status %d: %s", command, exitErr.ExitCode(), message)
+	} else if err != nil {
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
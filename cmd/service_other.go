@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// errServiceUnsupported is returned when running as a Windows service is asked for on another platform.
+var errServiceUnsupported = errors.New("running as a service is only supported on Windows")
+
+// runServiceCommand would manage the Windows service, but this is only supported on Windows.
+func runServiceCommand(args []string, options commandOptions) error {
+	return errServiceUnsupported
+}
+
+// runningAsService checks whether or not this process was started by the Windows service manager, which it never is
+// on this platform.
+func runningAsService() bool {
+	return false
+}
+
+// runService would run the given function as a Windows service, but this is only supported on Windows.
+func runService(run func(ctx context.Context) bool) error {
+	return errServiceUnsupported
+}
+
+// openServiceLog would open the Windows event log, but this is only supported on Windows.
+func openServiceLog() (io.WriteCloser, error) {
+	return nil, errServiceUnsupported
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name that pinamic-dns is installed as with the Windows service manager, and logs to the event log
+// under.
+const serviceName = "pinamic-dns"
+
+// serviceStopTimeout is how long the stop action waits for the service to stop.
+const serviceStopTimeout = 30 * time.Second
+
+// serviceRestartDelay is how long the service manager waits to restart the service if it fails.
+const serviceRestartDelay = time.Minute
+
+// serviceHandler runs the daemon for the Windows service manager, until it is asked to stop.
+type serviceHandler struct {
+	run func(ctx context.Context) bool
+}
+
+// eventLogWriter is an io.Writer that writes each line it is given to the Windows event log.
+type eventLogWriter struct {
+	log *eventlog.Log
+}
+
+// runServiceCommand installs, uninstalls, starts, or stops the Windows service, in correspondence with the given
+// arguments. The service is installed to run the daemon with the config and state files given in the given options.
+func runServiceCommand(args []string, options commandOptions) error {
+	if len(args) != 1 {
+		return errors.New("usage: service install|uninstall|start|stop")
+	}
+
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to the service manager: %w", err)
+	}
+
+	defer manager.Disconnect()
+	switch args[0] {
+	case "install":
+		return installService(manager, options)
+	case "uninstall":
+		return uninstallService(manager)
+	case "start":
+		return startService(manager)
+	case "stop":
+		return stopService(manager)
+	default:
+		return fmt.Errorf("unknown service action %q; must be install, uninstall, start, or stop", args[0])
+	}
+}
+
+// installService installs the service with the given manager, so that it runs the daemon when Windows starts, with
+// the config and state files given in the given options.
+func installService(manager *mgr.Mgr, options commandOptions) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find pinamic-dns executable: %w", err)
+	}
+
+	// The service manager starts services in the system directory, so relative paths would not be found.
+	serviceArgs := []string{"run"}
+	for _, flag := range []struct{ name, path string }{
+		{"--config", options.configPath},
+		{"--statefile", options.statePath},
+		{"--logfile", options.logFilePath},
+	} {
+		if flag.path == "" {
+			continue
+		}
+
+		absPath, err := filepath.Abs(flag.path)
+		if err != nil {
+			return fmt.Errorf("could not find %s: %w", flag.path, err)
+		}
+
+		serviceArgs = append(serviceArgs, flag.name+"="+absPath)
+	}
+
+	service, err := manager.OpenService(serviceName)
+	if err == nil {
+		service.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+
+	service, err = manager.CreateService(serviceName, exePath, mgr.Config{
+		DisplayName: serviceName,
+		Description: "Keeps DNS records pointed at this machine's IP address",
+		StartType:   mgr.StartAutomatic,
+	}, serviceArgs...)
+	if err != nil {
+		return fmt.Errorf("could not install service: %w", err)
+	}
+
+	defer service.Close()
+	err = service.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: serviceRestartDelay}}, 0)
+	if err != nil {
+		service.Delete()
+		return fmt.Errorf("could not set service to restart on failure: %w", err)
+	}
+
+	err = eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		service.Delete()
+		return fmt.Errorf("could not install event log source: %w", err)
+	}
+
+	return nil
+}
+
+// uninstallService removes the service from the given manager, along with its event log source.
+func uninstallService(manager *mgr.Mgr) error {
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+
+	defer service.Close()
+	err = service.Delete()
+	if err != nil {
+		return fmt.Errorf("could not uninstall service: %w", err)
+	}
+
+	err = eventlog.Remove(serviceName)
+	if err != nil {
+		return fmt.Errorf("could not remove event log source: %w", err)
+	}
+
+	return nil
+}
+
+// startService asks the given manager to start the service.
+func startService(manager *mgr.Mgr) error {
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+
+	defer service.Close()
+	err = service.Start()
+	if err != nil {
+		return fmt.Errorf("could not start service: %w", err)
+	}
+
+	return nil
+}
+
+// stopService asks the given manager to stop the service, and waits for it to do so.
+func stopService(manager *mgr.Mgr) error {
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+
+	defer service.Close()
+	status, err := service.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("could not stop service: %w", err)
+	}
+
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop within %s", serviceStopTimeout)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+		status, err = service.Query()
+		if err != nil {
+			return fmt.Errorf("could not query service status: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// runningAsService checks whether or not this process was started by the Windows service manager.
+func runningAsService() bool {
+	isService, err := svc.IsWindowsService()
+
+	return err == nil && isService
+}
+
+// runService runs the given function for the Windows service manager, which it must have started this process. The
+// function is given a context that is cancelled once the service is asked to stop, and returns whether or not it was
+// interrupted by this, in which case the service reports that it failed.
+func runService(run func(ctx context.Context) bool) error {
+	return svc.Run(serviceName, serviceHandler{run: run})
+}
+
+// Execute runs the handler's function until it finishes, or the service manager asks for it to stop.
+// Required for serviceHandler to implement svc.Handler
+func (handler serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, statuses chan<- svc.Status) (bool, uint32) {
+	statuses <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- handler.run(ctx)
+	}()
+
+	statuses <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case interrupted := <-done:
+			statuses <- svc.Status{State: svc.StopPending}
+			if interrupted {
+				return true, 1
+			}
+
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				statuses <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				statuses <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// openServiceLog opens the event log that the service logs to.
+func openServiceLog() (io.WriteCloser, error) {
+	log, err := eventlog.Open(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return eventLogWriter{log: log}, nil
+}
+
+// Write writes the given log output to the event log.
+func (writer eventLogWriter) Write(p []byte) (int, error) {
+	err := writer.log.Info(1, strings.TrimSuffix(string(p), "\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the event log.
+func (writer eventLogWriter) Close() error {
+	return writer.log.Close()
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+)
+
+const defaultStatePath = "./state.json"
+
+// State holds information about previous runs that is persisted between them.
+type State struct {
+	Records map[string]RecordState `json:"records"`
+	// ObservedIP is a newly detected IPv4 address that is awaiting confirmation by consecutive checks.
+	ObservedIP string `json:"observed_ip,omitempty"`
+	// ObservedChecks is the number of consecutive checks ObservedIP has been detected on.
+	ObservedChecks int `json:"observed_checks,omitempty"`
+	// ObservedIPv6 is a newly detected IPv6 address that is awaiting confirmation by consecutive checks.
+	ObservedIPv6 string `json:"observed_ipv6,omitempty"`
+	// ObservedIPv6Checks is the number of consecutive checks ObservedIPv6 has been detected on.
+	ObservedIPv6Checks int `json:"observed_ipv6_checks,omitempty"`
+	// Responses holds cached responses from the provider's API, keyed by request URL.
+	Responses map[string]pinamicdns.CachedResponse `json:"responses,omitempty"`
+	// ProviderFailures is the number of consecutive runs on which the provider could not be updated.
+	ProviderFailures int `json:"provider_failures,omitempty"`
+	// CircuitOpenUntil is the time until which no further attempts to update the provider should be made.
+	CircuitOpenUntil time.Time `json:"circuit_open_until"`
+	// DetectedIPs are the IP addresses that were last detected, which may be used again until the recheck interval
+	// has passed since DetectedAt.
+	DetectedIPs []string `json:"detected_ips,omitempty"`
+	// DetectedAt is the time at which DetectedIPs were detected.
+	DetectedAt time.Time `json:"detected_at"`
+	// LastWriteAt is the time at which the provider was last asked to update the records, whether or not it succeeded.
+	LastWriteAt time.Time `json:"last_write_at"`
+	// cacheLock guards the record IDs and responses, which the setters of several records that are set at once may
+	// use together. It is shared by every copy of the state.
+	cacheLock *sync.Mutex
+}
+
+// RecordState holds information about a single record that was previously set.
+type RecordState struct {
+	// IP is the last IPv4 address that was successfully set for the record.
+	IP string `json:"ip"`
+	// IPv6 is the last IPv6 address that was successfully set for the record.
+	IPv6 string `json:"ipv6,omitempty"`
+	// TTL is the TTL that the record was last successfully set with.
+	TTL int `json:"ttl,omitempty"`
+	// RecordTTLs are the TTLs that any of the records stored together were last successfully set with, if they have
+	// their own, rather than TTL.
+	RecordTTLs map[string]int `json:"record_ttls,omitempty"`
+	// UpdatedAt is the time at which the record was last successfully set with the provider.
+	UpdatedAt time.Time `json:"updated_at"`
+	// RecordIDs holds the IDs the provider has assigned to the record, keyed by record type.
+	RecordIDs map[string]string `json:"record_ids,omitempty"`
+}
+
+// LoadState reads the state file located at filepath. If no such file exists, an empty State is returned.
+func LoadState(filepath string) (State, error) {
+	state := State{
+		Records:   map[string]RecordState{},
+		Responses: map[string]pinamicdns.CachedResponse{},
+		cacheLock: &sync.Mutex{},
+	}
+
+	stateReader, err := os.Open(filepath)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return State{}, err
+	}
+
+	defer stateReader.Close()
+
+	stateDecoder := json.NewDecoder(stateReader)
+	err = stateDecoder.Decode(&state)
+	if err != nil {
+		return State{}, err
+	}
+
+	if state.Records == nil {
+		state.Records = map[string]RecordState{}
+	}
+
+	if state.Responses == nil {
+		state.Responses = map[string]pinamicdns.CachedResponse{}
+	}
+
+	return state, nil
+}
+
+// Save writes the state to the file located at filepath. The file is replaced atomically, so a failure part way through
+// will leave the previous state intact.
+func (state State) Save(filepath string) error {
+	return writeFileAtomic(filepath, 0644, func(stateWriter io.Writer) error {
+		stateEncoder := json.NewEncoder(stateWriter)
+		stateEncoder.SetIndent("", "\t")
+
+		return stateEncoder.Encode(state)
+	})
+}
+
+// RecordID gets the ID of the record with the given domain, subdomain name, and record type, if one is held in the
+// state.
+// Required for State to implement pinamicdns.RecordIDCache
+func (state State) RecordID(domain, name, recordType string) (string, bool) {
+	defer state.lockCache()()
+	id, ok := state.Records[recordKey(domain, name)].RecordIDs[recordType]
+
+	return id, ok
+}
+
+// SetRecordID stores the ID of the record with the given domain, subdomain name, and record type in the state.
+// Required for State to implement pinamicdns.RecordIDCache
+func (state State) SetRecordID(domain, name, recordType, id string) {
+	defer state.lockCache()()
+	key := recordKey(domain, name)
+	recordState := state.Records[key]
+	if recordState.RecordIDs == nil {
+		recordState.RecordIDs = map[string]string{}
+	}
+
+	recordState.RecordIDs[recordType] = id
+	state.Records[key] = recordState
+}
+
+// CachedResponse gets the provider response stored under the given key, if one is held in the state.
+// Required for State to implement pinamicdns.ResponseCache
+func (state State) CachedResponse(key string) (pinamicdns.CachedResponse, bool) {
+	defer state.lockCache()()
+	response, ok := state.Responses[key]
+
+	return response, ok
+}
+
+// SetCachedResponse stores the given provider response under the given key in the state.
+// Required for State to implement pinamicdns.ResponseCache
+func (state State) SetCachedResponse(key string, response pinamicdns.CachedResponse) {
+	defer state.lockCache()()
+	state.Responses[key] = response
+}
+
+// lockCache locks the state's caches, if it was loaded with its lock, and gives a function that unlocks them.
+func (state State) lockCache() func() {
+	if state.cacheLock == nil {
+		return func() {}
+	}
+
+	state.cacheLock.Lock()
+
+	return state.cacheLock.Unlock
+}
+
+// publishedIP gets the IP that was last set for the records stored under the given key, of the same version as the
+// given IP.
+func (state State) publishedIP(key string, ip net.IP) string {
+	if ip.To4() == nil {
+		return state.Records[key].IPv6
+	}
+
+	return state.Records[key].IP
+}
+
+// setPublishedIP notes that the given IP has been set for the records stored under the given key.
+func (state State) setPublishedIP(key string, ip net.IP) {
+	recordState := state.Records[key]
+	if ip.To4() == nil {
+		recordState.IPv6 = ip.String()
+	} else {
+		recordState.IP = ip.String()
+	}
+
+	state.Records[key] = recordState
+}
+
+// observeIP notes that the given IP has been detected, and returns the number of consecutive checks it has been detected
+// on, including this one. IPv4 and IPv6 addresses are counted separately.
+func (state *State) observeIP(ip net.IP) int {
+	observedIP, observedChecks := &state.ObservedIP, &state.ObservedChecks
+	if ip.To4() == nil {
+		observedIP, observedChecks = &state.ObservedIPv6, &state.ObservedIPv6Checks
+	}
+
+	if *observedIP == ip.String() {
+		*observedChecks++
+	} else {
+		*observedIP = ip.String()
+		*observedChecks = 1
+	}
+
+	return *observedChecks
+}
+
+// clearObservedIP forgets any IP of the same version as the given IP that is awaiting confirmation. It returns whether
+// or not there was one to forget.
+func (state *State) clearObservedIP(ip net.IP) bool {
+	observedIP, observedChecks := &state.ObservedIP, &state.ObservedChecks
+	if ip.To4() == nil {
+		observedIP, observedChecks = &state.ObservedIPv6, &state.ObservedIPv6Checks
+	}
+
+	hadObservedIP := *observedIP != ""
+	*observedIP = ""
+	*observedChecks = 0
+
+	return hadObservedIP
+}
+
+// detectionFresh checks whether or not the IPs that were last detected may still be used, as the given recheck interval
+// has not yet passed since they were detected.
+func (state State) detectionFresh(now time.Time, recheckInterval time.Duration) bool {
+	return len(state.DetectedIPs) > 0 && now.Before(state.DetectedAt.Add(recheckInterval))
+}
+
+// detectedIPs gets the IPs that were last detected.
+func (state State) detectedIPs() []net.IP {
+	ips := make([]net.IP, 0, len(state.DetectedIPs))
+	for _, rawIP := range state.DetectedIPs {
+		ip := net.ParseIP(rawIP)
+		if ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+}
+
+// setDetectedIPs notes that the given IPs were detected at the given time, so that they may be used again until the
+// recheck interval passes.
+func (state *State) setDetectedIPs(ips []net.IP, now time.Time) {
+	state.DetectedIPs = make([]string, len(ips))
+	for i, ip := range ips {
+		state.DetectedIPs[i] = ip.String()
+	}
+
+	state.DetectedAt = now
+}
+
+// clearDetectedIPs forgets the IPs that were last detected, so that they are detected again next time. It returns
+// whether or not there were any to forget.
+func (state *State) clearDetectedIPs() bool {
+	hadDetectedIPs := len(state.DetectedIPs) > 0
+	state.DetectedIPs = nil
+	state.DetectedAt = time.Time{}
+
+	return hadDetectedIPs
+}
+
+// circuitOpen checks whether or not attempts to update the provider are currently paused.
+func (state State) circuitOpen(now time.Time) bool {
+	return now.Before(state.CircuitOpenUntil)
+}
+
+// recordProviderFailure notes that the provider could not be updated. If this failure brings the number of consecutive
+// failures to the given threshold, updates are paused for the given cooldown, and true is returned.
+func (state *State) recordProviderFailure(now time.Time, threshold int, cooldown time.Duration) bool {
+	state.ProviderFailures++
+	if state.ProviderFailures < threshold {
+		return false
+	}
+
+	state.CircuitOpenUntil = now.Add(cooldown)
+
+	return true
+}
+
+// recordProviderSuccess notes that the provider was updated, resetting any failure count.
+func (state *State) recordProviderSuccess() {
+	state.ProviderFailures = 0
+	state.CircuitOpenUntil = time.Time{}
+}
+
+// writesHeldUntil gets the time until which the provider should not be written to again, if writes must be at least the
+// given interval apart.
+func (state State) writesHeldUntil(minInterval time.Duration) time.Time {
+	return state.LastWriteAt.Add(minInterval)
+}
+
+// recordKey gets the key that the state for the record with the given domain and subdomain name is stored under.
+func recordKey(domain, name string) string {
+	return name + "." + domain
+}
+
+// configStateKey gets the key that the state of the given config's records, as a whole, is stored under. A config with
+// a single record uses that record's key, but one with several records combines all of their keys, so that a record
+// being added to the config is not mistaken for one that has already been set.
+func configStateKey(config Config) (string, error) {
+	records, err := configRecords(config)
+	if err != nil {
+		return "", err
+	}
+
+	keys := []string{}
+	seenKeys := map[string]bool{}
+	for _, record := range records {
+		key := recordKey(record.Domain, record.Name)
+		if !seenKeys[key] {
+			keys = append(keys, key)
+			seenKeys[key] = true
+		}
+	}
+
+	sort.Strings(keys)
+
+	return strings.Join(keys, ","), nil
+}
+
+// configRecords gets every record that the given config sets, with each of its providers.
+func configRecords(config Config) ([]RecordConfig, error) {
+	entries, err := config.providerEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []RecordConfig{}
+	for _, entry := range entries {
+		records = append(records, config.entryRecords(entry)...)
+	}
+
+	return records, nil
+}
+
+// recordTTLs gets the TTLs of those of the given records that have their own, keyed by the keys of the records.
+func recordTTLs(records []RecordConfig) map[string]int {
+	ttls := map[string]int{}
+	for _, record := range records {
+		if record.TTL != 0 {
+			ttls[recordKey(record.Domain, record.Name)] = record.TTL
+		}
+	}
+
+	if len(ttls) == 0 {
+		return nil
+	}
+
+	return ttls
+}
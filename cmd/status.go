@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Results that a record may have in the status file
+const (
+	recordUnchanged = "unchanged"
+	recordUpdated   = "updated"
+	// recordWaiting is the result of a record whose new address has not yet been seen enough times in a row.
+	recordWaiting = "waiting"
+	// recordPaused is the result of a record that was not updated because the circuit breaker is open.
+	recordPaused = "paused"
+	// recordHeld is the result of a record that was not updated because the provider was written to too recently.
+	recordHeld   = "held"
+	recordFailed = "failed"
+)
+
+// runStatus collects what happened during an update, so that it can be written to the status file.
+type runStatus struct {
+	detectedIPs []net.IP
+	records     []recordStatus
+	// heldUntil is the time until which updates to the records were held back, if they were.
+	heldUntil time.Time
+	// recordTypes are the types that the records are limited to, as given by recordTypes. Results are only recorded
+	// for the types of record that are set.
+	recordTypes map[string]string
+}
+
+// statusFile is the contents of the status file.
+type statusFile struct {
+	Time        time.Time      `json:"time"`
+	DetectedIPs []string       `json:"detected_ips"`
+	Records     []recordStatus `json:"records"`
+	// LastError is the reason the update failed, if it did.
+	LastError *string `json:"last_error"`
+}
+
+// recordStatus is the result of updating a single record to a single address.
+type recordStatus struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	IP     string `json:"ip"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// addRecords records the given result, and the error that caused it, if any, for the given address of each of the
+// records stored under the given state key.
+func (status *runStatus) addRecords(stateKey string, ip net.IP, result string, err error) {
+	recordType := ipRecordType(ip)
+	for _, name := range strings.Split(stateKey, ",") {
+		if limitedType := status.recordTypes[name]; limitedType != "" && limitedType != recordType {
+			continue
+		}
+
+		record := recordStatus{Name: name, Type: recordType, IP: ip.String(), Result: result}
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		status.records = append(status.records, record)
+	}
+}
+
+// ipRecordType gets the type of record that the given address is set in.
+func ipRecordType(ip net.IP) string {
+	if ip.To4() == nil {
+		return "AAAA"
+	}
+
+	return "A"
+}
+
+// recordTypes gets the type that each of the given records is limited to, keyed by the keys of the records. A record
+// that is set as both A and AAAA records, by any of the providers that set it, has an empty type.
+func recordTypes(records []RecordConfig) map[string]string {
+	types := map[string]string{}
+	for _, record := range records {
+		key := recordKey(record.Domain, record.Name)
+		limitedType, ok := types[key]
+		if !ok {
+			types[key] = record.Type
+		} else if limitedType != record.Type {
+			types[key] = ""
+		}
+	}
+
+	return types
+}
+
+// writeStatusFile writes the given status of the update that finished at the given time, with the given error, if it
+// failed, to the status file at the given path.
+func writeStatusFile(path string, status runStatus, err error, now time.Time) error {
+	contents := statusFile{Time: now, DetectedIPs: []string{}, Records: status.records}
+	for _, ip := range status.detectedIPs {
+		contents.DetectedIPs = append(contents.DetectedIPs, ip.String())
+	}
+
+	if contents.Records == nil {
+		contents.Records = []recordStatus{}
+	}
+
+	if err != nil {
+		lastErr := err.Error()
+		contents.LastError = &lastErr
+	}
+
+	return writeFileAtomic(path, 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+
+		return encoder.Encode(contents)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// systemdNotifier sends notifications to systemd about the state of the daemon, if it was started by systemd with a
+// notification socket, such as for a service with Type=notify. Otherwise, notifications are silently dropped.
+type systemdNotifier struct {
+	socket string
+	// watchdogInterval is how often systemd expects WATCHDOG=1 notifications, or zero if its watchdog is not enabled.
+	watchdogInterval time.Duration
+	logger           *log.Logger
+}
+
+// newSystemdNotifier makes a new systemdNotifier from the environment that systemd gave this process. Any failure to
+// notify systemd is logged to the given logger.
+func newSystemdNotifier(logger *log.Logger) systemdNotifier {
+	notifier := systemdNotifier{socket: os.Getenv("NOTIFY_SOCKET"), logger: logger}
+	if notifier.socket == "" {
+		return notifier
+	}
+
+	// The watchdog may be meant for another process, such as when this one was started by a wrapper script.
+	watchdogPID := os.Getenv("WATCHDOG_PID")
+	watchdogUsec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err == nil && watchdogUsec > 0 && (watchdogPID == "" || watchdogPID == strconv.Itoa(os.Getpid())) {
+		notifier.watchdogInterval = time.Duration(watchdogUsec) * time.Microsecond
+	}
+
+	return notifier
+}
+
+// notify sends the given notification to systemd, such as READY=1.
+func (notifier systemdNotifier) notify(notification string) {
+	if notifier.socket == "" {
+		return
+	}
+
+	socket := notifier.socket
+	if socket[0] == '@' {
+		// Sockets beginning with @ are in the abstract namespace, that Go represents with a leading null byte.
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		notifier.logger.Printf("Could not notify systemd: %s", err)
+		return
+	}
+
+	defer conn.Close()
+	_, err = conn.Write([]byte(notification))
+	if err != nil {
+		notifier.logger.Printf("Could not notify systemd: %s", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// readWithoutEcho calls the given function to read from the given file, which is kept from echoing what is typed if it
+// is a terminal, such as so that an access token isn't left on the screen.
+func readWithoutEcho(file *os.File, read func() (string, error)) (string, error) {
+	fd := int(file.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		// This isn't a terminal, so there's nothing to hide the input from.
+		return read()
+	}
+
+	noEcho := *termios
+	noEcho.Lflag &^= unix.ECHO
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, &noEcho)
+	if err != nil {
+		return "", fmt.Errorf("could not hide input: %w", err)
+	}
+
+	defer unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	// The newline that ends the input wasn't echoed either.
+	defer fmt.Println()
+
+	return read()
+}
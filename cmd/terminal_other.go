@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import "os"
+
+// readWithoutEcho would keep the given file from echoing what is typed while the given function reads from it, but
+// this is only supported on Linux and Windows, so what is typed is shown as usual.
+func readWithoutEcho(file *os.File, read func() (string, error)) (string, error) {
+	return read()
+}
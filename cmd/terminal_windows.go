@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// readWithoutEcho calls the given function to read from the given file, which is kept from echoing what is typed if it
+// is a console, such as so that an access token isn't left on the screen.
+func readWithoutEcho(file *os.File, read func() (string, error)) (string, error) {
+	handle := windows.Handle(file.Fd())
+	var mode uint32
+	err := windows.GetConsoleMode(handle, &mode)
+	if err != nil {
+		// This isn't a console, so there's nothing to hide the input from.
+		return read()
+	}
+
+	err = windows.SetConsoleMode(handle, mode&^windows.ENABLE_ECHO_INPUT)
+	if err != nil {
+		return "", fmt.Errorf("could not hide input: %w", err)
+	}
+
+	defer windows.SetConsoleMode(handle, mode)
+	// The newline that ends the input wasn't echoed either.
+	defer fmt.Println()
+
+	return read()
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"time"
+
+	pinamicdns "github.com/ollien/pinamic-dns"
+	"github.com/ollien/xtrace"
+)
+
+// updater updates the configured records with the current IP address, each time update is called.
+type updater struct {
+	config    Config
+	setter    pinamicdns.IPSetter
+	state     *State
+	statePath string
+	// prune forces the records to be set, so that duplicates are removed, even if the IP is unchanged.
+	prune bool
+	// force forces the IP to be detected, even if it was detected within the config's recheck interval.
+	force     bool
+	logger    *log.Logger
+	logWriter io.Writer
+}
+
+// update sets the records to the current IP address, if it has changed. It returns the reason for any failure, which
+// has already been logged. Once the given context is done, the update is abandoned, though anything that was already
+// done is still saved to the state. What happened is returned as well, and written to the status file, if configured.
+func (updater updater) update(ctx context.Context) (runStatus, error) {
+	status := runStatus{}
+	err := updater.updateRecords(ctx, &status)
+	if updater.config.StatusFile != "" {
+		statusErr := writeStatusFile(updater.config.StatusFile, status, err, time.Now())
+		if statusErr != nil {
+			updater.logger.Printf("Could not write status file: %s", statusErr)
+		}
+	}
+
+	return status, err
+}
+
+// updateRecords updates the records in the manner of update, recording what happened to them in the given status.
+func (updater updater) updateRecords(ctx context.Context, status *runStatus) error {
+	config, state, logger := updater.config, updater.state, updater.logger
+	ips, stateChanged, detectErr := updater.currentIPs(ctx)
+	status.detectedIPs = ips
+	if ctx.Err() != nil {
+		if stateChanged {
+			saveState(*state, updater.statePath, logger)
+		}
+
+		return updater.fail("Update interrupted before the IP was found")
+	} else if len(ips) == 0 {
+		if stateChanged {
+			saveState(*state, updater.statePath, logger)
+		}
+
+		return updater.fail("Could not get IP to update with: %s", detectErr)
+	}
+
+	var partialErr error
+	if detectErr != nil {
+		// Any address we did find can still be published, but the run must not look like it succeeded.
+		partialErr = updater.fail("Could not get IP to update with: %s", detectErr)
+	}
+
+	for _, ip := range ips {
+		err := validateIP(ip, config.IPValidation)
+		if err != nil {
+			// There's no sense in using this address again until the recheck interval passes.
+			state.clearDetectedIPs()
+			return updater.fail("Refusing to update record: %s", err)
+		}
+	}
+
+	stateKey, err := configStateKey(config)
+	if err != nil {
+		return updater.fail("Could not determine records to update: %s", err)
+	}
+
+	records, err := configRecords(config)
+	if err != nil {
+		return updater.fail("Could not determine records to update: %s", err)
+	}
+
+	status.recordTypes = recordTypes(records)
+	ttls := recordTTLs(records)
+	recordState := state.Records[stateKey]
+	ttlsSet := recordState.TTL == config.DNSConfig.TTL && reflect.DeepEqual(recordState.RecordTTLs, ttls)
+	pendingIPs := []net.IP{}
+	for _, ip := range ips {
+		if !setsRecordType(status.recordTypes, ipRecordType(ip)) {
+			// None of the records are set to addresses of this family.
+			continue
+		}
+
+		alreadySet := state.publishedIP(stateKey, ip) == ip.String()
+		if alreadySet && ttlsSet && !updater.prune {
+			// We've already set this IP with this TTL, so there's no need to ask the provider about it again.
+			// Any other IP we may have seen must have been transient.
+			stateChanged = state.clearObservedIP(ip) || stateChanged
+			status.addRecords(stateKey, ip, recordUnchanged, nil)
+			continue
+		}
+
+		// An IP we've already set has no need to prove itself stable again, even if we're only pruning its records or
+		// changing its TTL.
+		observedChecks := state.observeIP(ip)
+		stateChanged = true
+		if !alreadySet && observedChecks < config.IPValidation.StableChecks {
+			logger.Printf(
+				"Detected new IP %s; waiting for %d more consecutive checks before updating record",
+				ip,
+				config.IPValidation.StableChecks-observedChecks,
+			)
+
+			status.addRecords(stateKey, ip, recordWaiting, nil)
+			continue
+		}
+
+		pendingIPs = append(pendingIPs, ip)
+	}
+
+	if len(pendingIPs) == 0 {
+		if stateChanged {
+			saveState(*state, updater.statePath, logger)
+		}
+
+		return partialErr
+	}
+
+	if state.circuitOpen(time.Now()) {
+		// We've already told the user that updates are paused, and there's no sense in repeating ourselves.
+		for _, ip := range pendingIPs {
+			status.addRecords(stateKey, ip, recordPaused, nil)
+		}
+
+		saveState(*state, updater.statePath, logger)
+		return partialErr
+	}
+
+	// Pruning was asked for explicitly, so it shouldn't have to wait.
+	heldUntil := state.writesHeldUntil(time.Duration(config.DNSConfig.MinUpdateInterval))
+	if now := time.Now(); now.Before(heldUntil) && !updater.prune {
+		// If the address changes again in the meantime, only the latest one need be written.
+		logger.Printf(
+			"Provider was last written to at %s; holding back update until %s",
+			state.LastWriteAt.Format(time.RFC3339),
+			heldUntil.Format(time.RFC3339),
+		)
+
+		for _, ip := range pendingIPs {
+			status.addRecords(stateKey, ip, recordHeld, nil)
+		}
+
+		status.heldUntil = heldUntil
+		saveState(*state, updater.statePath, logger)
+		return partialErr
+	}
+
+	state.LastWriteAt = time.Now()
+	updated := 0
+	err = checkAccess(updater.setter, config.DNSConfig.Domain)
+	for err == nil && updated < len(pendingIPs) {
+		ip := pendingIPs[updated]
+		err = pinamicdns.SetIPContext(ctx, updater.setter, config.DNSConfig.Domain, config.DNSConfig.Name, ip)
+		if err == nil {
+			updater.logIPChange(state.publishedIP(stateKey, ip), ip)
+			state.setPublishedIP(stateKey, ip)
+			state.clearObservedIP(ip)
+			status.addRecords(stateKey, ip, recordUpdated, nil)
+			updated++
+		}
+	}
+
+	// Whichever addresses weren't set are left as they were.
+	for _, ip := range pendingIPs[updated:] {
+		status.addRecords(stateKey, ip, recordFailed, err)
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// The provider is not to blame, so this must not count towards opening the circuit breaker.
+		failErr := updater.fail("Update interrupted before the record was updated: %s", err)
+		saveState(*state, updater.statePath, logger)
+
+		return failErr
+	} else if err != nil {
+		failErr := updater.fail("Could not update record: %s", err)
+		circuitBreaker := config.CircuitBreaker
+		opened := state.recordProviderFailure(time.Now(), circuitBreaker.failureThreshold(), circuitBreaker.cooldown())
+		if opened {
+			logger.Printf(
+				"Provider has failed %d consecutive times; pausing updates until %s",
+				state.ProviderFailures,
+				state.CircuitOpenUntil.Format(time.RFC3339),
+			)
+		}
+
+		saveState(*state, updater.statePath, logger)
+		updater.traceError(err)
+
+		return failErr
+	}
+
+	recordState = state.Records[stateKey]
+	recordState.TTL = config.DNSConfig.TTL
+	recordState.RecordTTLs = ttls
+	recordState.UpdatedAt = time.Now()
+	state.Records[stateKey] = recordState
+	state.recordProviderSuccess()
+	saveState(*state, updater.statePath, logger)
+
+	return partialErr
+}
+
+// setsRecordType checks whether or not any of the records with the given types, as given by recordTypes, are set as
+// records of the given type.
+func setsRecordType(types map[string]string, recordType string) bool {
+	for _, limitedType := range types {
+		if limitedType == "" || limitedType == recordType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// currentIPs gets the current IP addresses to publish. If they were detected within the config's recheck interval,
+// the addresses that were detected then are used, rather than detecting them again. As with detectIPs, if only some of
+// the addresses could be found, they are returned along with an error. It also returns whether or not the state has
+// changed, such as by caching newly detected addresses.
+func (updater updater) currentIPs(ctx context.Context) ([]net.IP, bool, error) {
+	now := time.Now()
+	recheckInterval := time.Duration(updater.config.IPDetection.RecheckInterval)
+	if !updater.force && updater.state.detectionFresh(now, recheckInterval) {
+		return updater.state.detectedIPs(), false, nil
+	} else if recheckInterval == 0 {
+		ips, err := detectIPs(ctx, updater.config)
+		return ips, false, err
+	}
+
+	ips, err := detectIPs(ctx, updater.config)
+	if err != nil {
+		// Addresses are only cached if all of them were found, so that a missing one is looked for again next time.
+		return ips, updater.state.clearDetectedIPs(), err
+	}
+
+	updater.state.setDetectedIPs(ips, now)
+
+	return ips, true, nil
+}
+
+// publishedIPs gets the addresses that were last published for the configured records.
+func (updater updater) publishedIPs() []string {
+	stateKey, err := configStateKey(updater.config)
+	if err != nil {
+		return nil
+	}
+
+	ips := []string{}
+	recordState := updater.state.Records[stateKey]
+	for _, ip := range []string{recordState.IP, recordState.IPv6} {
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+}
+
+// logIPChange logs that the published IP has changed from the given previous address, if any, to the given one. If
+// GeoIP lookups are enabled, the network and location of each address is logged as well.
+func (updater updater) logIPChange(previousIP string, ip net.IP) {
+	if previousIP == ip.String() {
+		return
+	} else if previousIP == "" {
+		updater.logger.Printf("Published IP %s", updater.describeIP(ip))
+		return
+	}
+
+	previous := previousIP
+	if parsedIP := net.ParseIP(previousIP); parsedIP != nil {
+		previous = updater.describeIP(parsedIP)
+	}
+
+	updater.logger.Printf("Published IP changed from %s to %s", previous, updater.describeIP(ip))
+}
+
+// describeIP describes the given address for logs, along with its network and location if GeoIP lookups are enabled.
+// The lookup failing is logged, but does not stop the address from being described.
+func (updater updater) describeIP(ip net.IP) string {
+	if !updater.config.GeoIP.Enabled {
+		return ip.String()
+	}
+
+	info, err := lookupIPInfo(ip, updater.config.GeoIP, updater.config.HTTPConfig)
+	if err != nil {
+		updater.logger.Printf("Could not look up %s: %s", ip, err)
+		return ip.String()
+	}
+
+	return fmt.Sprintf("%s (%s)", ip, info)
+}
+
+// fail logs the given reason that an update failed, and returns it as an error. The error's message is just as it was
+// logged, so that it can be reported elsewhere as is.
+func (updater updater) fail(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	updater.logger.Print(err)
+
+	return err
+}
+
+// traceError writes a trace of the given error to the updater's log.
+func (updater updater) traceError(err error) {
+	tracer, tracerErr := xtrace.NewTracer(err)
+	if tracerErr != nil {
+		updater.logger.Printf("Could not produce error trace: %s", err)
+		return
+	}
+
+	traceErr := tracer.Trace(updater.logWriter)
+	if traceErr != nil {
+		updater.logger.Printf("Could not produce error trace: %s", err)
+		return
+	}
+	// HACK: Write a newline so there's one after the trace
+	// Should probably be done in xtrace
+	updater.logWriter.Write([]byte("\n"))
+}
@@ -0,0 +1,85 @@
+package pinamicdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// How often nameservers are re-queried while waiting for a record to converge.
+const nameserverPollInterval = 5 * time.Second
+
+// wildcardProbeLabel is the label that takes the place of the wildcard when looking up a wildcard record, as wildcards
+// can't be looked up directly. It is unlikely enough to have a record of its own that the wildcard will be what answers.
+const wildcardProbeLabel = "pinamic-dns-wildcard-probe"
+
+// ConvergenceCheck describes how a setter should confirm that a record it has set has actually taken effect.
+// The zero value performs no checks.
+type ConvergenceCheck struct {
+	// MaxAttempts is the number of times a record will be written before giving up on the provider reporting the new
+	// value. If less than one, the record is not re-read after it is written.
+	MaxAttempts int
+	// Resolve, if true, also requires that the provider's nameservers serve the new value.
+	Resolve bool
+	// ResolveTimeout is how long to wait for the provider's nameservers to serve the new value.
+	ResolveTimeout time.Duration
+}
+
+// waitForNameservers waits until each of the given nameservers serves the given IP for the given host, or the timeout
+// elapses. If the host is a wildcard, such as *.example.com, a name that the wildcard covers is looked up instead.
+func waitForNameservers(ctx context.Context, nameservers []string, host string, ip net.IP, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lookupHost := host
+	if strings.HasPrefix(host, "*.") {
+		lookupHost = wildcardProbeLabel + strings.TrimPrefix(host, "*")
+	}
+
+	for _, nameserver := range nameservers {
+		for {
+			served, err := nameserverServesIP(ctx, nameserver, lookupHost, ip)
+			if served {
+				break
+			}
+
+			// If we're out of time, the most useful thing to report is why the last lookup did not succeed.
+			if sleepErr := sleep(ctx, nameserverPollInterval); sleepErr != nil {
+				if err != nil {
+					return xerrors.Errorf("%s did not serve %s for %s in time: %w", nameserver, ip, host, err)
+				}
+
+				return xerrors.Errorf("%s did not serve %s for %s in time", nameserver, ip, host)
+			}
+		}
+	}
+
+	return nil
+}
+
+// nameserverServesIP checks whether or not the given nameserver returns the given IP for the given host.
+func nameserverServesIP(ctx context.Context, nameserver, host string, ip net.IP) (bool, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(nameserver, "53"))
+		},
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return false, xerrors.Errorf("could not look up %s: %w", host, err)
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.Equal(ip) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,218 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/xerrors"
+)
+
+const deSECAPIBaseURL = "https://desec.io/api/v1"
+
+// deSECApexName is the subname that deSEC gives the rrsets at the apex of a domain.
+const deSECApexName = ""
+
+func init() {
+	Register("desec", newDeSECIPSetterFromConfig)
+}
+
+// DeSECIPSetter is an IPSetter that will update records with deSEC
+type DeSECIPSetter struct {
+	apiToken        string
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+	duplicatePolicy DuplicateRecordPolicy
+}
+
+// deSECTransaction holds all elements necessary to talk to the deSEC API, in the context of a single
+// DeSECIPSetter.SetIP call.
+type deSECTransaction struct {
+	client restClient
+}
+
+// deSECRRSet is a set of all of the records with a given name and type, as represented by the deSEC API. As with
+// Gandi, the entire set is replaced at once.
+type deSECRRSet struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// DeSECRecordTTL should be passed to NewDeSECIPSetter if a TTL is desired for the records it sets. deSEC does not
+// allow TTLs of less than 3600 seconds for most accounts. If not given, the domain's minimum TTL is used for new
+// records.
+func DeSECRecordTTL(ttl int) func(*DeSECIPSetter) error {
+	return func(setter *DeSECIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// DeSECHTTPConfig should be passed to NewDeSECIPSetter to control how the HTTP client that talks to the deSEC API is
+// constructed, such as its timeouts.
+func DeSECHTTPConfig(config HTTPConfig) func(*DeSECIPSetter) error {
+	return func(setter *DeSECIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// DeSECRetryPolicy should be passed to NewDeSECIPSetter to control how calls to the deSEC API are retried when they fail
+// for transient reasons. If not given, DefaultRetryPolicy is used.
+func DeSECRetryPolicy(policy RetryPolicy) func(*DeSECIPSetter) error {
+	return func(setter *DeSECIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// DeSECDuplicateRecordPolicy should be passed to NewDeSECIPSetter to control what is done when the name already has
+// several addresses. Because deSEC holds these addresses in a single set, UpdateAllDuplicates and
+// ConsolidateDuplicates both replace the set with only the new address. If not given, UpdateFirstDuplicate is used.
+func DeSECDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*DeSECIPSetter) error {
+	return func(setter *DeSECIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// NewDeSECIPSetter makes a new deSEC IPSetter, which authenticates with the given API token.
+func NewDeSECIPSetter(apiToken string, options ...func(*DeSECIPSetter) error) (DeSECIPSetter, error) {
+	setter := DeSECIPSetter{
+		apiToken:    apiToken,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return DeSECIPSetter{}, xerrors.Errorf("could not construct DeSECIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeTransaction will make a new deSEC API transaction for the given setter.
+func (setter DeSECIPSetter) makeTransaction(ctx context.Context) deSECTransaction {
+	header := http.Header{}
+	header.Set("Authorization", "Token "+setter.apiToken)
+
+	return deSECTransaction{
+		client: newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, deSECAPIBaseURL, header),
+	}
+}
+
+// getRRSet gets the set of records for the given domain with the given subname and type. If no such records exist, an
+// empty set is returned.
+func (transaction deSECTransaction) getRRSet(domain, subname, recordType string) (deSECRRSet, error) {
+	// deSEC refers to the apex of the domain with @ in paths, as the subname itself is empty.
+	pathSubname := subname
+	if pathSubname == "" {
+		pathSubname = "@"
+	}
+
+	rrset := deSECRRSet{}
+	path := "/domains/" + url.PathEscape(domain) + "/rrsets/" + url.PathEscape(pathSubname) + "/" + recordType + "/"
+	err := transaction.client.do(http.MethodGet, path, nil, &rrset)
+	if httpStatusCode(err) == http.StatusNotFound {
+		return deSECRRSet{Subname: subname, Type: recordType}, nil
+	} else if err != nil {
+		return deSECRRSet{}, xerrors.Errorf("could not ask deSEC API for records: %w", err)
+	}
+
+	return rrset, nil
+}
+
+// putRRSet replaces the given set of records for the given domain, creating it if it does not exist.
+func (transaction deSECTransaction) putRRSet(domain string, rrset deSECRRSet) error {
+	// Only the bulk endpoint is able to both create and replace an rrset.
+	err := transaction.client.do(http.MethodPatch, "/domains/"+url.PathEscape(domain)+"/rrsets/", []deSECRRSet{rrset}, nil)
+	if err != nil {
+		return xerrors.Errorf("could not set records for domain: %w", err)
+	}
+
+	return nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with deSEC.
+func (setter DeSECIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter DeSECIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	transaction := setter.makeTransaction(ctx)
+	existingRRSet, err := transaction.getRRSet(domain, providerRecordName(domain, name, deSECApexName), ipRecordType(ip))
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	desiredRRSet := existingRRSet
+	desiredRRSet.Records = desiredRRSetValues(existingRRSet.Records, ip.String(), setter.duplicatePolicy)
+	if setter.recordTTL != 0 {
+		desiredRRSet.TTL = setter.recordTTL
+	}
+
+	// deSEC limits how often a domain may be changed, so we should avoid writing when there's no need.
+	if desiredRRSet.TTL == existingRRSet.TTL && rrsetValuesEqual(existingRRSet.Records, desiredRRSet.Records) {
+		return nil
+	}
+
+	err = transaction.putRRSet(domain, desiredRRSet)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// CheckAccess confirms that the setter's token is able to access the given domain.
+func (setter DeSECIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	err := transaction.client.do(http.MethodGet, "/domains/"+url.PathEscape(domain)+"/", nil, nil)
+	switch httpStatusCode(err) {
+	case 0:
+		return err
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return xerrors.Errorf("deSEC token lacks access to domain %s: %w", domain, err)
+	case http.StatusNotFound:
+		return xerrors.Errorf("domain %s does not exist in the deSEC account: %w", domain, err)
+	default:
+		return xerrors.Errorf("could not check access to domain %s: %w", domain, err)
+	}
+}
+
+// deSECConfig represents the JSON config of a DeSECIPSetter, for use with NewSetterFromConfig.
+type deSECConfig struct {
+	AccessToken string `json:"access_token"`
+}
+
+// newDeSECIPSetterFromConfig makes a DeSECIPSetter from the given JSON config and shared settings.
+func newDeSECIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := deSECConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDeSECIPSetter(
+		config.AccessToken,
+		DeSECRecordTTL(options.RecordTTL),
+		DeSECHTTPConfig(options.HTTPConfig),
+		DeSECRetryPolicy(options.retryPolicy()),
+		DeSECDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+	)
+}
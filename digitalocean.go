@@ -1,33 +1,73 @@
 package pinamicdns
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
+	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/digitalocean/godo"
 	"golang.org/x/oauth2"
 	"golang.org/x/xerrors"
 )
 
-const ARecordType = "A"
-
-var (
-	errNoRecordsFound = errors.New("no existing record found")
-	errNoUpdateNeeded = errors.New("no update is needed to bring the record up to date")
+// Types of records that are set by this package
+const (
+	ARecordType    = "A"
+	AAAARecordType = "AAAA"
+	TXTRecordType  = "TXT"
 )
 
+// digitalOceanRecordsPerPage is the number of records requested in each page of a listing, which is the most that
+// DigitalOcean allows.
+const digitalOceanRecordsPerPage = 200
+
+// DefaultDigitalOceanMaxRateLimitWait is the longest that a single call to SetIP will wait for DigitalOcean's rate
+// limits to reset before giving up, if no other maximum is specified.
+const DefaultDigitalOceanMaxRateLimitWait = 15 * time.Minute
+
+// digitalOceanNameservers are the nameservers that serve all domains hosted by DigitalOcean.
+var digitalOceanNameservers = []string{"ns1.digitalocean.com", "ns2.digitalocean.com", "ns3.digitalocean.com"}
+
+func init() {
+	Register("digitalocean", newDigitalOceanIPSetterFromConfig)
+}
+
 // DigitalOceanIPSetter is an IPSetter that will update records in DigitalOcean's DNS
 type DigitalOceanIPSetter struct {
-	tokenSource oauth2.TokenSource
-	recordTTL   int
+	tokenSource      oauth2.TokenSource
+	recordTTL        int
+	httpConfig       HTTPConfig
+	httpClient       *http.Client
+	baseURL          *url.URL
+	retryPolicy      RetryPolicy
+	recordIDCache    RecordIDCache
+	duplicatePolicy  DuplicateRecordPolicy
+	convergenceCheck ConvergenceCheck
+	responseCache    ResponseCache
+	maxRateLimitWait time.Duration
 }
 
 // digitalOceanTransaction holds all elements necessary to talk to the DigitalOcean API, in the context of a single
 // DigitalOceanIPSetter.SetIP call.
 type digitalOceanTransaction struct {
-	ctx    context.Context
-	client *godo.Client
+	ctx              context.Context
+	client           *godo.Client
+	retryPolicy      RetryPolicy
+	responseCache    ResponseCache
+	maxRateLimitWait time.Duration
+}
+
+// digitalOceanRecordsRoot is the response body of DigitalOcean's record listing endpoint.
+type digitalOceanRecordsRoot struct {
+	DomainRecords []godo.DomainRecord `json:"domain_records"`
+	Links         *godo.Links         `json:"links"`
 }
 
 // DigitalOceanRecordTTL should be passed to NewDigitalOceanIPSetter if a TTL is desired for the records it sets
@@ -38,61 +78,388 @@ func DigitalOceanRecordTTL(ttl int) func(*DigitalOceanIPSetter) error {
 	}
 }
 
-// getUpdatableRecord gets a single A record to update from DigtialOcean. The new record must have the same name and a
-// different value than what is given. If all existing records carry the same value, errNoUpdateNeeded is returned. If
-// no record exists to be updated, errNoRecordsFound is returned.
-func (transaction digitalOceanTransaction) getUpdatableARecord(domain, name, proposedValue string) (godo.DomainRecord, error) {
-	records, res, err := transaction.client.Domains.Records(transaction.ctx, domain, nil)
+// DigitalOceanHTTPConfig should be passed to NewDigitalOceanIPSetter to control how the HTTP client that talks to the
+// DigitalOcean API is constructed, such as its timeouts.
+func DigitalOceanHTTPConfig(config HTTPConfig) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// DigitalOceanHTTPClient should be passed to NewDigitalOceanIPSetter to talk to the DigitalOcean API with the given
+// HTTP client, such as one with instrumentation or a custom transport. The setter's token is added to the client's
+// requests, so the client should not add one itself. If given, any DigitalOceanHTTPConfig is ignored.
+func DigitalOceanHTTPClient(client *http.Client) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		if client == nil {
+			return xerrors.New("HTTP client must not be nil")
+		}
+
+		setter.httpClient = client
+		return nil
+	}
+}
+
+// DigitalOceanBaseURL should be passed to NewDigitalOceanIPSetter to talk to a DigitalOcean API at the given URL, such
+// as a mock server or a proxy, rather than https://api.digitalocean.com/. Requests are made to paths beneath the URL,
+// such as /v2/domains.
+func DigitalOceanBaseURL(baseURL string) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		parsedURL, err := url.Parse(baseURL)
+		if err != nil {
+			return xerrors.Errorf("invalid base URL: %w", err)
+		} else if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			return xerrors.New("base URL must be http or https")
+		}
+
+		// Paths are resolved relative to the base URL, which would drop its last element without a trailing slash.
+		if !strings.HasSuffix(parsedURL.Path, "/") {
+			parsedURL.Path += "/"
+		}
+
+		setter.baseURL = parsedURL
+		return nil
+	}
+}
+
+// DigitalOceanRetryPolicy should be passed to NewDigitalOceanIPSetter to control how calls to the DigitalOcean API are
+// retried when they fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func DigitalOceanRetryPolicy(policy RetryPolicy) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// DigitalOceanRecordIDCache should be passed to NewDigitalOceanIPSetter if the IDs of records that are set should be
+// cached. When a record's ID is cached, it will be updated directly, rather than listing all records for the domain.
+func DigitalOceanRecordIDCache(cache RecordIDCache) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		setter.recordIDCache = cache
+		return nil
+	}
+}
+
+// DigitalOceanDuplicateRecordPolicy should be passed to NewDigitalOceanIPSetter to control what is done when several
+// records of the same type exist for the same name. If not given, UpdateFirstDuplicate is used. Any policy other than
+// UpdateFirstDuplicate requires all records to be listed, so a RecordIDCache will not be used to skip listing them.
+func DigitalOceanDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// DigitalOceanConvergenceCheck should be passed to NewDigitalOceanIPSetter if records should be confirmed to have taken
+// effect after they are set. If DigitalOcean reports the old value when the record is re-read, it will be written again.
+func DigitalOceanConvergenceCheck(check ConvergenceCheck) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		setter.convergenceCheck = check
+		return nil
+	}
+}
+
+// DigitalOceanResponseCache should be passed to NewDigitalOceanIPSetter if record listings should be cached. Cached
+// listings are revalidated with conditional requests, which DigitalOcean can answer without sending the listing again.
+func DigitalOceanResponseCache(cache ResponseCache) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		setter.responseCache = cache
+		return nil
+	}
+}
+
+// DigitalOceanMaxRateLimitWait should be passed to NewDigitalOceanIPSetter to control how long a single call to SetIP
+// may wait in total for DigitalOcean's rate limits to reset, before giving up. A wait of zero will give up as soon as
+// the rate limit is exceeded. If not given, DefaultDigitalOceanMaxRateLimitWait is used.
+func DigitalOceanMaxRateLimitWait(wait time.Duration) func(*DigitalOceanIPSetter) error {
+	return func(setter *DigitalOceanIPSetter) error {
+		if wait < 0 {
+			return xerrors.New("maximum rate limit wait must not be negative")
+		}
+
+		setter.maxRateLimitWait = wait
+		return nil
+	}
+}
+
+// call performs a call to the DigitalOcean API, retrying it in correspondence with the transaction's retry policy.
+// If DigitalOcean indicates that we have exceeded our rate limit, the call is retried once the limit resets.
+// apiCall should return the response and error given by godo. If apiCall has already checked the response itself, it
+// may return a nil response.
+func (transaction digitalOceanTransaction) call(apiCall func() (*godo.Response, error)) error {
+	return transaction.callWithRetries(transaction.retryPolicy.run, apiCall)
+}
+
+// callCreate performs a call that creates a record in the same manner as call, except that it is only retried if it
+// was never applied, so that a record is not created twice.
+func (transaction digitalOceanTransaction) callCreate(apiCall func() (*godo.Response, error)) error {
+	return transaction.callWithRetries(transaction.retryPolicy.runUnapplied, apiCall)
+}
+
+// callWithRetries performs a call in the same manner as call, retrying it with the given function of the transaction's
+// retry policy.
+func (transaction digitalOceanTransaction) callWithRetries(retry func(context.Context, func() error) error, apiCall func() (*godo.Response, error)) error {
+	// Holds the total amount of time we have spent waiting for rate limits to reset
+	var rateLimitWaited time.Duration
+	for {
+		// If the last call used up our rate limit, there's no sense making a request we know will be rejected.
+		wait, limited := transaction.exhaustedRateLimitWait()
+		if !limited {
+			err := retry(transaction.ctx, func() error {
+				res, err := apiCall()
+				if err != nil {
+					return err
+				} else if res == nil {
+					return nil
+				}
+
+				return godo.CheckResponse(res.Response)
+			})
+
+			wait, limited = digitalOceanRateLimitWait(err)
+			if !limited {
+				return err
+			} else if rateLimitWaited+wait > transaction.maxRateLimitWait {
+				return xerrors.Errorf("rate limited by DigitalOcean for longer than %s: %w", transaction.maxRateLimitWait, err)
+			}
+		} else if rateLimitWaited+wait > transaction.maxRateLimitWait {
+			return xerrors.Errorf("DigitalOcean rate limit will not reset within %s", transaction.maxRateLimitWait)
+		}
+
+		err := sleep(transaction.ctx, wait)
+		if err != nil {
+			return xerrors.Errorf("could not wait for DigitalOcean rate limit to reset: %w", err)
+		}
+
+		rateLimitWaited += wait
+	}
+}
+
+// exhaustedRateLimitWait checks if the most recent API call left no requests remaining in our rate limit. If so,
+// the time until the limit resets is returned.
+func (transaction digitalOceanTransaction) exhaustedRateLimitWait() (time.Duration, bool) {
+	rate := transaction.client.Rate
+	if rate.Limit == 0 || rate.Remaining > 0 || rate.Reset.IsZero() {
+		return 0, false
+	}
+
+	wait := time.Until(rate.Reset.Time)
+	if wait <= 0 {
+		return 0, false
+	}
+
+	return wait, true
+}
+
+// digitalOceanRateLimitWait checks if the given error is the result of DigitalOcean rejecting a request due to rate
+// limiting. If so, the amount of time to wait before retrying is returned.
+func digitalOceanRateLimitWait(err error) (time.Duration, bool) {
+	var errResponse *godo.ErrorResponse
+	if !xerrors.As(err, &errResponse) || errResponse.Response == nil {
+		return 0, false
+	} else if errResponse.Response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	wait, haveWait := rateLimitWait(errResponse.Response.Header, time.Now())
+	if !haveWait {
+		// DigitalOcean should always tell us when to come back, but if it doesn't, a minute is a reasonable guess.
+		return time.Minute, true
+	}
+
+	return wait, true
+}
+
+// listIDRecords gets all of the records with the given type and name for the given domain from DigitalOcean.
+func (transaction digitalOceanTransaction) listIDRecords(domain, recordType, name string) ([]idRecord, error) {
+	records, err := transaction.listRecords(domain)
 	if err != nil {
-		return godo.DomainRecord{}, xerrors.Errorf("could not ask DigitalOcean API for records: %w", err)
-	} else if resErr := godo.CheckResponse(res.Response); resErr != nil {
-		return godo.DomainRecord{}, xerrors.Errorf("could not ask DigitalOcean API for records: %w", resErr)
+		return nil, xerrors.Errorf("could not ask DigitalOcean API for records: %w", err)
 	}
 
-	// Represents whether or not we have a record that has the same name
-	haveName := false
+	matchingRecords := []idRecord{}
 	for _, record := range records {
-		// Records with a differing name or non A records are invalid.
-		if record.Type != ARecordType || record.Name != name {
-			continue
-		} else if record.Name == name {
-			// If we have a record with the same name, notate it as such
-			haveName = true
+		// Records with a differing name or type are not ours to touch. Names are compared exactly, so a wildcard record,
+		// such as *.home, is never mistaken for a concrete record beside it, and vice versa.
+		if record.Type == recordType && record.Name == name {
+			matchingRecords = append(matchingRecords, makeDigitalOceanIDRecord(record))
 		}
+	}
+
+	return matchingRecords, nil
+}
+
+// createIDRecord creates the given record for the given domain.
+func (transaction digitalOceanTransaction) createIDRecord(domain string, record idRecord) (idRecord, error) {
+	createdRecord, err := transaction.createRecord(domain, makeEditRequest(record))
+	if err != nil {
+		return idRecord{}, err
+	}
+
+	return makeDigitalOceanIDRecord(createdRecord), nil
+}
+
+// updateIDRecord updates the record for the given domain with the ID of the given record to match it.
+func (transaction digitalOceanTransaction) updateIDRecord(domain string, record idRecord) (idRecord, error) {
+	recordID, err := strconv.Atoi(record.ID)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("invalid DigitalOcean record ID %q: %w", record.ID, err)
+	}
+
+	updatedRecord, err := transaction.updateRecord(domain, recordID, makeEditRequest(record))
+	if err != nil {
+		return idRecord{}, err
+	}
+
+	return makeDigitalOceanIDRecord(updatedRecord), nil
+}
 
-		if record.Data != proposedValue {
-			return record, nil
+// deleteIDRecord deletes the record for the given domain with the ID of the given record.
+func (transaction digitalOceanTransaction) deleteIDRecord(domain string, record idRecord) error {
+	recordID, err := strconv.Atoi(record.ID)
+	if err != nil {
+		return xerrors.Errorf("invalid DigitalOcean record ID %q: %w", record.ID, err)
+	}
+
+	return transaction.deleteRecord(domain, recordID)
+}
+
+// listRecords lists all of the records for the given domain, across every page of the listing.
+func (transaction digitalOceanTransaction) listRecords(domain string) ([]godo.DomainRecord, error) {
+	records := []godo.DomainRecord{}
+	for page := 1; ; page++ {
+		pageRecords, lastPage, err := transaction.listRecordsPage(domain, page)
+		if err != nil {
+			return nil, xerrors.Errorf("could not list page %d of records: %w", page, err)
+		}
+
+		records = append(records, pageRecords...)
+		// An empty page can only mean we've run off the end of the listing, even if DigitalOcean claims otherwise.
+		if lastPage || len(pageRecords) == 0 {
+			return records, nil
+		}
+	}
+}
+
+// listRecordsPage lists the given page of records for the given domain, and whether or not it is the last page. If the
+// transaction has a ResponseCache, a cached page will be revalidated with DigitalOcean rather than being fetched again.
+func (transaction digitalOceanTransaction) listRecordsPage(domain string, page int) ([]godo.DomainRecord, bool, error) {
+	path := fmt.Sprintf("v2/domains/%s/records?page=%d&per_page=%d", domain, page, digitalOceanRecordsPerPage)
+	req, err := transaction.client.NewRequest(transaction.ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, false, xerrors.Errorf("could not build records request: %w", err)
+	}
+
+	cacheKey := req.URL.String()
+	var cachedResponse CachedResponse
+	haveCachedResponse := false
+	if transaction.responseCache != nil {
+		cachedResponse, haveCachedResponse = transaction.responseCache.CachedResponse(cacheKey)
+	}
+
+	if haveCachedResponse {
+		cachedResponse.setConditionalHeaders(req)
+	}
+
+	body := bytes.Buffer{}
+	notModified := false
+	var res *godo.Response
+	err = transaction.call(func() (*godo.Response, error) {
+		var err error
+		body.Reset()
+		res, err = transaction.client.Do(transaction.ctx, req, &body)
+		if haveCachedResponse && res != nil && res.StatusCode == http.StatusNotModified {
+			// godo considers this an error, but it just means our cached listing is still good.
+			notModified = true
+			return nil, nil
 		}
+
+		return res, err
+	})
+	if err != nil {
+		return nil, false, err
 	}
 
-	// If we have a record with the same name and we haven't returned, it must have the same value as what is propsoed.
-	// If this is the case, no update is needed
-	if haveName {
-		return godo.DomainRecord{}, errNoUpdateNeeded
+	rawRecords := body.Bytes()
+	if notModified {
+		rawRecords = cachedResponse.Body
+	} else if transaction.responseCache != nil {
+		if response, canCache := makeCachedResponse(res.Header, rawRecords); canCache {
+			transaction.responseCache.SetCachedResponse(cacheKey, response)
+		}
 	}
 
-	return godo.DomainRecord{}, errNoRecordsFound
+	root := digitalOceanRecordsRoot{}
+	err = json.Unmarshal(rawRecords, &root)
+	if err != nil {
+		return nil, false, xerrors.Errorf("could not decode records: %w", err)
+	}
+
+	lastPage := root.Links == nil || root.Links.IsLastPage()
+
+	return root.DomainRecords, lastPage, nil
 }
 
 // createRecord creates a DNS record for the given domain, in correspondence with the given DomainRecordEditRequest
-func (transaction digitalOceanTransaction) createRecord(domain string, editRequest godo.DomainRecordEditRequest) error {
-	_, res, err := transaction.client.Domains.CreateRecord(transaction.ctx, domain, &editRequest)
+func (transaction digitalOceanTransaction) createRecord(domain string, editRequest godo.DomainRecordEditRequest) (godo.DomainRecord, error) {
+	var record *godo.DomainRecord
+	err := transaction.callCreate(func() (*godo.Response, error) {
+		var res *godo.Response
+		var err error
+		record, res, err = transaction.client.Domains.CreateRecord(transaction.ctx, domain, &editRequest)
+
+		return res, err
+	})
 	if err != nil {
-		return xerrors.Errorf("could not create record for domain: %w", err)
-	} else if resErr := godo.CheckResponse(res.Response); resErr != nil {
-		return xerrors.Errorf("could not create record for domain: %w", resErr)
+		return godo.DomainRecord{}, wrapDigitalOceanWriteError(err, domain, "could not create record for domain")
 	}
 
-	return nil
+	return *record, nil
 }
 
-// updateRecord updates an existing DNS record for the given domain, in correspondence with the given DomainRecordEditRequest
-func (transaction digitalOceanTransaction) updateRecord(domain string, existingRecord godo.DomainRecord, editRequest godo.DomainRecordEditRequest) error {
-	_, res, err := transaction.client.Domains.EditRecord(transaction.ctx, domain, existingRecord.ID, &editRequest)
+// updateRecord updates the existing DNS record with the given ID for the given domain, in correspondence with the given
+// DomainRecordEditRequest
+func (transaction digitalOceanTransaction) updateRecord(domain string, recordID int, editRequest godo.DomainRecordEditRequest) (godo.DomainRecord, error) {
+	var record *godo.DomainRecord
+	err := transaction.call(func() (*godo.Response, error) {
+		var res *godo.Response
+		var err error
+		record, res, err = transaction.client.Domains.EditRecord(transaction.ctx, domain, recordID, &editRequest)
+
+		return res, err
+	})
 	if err != nil {
-		return xerrors.Errorf("could not update record for domain: %w", err)
-	} else if resErr := godo.CheckResponse(res.Response); resErr != nil {
-		return xerrors.Errorf("could not update record for domain: %w", resErr)
+		return godo.DomainRecord{}, wrapDigitalOceanWriteError(err, domain, "could not update record for domain")
+	}
+
+	return *record, nil
+}
+
+// getRecord gets the existing DNS record with the given ID for the given domain.
+func (transaction digitalOceanTransaction) getRecord(domain string, recordID int) (godo.DomainRecord, error) {
+	var record *godo.DomainRecord
+	err := transaction.call(func() (*godo.Response, error) {
+		var res *godo.Response
+		var err error
+		record, res, err = transaction.client.Domains.Record(transaction.ctx, domain, recordID)
+
+		return res, err
+	})
+	if err != nil {
+		return godo.DomainRecord{}, xerrors.Errorf("could not get record for domain: %w", err)
+	}
+
+	return *record, nil
+}
+
+// deleteRecord deletes the existing DNS record with the given ID for the given domain.
+func (transaction digitalOceanTransaction) deleteRecord(domain string, recordID int) error {
+	err := transaction.call(func() (*godo.Response, error) {
+		return transaction.client.Domains.DeleteRecord(transaction.ctx, domain, recordID)
+	})
+	if err != nil {
+		return wrapDigitalOceanWriteError(err, domain, "could not delete record for domain")
 	}
 
 	return nil
@@ -101,7 +468,9 @@ func (transaction digitalOceanTransaction) updateRecord(domain string, existingR
 // NewDigitalOceanIPSetter makes a new DigitalOcean IPSetter
 func NewDigitalOceanIPSetter(tokenSource oauth2.TokenSource, options ...func(*DigitalOceanIPSetter) error) (DigitalOceanIPSetter, error) {
 	setter := DigitalOceanIPSetter{
-		tokenSource: tokenSource,
+		tokenSource:      tokenSource,
+		retryPolicy:      DefaultRetryPolicy,
+		maxRateLimitWait: DefaultDigitalOceanMaxRateLimitWait,
 	}
 
 	for _, option := range options {
@@ -114,45 +483,410 @@ func NewDigitalOceanIPSetter(tokenSource oauth2.TokenSource, options ...func(*Di
 	return setter, nil
 }
 
-// getDigitalOceanClient will make a new Digital Ocean API transaction for the given setter.
+// makeTransaction will make a new Digital Ocean API transaction for the given setter.
 func (setter DigitalOceanIPSetter) makeTransaction(ctx context.Context) digitalOceanTransaction {
-	oauth2Client := oauth2.NewClient(ctx, setter.tokenSource)
+	baseClient := setter.httpClient
+	if baseClient == nil {
+		baseClient = setter.httpConfig.Client()
+	}
+
+	// oauth2 will only use the base client's transport, so the timeout must be copied over explicitly.
+	oauth2Client := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, baseClient), setter.tokenSource)
+	oauth2Client.Timeout = baseClient.Timeout
+
+	client := godo.NewClient(oauth2Client)
+	if setter.baseURL != nil {
+		client.BaseURL = setter.baseURL
+	}
 
 	return digitalOceanTransaction{
-		ctx:    ctx,
-		client: godo.NewClient(oauth2Client),
+		ctx:              ctx,
+		client:           client,
+		retryPolicy:      setter.retryPolicy,
+		responseCache:    setter.responseCache,
+		maxRateLimitWait: setter.maxRateLimitWait,
 	}
 }
 
 // SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with DigitalOcean.
+// An IPv4 address is set as an A record, and an IPv6 address as an AAAA record. The apex of the domain may be given as
+// an empty name, "@", or the domain itself.
 func (setter DigitalOceanIPSetter) SetIP(domain, name string, ip net.IP) error {
-	ctx := context.Background()
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter DigitalOceanIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	return setter.setRecord(ctx, domain, Record{Type: ipRecordType(ip), Name: name, Value: ip.String()})
+}
+
+// PlanIP gets the changes that SetIP would make to DigitalOcean's records, without making them. The records are always
+// listed, even if the setter has a RecordIDCache, so that what they hold can be seen.
+func (setter DigitalOceanIPSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	transaction := setter.makeTransaction(context.Background())
+	record := setter.makeIDRecord(domain, Record{Type: ipRecordType(ip), Name: name, Value: ip.String()})
+	target := Target{Domain: domain, Name: name}
+	changes, err := planIDRecord(transaction, domain, target, record, setter.duplicatePolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan record: %w", err)
+	}
+
+	return changes, nil
+}
+
+// SetRecord sets the given record in the given domain with DigitalOcean. If the record has no TTL, the setter's TTL is
+// used. Only A and AAAA records are checked to be served by DigitalOcean's nameservers, if the setter's
+// ConvergenceCheck requires it.
+func (setter DigitalOceanIPSetter) SetRecord(domain string, desiredRecord Record) error {
+	return setter.setRecord(context.Background(), domain, desiredRecord)
+}
+
+// setRecord sets the given record in the same manner as SetRecord, giving up once the given context is done.
+func (setter DigitalOceanIPSetter) setRecord(ctx context.Context, domain string, desiredRecord Record) error {
 	transaction := setter.makeTransaction(ctx)
-	editRequest := makeARecordEditRequest(name, ip, setter.recordTTL)
-	existingRecord, err := transaction.getUpdatableARecord(domain, name, ip.String())
-	// setErr holds an error associated with setting the address, once a method has been determined.
-	var setErr error
-	if err == errNoUpdateNeeded {
+	record := setter.makeIDRecord(domain, desiredRecord)
+
+	cachedRecord, updatedCachedRecord, err := setter.updateCachedRecord(transaction, domain, record)
+	if err != nil {
+		return xerrors.Errorf("Could not set record: %w", err)
+	} else if updatedCachedRecord {
+		return setter.confirmRecord(transaction, domain, cachedRecord, record)
+	}
+
+	setRecord, err := setIDRecord(transaction, domain, record, setter.duplicatePolicy)
+	if err != nil {
+		return xerrors.Errorf("Could not set record: %w", err)
+	}
+
+	if setter.recordIDCache != nil {
+		setter.recordIDCache.SetRecordID(domain, record.Name, setRecord.Type, setRecord.ID)
+	}
+
+	return setter.confirmRecord(transaction, domain, setRecord, record)
+}
+
+// SetIPSet associates exactly the given ips with the given domain and subdomain name, in the form of DNS records with
+// DigitalOcean. IPv4 addresses are held in A records, and IPv6 addresses in AAAA records; if no addresses of one of
+// these types are given, any records of that type for the name are removed. The setter's DuplicateRecordPolicy and
+// RecordIDCache are not used, as every record for the name must be considered.
+func (setter DigitalOceanIPSetter) SetIPSet(domain, name string, ips []net.IP) error {
+	transaction := setter.makeTransaction(context.Background())
+	name = providerRecordName(domain, name, ApexName)
+
+	valuesByType := map[string][]string{ARecordType: {}, AAAARecordType: {}}
+	for _, ip := range ips {
+		recordType := ipRecordType(ip)
+		valuesByType[recordType] = append(valuesByType[recordType], ip.String())
+	}
+
+	for _, recordType := range []string{ARecordType, AAAARecordType} {
+		err := setIDRecordValues(transaction, domain, recordType, name, valuesByType[recordType], setter.recordTTL)
+		if err != nil {
+			return xerrors.Errorf("Could not set %s records: %w", recordType, err)
+		}
+	}
+
+	return nil
+}
+
+// Records gets all of the records in the given domain from DigitalOcean, of every type.
+func (setter DigitalOceanIPSetter) Records(domain string) ([]Record, error) {
+	transaction := setter.makeTransaction(context.Background())
+	digitalOceanRecords, err := transaction.listRecords(domain)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not list records: %w", err)
+	}
+
+	records := make([]Record, 0, len(digitalOceanRecords))
+	for _, record := range digitalOceanRecords {
+		records = append(records, Record{
+			Type:     record.Type,
+			Name:     record.Name,
+			Value:    record.Data,
+			TTL:      record.TTL,
+			Priority: record.Priority,
+		})
+	}
+
+	return records, nil
+}
+
+// Domains gets the name of each of the domains in the DigitalOcean account, across every page of the listing.
+func (setter DigitalOceanIPSetter) Domains() ([]string, error) {
+	transaction := setter.makeTransaction(context.Background())
+	domains := []string{}
+	for page := 1; ; page++ {
+		var pageDomains []godo.Domain
+		var res *godo.Response
+		err := transaction.call(func() (*godo.Response, error) {
+			var err error
+			listOptions := &godo.ListOptions{Page: page, PerPage: digitalOceanRecordsPerPage}
+			pageDomains, res, err = transaction.client.Domains.List(transaction.ctx, listOptions)
+
+			return res, err
+		})
+		if digitalOceanStatusCode(err) == http.StatusUnauthorized {
+			return nil, xerrors.Errorf("DigitalOcean token is invalid or has expired: %w", err)
+		} else if err != nil {
+			return nil, xerrors.Errorf("could not list page %d of domains: %w", page, err)
+		}
+
+		for _, domain := range pageDomains {
+			domains = append(domains, domain.Name)
+		}
+
+		// As with records, an empty page can only mean we've run off the end of the listing.
+		if res.Links == nil || res.Links.IsLastPage() || len(pageDomains) == 0 {
+			return domains, nil
+		}
+	}
+}
+
+// RemoveIP removes all A and AAAA records for the given domain and subdomain name from DigitalOcean.
+func (setter DigitalOceanIPSetter) RemoveIP(domain, name string) error {
+	for _, recordType := range []string{ARecordType, AAAARecordType} {
+		err := setter.RemoveRecord(domain, Record{Type: recordType, Name: name})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddRecord adds the given record to the given domain with DigitalOcean, alongside any existing records with the same
+// type and name. If the record has no TTL, the setter's TTL is used.
+func (setter DigitalOceanIPSetter) AddRecord(domain string, record Record) error {
+	transaction := setter.makeTransaction(context.Background())
+	err := addIDRecord(transaction, domain, setter.makeIDRecord(domain, record))
+	if err != nil {
+		return xerrors.Errorf("Could not add record: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveRecord removes the records in the given domain with the type and name of the given record from DigitalOcean.
+// If the record has a value, only the records with the same data are removed.
+func (setter DigitalOceanIPSetter) RemoveRecord(domain string, record Record) error {
+	transaction := setter.makeTransaction(context.Background())
+	_, err := removeIDRecords(transaction, domain, setter.makeIDRecord(domain, record))
+	if err != nil {
+		return xerrors.Errorf("Could not remove record: %w", err)
+	}
+
+	return nil
+}
+
+// makeIDRecord converts the given record in the given domain into an idRecord, using the setter's TTL if the record has
+// none. DigitalOcean names the apex of a domain "@", so any other name for it is converted.
+func (setter DigitalOceanIPSetter) makeIDRecord(domain string, record Record) idRecord {
+	name := providerRecordName(domain, record.Name, ApexName)
+
+	converted := idRecord{
+		Type:     record.Type,
+		Name:     name,
+		Value:    record.Value,
+		TTL:      record.TTL,
+		Priority: record.Priority,
+	}
+
+	if converted.TTL == 0 {
+		converted.TTL = setter.recordTTL
+	}
+
+	return converted
+}
+
+// confirmRecord confirms that the given set record holds the value of the desired record, in correspondence with the
+// setter's ConvergenceCheck. If DigitalOcean reports a different value, the record is written again.
+func (setter DigitalOceanIPSetter) confirmRecord(transaction digitalOceanTransaction, domain string, setRecord, desiredRecord idRecord) error {
+	check := setter.convergenceCheck
+	desiredRecord.ID = setRecord.ID
+	for attempt := 1; attempt <= check.MaxAttempts; attempt++ {
+		recordID, err := strconv.Atoi(setRecord.ID)
+		if err != nil {
+			return xerrors.Errorf("Could not confirm record was set: invalid DigitalOcean record ID %q: %w", setRecord.ID, err)
+		}
+
+		currentRecord, err := transaction.getRecord(domain, recordID)
+		if err != nil {
+			return xerrors.Errorf("Could not confirm record was set: %w", err)
+		} else if makeDigitalOceanIDRecord(currentRecord).sameData(desiredRecord) {
+			break
+		} else if attempt == check.MaxAttempts {
+			return xerrors.Errorf(
+				"Could not confirm record was set: record still has value %s after %d attempts",
+				currentRecord.Data,
+				check.MaxAttempts,
+			)
+		}
+
+		_, err = transaction.updateIDRecord(domain, desiredRecord)
+		if err != nil {
+			return xerrors.Errorf("Could not set record: %w", err)
+		}
+	}
+
+	// Only records that hold addresses can be looked up to confirm they are being served.
+	ip := net.ParseIP(desiredRecord.Value)
+	if !check.Resolve || ip == nil || (desiredRecord.Type != ARecordType && desiredRecord.Type != AAAARecordType) {
 		return nil
-	} else if err == errNoRecordsFound {
-		setErr = transaction.createRecord(domain, editRequest)
-	} else {
-		setErr = transaction.updateRecord(domain, existingRecord, editRequest)
 	}
 
-	if setErr != nil {
-		return xerrors.Errorf("Could not set IP: %w", setErr)
+	host := fqdn(domain, desiredRecord.Name)
+	err := waitForNameservers(transaction.ctx, digitalOceanNameservers, host, ip, check.ResolveTimeout)
+	if err != nil {
+		return xerrors.Errorf("Could not confirm record was set: %w", err)
 	}
 
 	return nil
 }
 
-// makeARecordEditRequest makes an edit request for an A record pointing to the given ip at the given subdomain.
-func makeARecordEditRequest(name string, ip net.IP, ttl int) godo.DomainRecordEditRequest {
+// updateCachedRecord updates the given record directly by its ID, if the setter has one cached, and returns the updated
+// record. If there is no cached ID, or the record with that ID no longer exists, false is returned, and the record
+// must be found by listing.
+func (setter DigitalOceanIPSetter) updateCachedRecord(transaction digitalOceanTransaction, domain string, record idRecord) (idRecord, bool, error) {
+	// Updating by ID would skip over any duplicates, so the cache can only be used if we'd ignore them anyway.
+	if setter.recordIDCache == nil || setter.duplicatePolicy != UpdateFirstDuplicate {
+		return idRecord{}, false, nil
+	}
+
+	recordID, haveRecordID := setter.recordIDCache.RecordID(domain, record.Name, record.Type)
+	if !haveRecordID {
+		return idRecord{}, false, nil
+	} else if _, err := strconv.Atoi(recordID); err != nil {
+		// A malformed ID can't have come from us, so it's best to just find the record again.
+		return idRecord{}, false, nil
+	}
+
+	record.ID = recordID
+	updatedRecord, err := transaction.updateIDRecord(domain, record)
+	if isDigitalOceanNotFoundError(err) {
+		return idRecord{}, false, nil
+	} else if err != nil {
+		return idRecord{}, false, err
+	}
+
+	return updatedRecord, true, nil
+}
+
+// CheckAccess confirms that the setter's token is able to access the given domain, using a single read call.
+// DigitalOcean does not expose the scopes of a token, so a token that can read but not write will not be caught here;
+// however, writes that are rejected for this reason will produce an error saying so.
+func (setter DigitalOceanIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	err := transaction.call(func() (*godo.Response, error) {
+		_, res, err := transaction.client.Domains.Get(transaction.ctx, domain)
+
+		return res, err
+	})
+
+	switch digitalOceanStatusCode(err) {
+	case 0:
+		if err != nil {
+			return xerrors.Errorf("could not check access to domain %s: %w", domain, err)
+		}
+
+		return nil
+	case http.StatusUnauthorized:
+		return xerrors.Errorf("DigitalOcean token is invalid or has expired: %w", err)
+	case http.StatusForbidden:
+		return xerrors.Errorf("DigitalOcean token lacks access to domain %s: %w", domain, err)
+	case http.StatusNotFound:
+		return xerrors.Errorf("domain %s does not exist in the DigitalOcean account: %w", domain, err)
+	default:
+		return xerrors.Errorf("could not check access to domain %s: %w", domain, err)
+	}
+}
+
+// isDigitalOceanNotFoundError checks if the given error is the result of DigitalOcean reporting that the requested
+// resource does not exist.
+func isDigitalOceanNotFoundError(err error) bool {
+	return digitalOceanStatusCode(err) == http.StatusNotFound
+}
+
+// digitalOceanStatusCode gets the HTTP status code of the DigitalOcean API response that caused the given error. If the
+// error was not caused by an API response, zero is returned.
+func digitalOceanStatusCode(err error) int {
+	var errResponse *godo.ErrorResponse
+	if !xerrors.As(err, &errResponse) || errResponse.Response == nil {
+		return 0
+	}
+
+	return errResponse.Response.StatusCode
+}
+
+// wrapDigitalOceanWriteError wraps an error that occurred while writing a record for the given domain with the given
+// message. If the write was rejected due to the token lacking write access, the error will say so.
+func wrapDigitalOceanWriteError(err error, domain, message string) error {
+	if digitalOceanStatusCode(err) == http.StatusForbidden {
+		return xerrors.Errorf("%s: DigitalOcean token lacks write access to domain %s: %w", message, domain, err)
+	}
+
+	return xerrors.Errorf("%s: %w", message, err)
+}
+
+// makeEditRequest makes an edit request that will make a DigitalOcean record match the given record.
+func makeEditRequest(record idRecord) godo.DomainRecordEditRequest {
 	return godo.DomainRecordEditRequest{
-		Type: ARecordType,
-		Name: name,
-		Data: ip.String(),
-		TTL:  ttl,
+		Type:     record.Type,
+		Name:     record.Name,
+		Data:     record.Value,
+		TTL:      record.TTL,
+		Priority: record.Priority,
+	}
+}
+
+// makeDigitalOceanIDRecord converts a DigitalOcean record into an idRecord.
+func makeDigitalOceanIDRecord(record godo.DomainRecord) idRecord {
+	return idRecord{
+		ID:       strconv.Itoa(record.ID),
+		Type:     record.Type,
+		Name:     record.Name,
+		Value:    record.Data,
+		TTL:      record.TTL,
+		Priority: record.Priority,
 	}
 }
+
+// digitalOceanConfig represents the JSON config of a DigitalOceanIPSetter, for use with NewSetterFromConfig.
+type digitalOceanConfig struct {
+	AccessToken      string   `json:"access_token"`
+	APIURL           string   `json:"api_url"`
+	MaxRateLimitWait Duration `json:"max_rate_limit_wait"`
+}
+
+// newDigitalOceanIPSetterFromConfig makes a DigitalOceanIPSetter from the given JSON config. All of the given shared
+// settings are supported.
+func newDigitalOceanIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := digitalOceanConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	} else if options.RecordTTL == 0 {
+		return nil, xerrors.New("a record TTL must be given")
+	}
+
+	setterOptions := []func(*DigitalOceanIPSetter) error{
+		DigitalOceanRecordTTL(options.RecordTTL),
+		DigitalOceanHTTPConfig(options.HTTPConfig),
+		DigitalOceanRetryPolicy(options.retryPolicy()),
+		DigitalOceanRecordIDCache(options.RecordIDCache),
+		DigitalOceanResponseCache(options.ResponseCache),
+		DigitalOceanDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+		DigitalOceanConvergenceCheck(options.ConvergenceCheck),
+	}
+	if config.APIURL != "" {
+		setterOptions = append(setterOptions, DigitalOceanBaseURL(config.APIURL))
+	}
+	if config.MaxRateLimitWait != 0 {
+		setterOptions = append(setterOptions, DigitalOceanMaxRateLimitWait(time.Duration(config.MaxRateLimitWait)))
+	}
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.AccessToken})
+
+	return NewDigitalOceanIPSetter(tokenSource, setterOptions...)
+}
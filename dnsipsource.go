@@ -0,0 +1,175 @@
+package pinamicdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/xerrors"
+)
+
+// DefaultDNSIPSourceTimeout is how long a DNSIPSource waits for the resolver to respond, if no other timeout is given.
+const DefaultDNSIPSourceTimeout = 5 * time.Second
+
+// Resolvers and names that respond with the address that queries come from
+const (
+	openDNSResolver        = "208.67.222.222"
+	openDNSIPv6Resolver    = "2620:119:35::35"
+	openDNSWhoAmIName      = "myip.opendns.com"
+	cloudflareResolver     = "1.1.1.1"
+	cloudflareIPv6Resolver = "2606:4700:4700::1111"
+	cloudflareWhoAmIName   = "whoami.cloudflare"
+)
+
+// DNSIPSource is an IPSource that asks a DNS resolver for the address that its queries come from, such as OpenDNS's
+// myip.opendns.com. This is lighter weight than asking a web service, and is not affected by middleboxes that
+// intercept HTTP.
+type DNSIPSource struct {
+	server     string
+	name       string
+	queryType  uint16
+	queryClass uint16
+	timeout    time.Duration
+}
+
+// DNSIPSourceQueryType should be passed to NewDNSIPSource to control the type of record that is queried for, such as
+// dns.TypeTXT. The answer may either be an A or AAAA record, or a TXT record holding the address. If not given, an A
+// record is queried for.
+func DNSIPSourceQueryType(queryType uint16) func(*DNSIPSource) error {
+	return func(source *DNSIPSource) error {
+		source.queryType = queryType
+		return nil
+	}
+}
+
+// DNSIPSourceQueryClass should be passed to NewDNSIPSource to control the class of record that is queried for, such
+// as dns.ClassCHAOS. If not given, dns.ClassINET is used.
+func DNSIPSourceQueryClass(queryClass uint16) func(*DNSIPSource) error {
+	return func(source *DNSIPSource) error {
+		source.queryClass = queryClass
+		return nil
+	}
+}
+
+// DNSIPSourceTimeout should be passed to NewDNSIPSource to control how long to wait for the resolver to respond. If
+// not given, DefaultDNSIPSourceTimeout is used.
+func DNSIPSourceTimeout(timeout time.Duration) func(*DNSIPSource) error {
+	return func(source *DNSIPSource) error {
+		if timeout <= 0 {
+			return xerrors.New("timeout must be positive")
+		}
+
+		source.timeout = timeout
+		return nil
+	}
+}
+
+// NewDNSIPSource makes a new DNSIPSource, which will query the given resolver for the given name. If the server has
+// no port, port 53 is used.
+func NewDNSIPSource(server, name string, options ...func(*DNSIPSource) error) (DNSIPSource, error) {
+	if name == "" {
+		return DNSIPSource{}, xerrors.New("could not construct DNSIPSource: no name given")
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	source := DNSIPSource{
+		server:     server,
+		name:       dns.Fqdn(name),
+		queryType:  dns.TypeA,
+		queryClass: dns.ClassINET,
+		timeout:    DefaultDNSIPSourceTimeout,
+	}
+
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return DNSIPSource{}, xerrors.Errorf("could not construct DNSIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// NewOpenDNSIPSource makes a new DNSIPSource that will ask OpenDNS's resolvers for myip.opendns.com.
+func NewOpenDNSIPSource(options ...func(*DNSIPSource) error) (DNSIPSource, error) {
+	return NewDNSIPSource(openDNSResolver, openDNSWhoAmIName, options...)
+}
+
+// NewOpenDNSIPv6Source makes a new DNSIPSource that will ask OpenDNS's resolvers for the AAAA record of
+// myip.opendns.com over IPv6, to find the current IPv6 address.
+func NewOpenDNSIPv6Source(options ...func(*DNSIPSource) error) (DNSIPSource, error) {
+	options = append([]func(*DNSIPSource) error{DNSIPSourceQueryType(dns.TypeAAAA)}, options...)
+
+	return NewDNSIPSource(openDNSIPv6Resolver, openDNSWhoAmIName, options...)
+}
+
+// NewCloudflareIPSource makes a new DNSIPSource that will ask Cloudflare's 1.1.1.1 resolver for the TXT record of
+// whoami.cloudflare, in the CHAOS class.
+func NewCloudflareIPSource(options ...func(*DNSIPSource) error) (DNSIPSource, error) {
+	return newCloudflareIPSource(cloudflareResolver, options)
+}
+
+// NewCloudflareIPv6Source makes a new DNSIPSource that will ask Cloudflare's resolver for the TXT record of
+// whoami.cloudflare over IPv6, to find the current IPv6 address.
+func NewCloudflareIPv6Source(options ...func(*DNSIPSource) error) (DNSIPSource, error) {
+	return newCloudflareIPSource(cloudflareIPv6Resolver, options)
+}
+
+// newCloudflareIPSource makes a new DNSIPSource that will ask the given Cloudflare resolver for the TXT record of
+// whoami.cloudflare, in the CHAOS class.
+func newCloudflareIPSource(resolver string, options []func(*DNSIPSource) error) (DNSIPSource, error) {
+	options = append(
+		[]func(*DNSIPSource) error{DNSIPSourceQueryType(dns.TypeTXT), DNSIPSourceQueryClass(dns.ClassCHAOS)},
+		options...,
+	)
+
+	return NewDNSIPSource(resolver, cloudflareWhoAmIName, options...)
+}
+
+// IP gets the current public IP address from the first answer that the source's resolver gives that holds one.
+func (source DNSIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source DNSIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	query := &dns.Msg{}
+	query.SetQuestion(source.name, source.queryType)
+	query.Question[0].Qclass = source.queryClass
+
+	client := dns.Client{Timeout: source.timeout}
+	response, _, err := client.ExchangeContext(ctx, query, source.server)
+	if err != nil {
+		return nil, xerrors.Errorf("could not query %s for %s: %w", source.server, source.name, err)
+	} else if response.Rcode != dns.RcodeSuccess {
+		return nil, xerrors.Errorf(
+			"%s refused query for %s: %s",
+			source.server,
+			source.name,
+			dns.RcodeToString[response.Rcode],
+		)
+	}
+
+	for _, answer := range response.Answer {
+		var ip net.IP
+		switch record := answer.(type) {
+		case *dns.A:
+			ip = record.A
+		case *dns.AAAA:
+			ip = record.AAAA
+		case *dns.TXT:
+			ip = net.ParseIP(strings.TrimSpace(strings.Join(record.Txt, "")))
+		}
+
+		if ip != nil {
+			return ip, nil
+		}
+	}
+
+	return nil, xerrors.Errorf("%s returned no address for %s", source.server, source.name)
+}
@@ -0,0 +1,187 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const duckDNSUpdateURL = "https://www.duckdns.org/update"
+
+// DuckDNSDomain is the domain under which all DuckDNS records reside.
+const DuckDNSDomain = "duckdns.org"
+
+// DefaultDuckDNSVerifyTimeout is how long a DuckDNSIPSetter waits for DuckDNS's nameservers to serve a new address, if
+// no other timeout is given.
+const DefaultDuckDNSVerifyTimeout = 2 * time.Minute
+
+// duckDNSSuccessResponse is the body of DuckDNS's response to a successful update.
+const duckDNSSuccessResponse = "OK"
+
+// duckDNSNameservers are the nameservers that serve all DuckDNS records.
+var duckDNSNameservers = []string{"ns1.duckdns.org", "ns2.duckdns.org", "ns3.duckdns.org"}
+
+func init() {
+	Register("duckdns", newDuckDNSIPSetterFromConfig)
+}
+
+// DuckDNSIPSetter is an IPSetter that will update records with DuckDNS. DuckDNS does not support TTLs, and cannot list
+// records, so each update is confirmed by waiting for DuckDNS's nameservers to serve the new address.
+type DuckDNSIPSetter struct {
+	token         string
+	httpConfig    HTTPConfig
+	retryPolicy   RetryPolicy
+	verifyTimeout time.Duration
+}
+
+// DuckDNSHTTPConfig should be passed to NewDuckDNSIPSetter to control how the HTTP client that talks to DuckDNS is
+// constructed, such as its timeouts.
+func DuckDNSHTTPConfig(config HTTPConfig) func(*DuckDNSIPSetter) error {
+	return func(setter *DuckDNSIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// DuckDNSRetryPolicy should be passed to NewDuckDNSIPSetter to control how updates are retried when they fail for
+// transient reasons. If not given, DefaultRetryPolicy is used.
+func DuckDNSRetryPolicy(policy RetryPolicy) func(*DuckDNSIPSetter) error {
+	return func(setter *DuckDNSIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// DuckDNSVerifyTimeout should be passed to NewDuckDNSIPSetter to control how long to wait for DuckDNS's nameservers to
+// serve a new address. If not given, DefaultDuckDNSVerifyTimeout is used.
+func DuckDNSVerifyTimeout(timeout time.Duration) func(*DuckDNSIPSetter) error {
+	return func(setter *DuckDNSIPSetter) error {
+		if timeout <= 0 {
+			return xerrors.New("verify timeout must be positive")
+		}
+
+		setter.verifyTimeout = timeout
+		return nil
+	}
+}
+
+// NewDuckDNSIPSetter makes a new DuckDNS IPSetter, which authenticates with the given account token.
+func NewDuckDNSIPSetter(token string, options ...func(*DuckDNSIPSetter) error) (DuckDNSIPSetter, error) {
+	setter := DuckDNSIPSetter{
+		token:         token,
+		retryPolicy:   DefaultRetryPolicy,
+		verifyTimeout: DefaultDuckDNSVerifyTimeout,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return DuckDNSIPSetter{}, xerrors.Errorf("could not construct DuckDNSIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given DuckDNS subdomain name, and waits for DuckDNS's nameservers to serve the
+// new address. The domain must be DuckDNSDomain.
+func (setter DuckDNSIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter DuckDNSIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	if domain != DuckDNSDomain {
+		return xerrors.Errorf("Could not set IP: DuckDNS only serves records under %s, not %s", DuckDNSDomain, domain)
+	}
+
+	err := setter.retryPolicy.run(ctx, func() error {
+		return setter.sendUpdate(ctx, name, ip)
+	})
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	err = waitForNameservers(ctx, duckDNSNameservers, fqdn(domain, name), ip, setter.verifyTimeout)
+	if err != nil {
+		return xerrors.Errorf("Could not confirm IP was set: %w", err)
+	}
+
+	return nil
+}
+
+// sendUpdate sends a single update to DuckDNS, associating the given ip with the given subdomain name.
+func (setter DuckDNSIPSetter) sendUpdate(ctx context.Context, name string, ip net.IP) error {
+	query := url.Values{}
+	query.Set("domains", name)
+	query.Set("token", setter.token)
+	query.Set("ip", ip.String())
+
+	req, err := http.NewRequest(http.MethodGet, duckDNSUpdateURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return xerrors.Errorf("could not build request: %w", err)
+	}
+
+	res, err := setter.httpConfig.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		// The URL holds the token, so it must not end up in any logs.
+		return redactURLError(err, duckDNSUpdateURL)
+	}
+
+	defer res.Body.Close()
+	rawResponse, err := readResponse(res)
+	if err != nil {
+		return err
+	}
+
+	if string(bytes.TrimSpace(rawResponse)) != duckDNSSuccessResponse {
+		// DuckDNS gives no reason for refusing an update.
+		return xerrors.New("DuckDNS refused update; check that the token and subdomain are correct")
+	}
+
+	return nil
+}
+
+// duckDNSConfig represents the JSON config of a DuckDNSIPSetter, for use with NewSetterFromConfig.
+type duckDNSConfig struct {
+	AccessToken   string   `json:"access_token"`
+	VerifyTimeout Duration `json:"verify_timeout"`
+}
+
+// newDuckDNSIPSetterFromConfig makes a DuckDNSIPSetter from the given JSON config and shared settings. The record TTL
+// is ignored, as DuckDNS does not support it.
+func newDuckDNSIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := duckDNSConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*DuckDNSIPSetter) error{
+		DuckDNSHTTPConfig(options.HTTPConfig),
+		DuckDNSRetryPolicy(options.retryPolicy()),
+	}
+	if config.VerifyTimeout != 0 {
+		setterOptions = append(setterOptions, DuckDNSVerifyTimeout(time.Duration(config.VerifyTimeout)))
+	}
+
+	return NewDuckDNSIPSetter(config.AccessToken, setterOptions...)
+}
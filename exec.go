@@ -0,0 +1,263 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultExecTimeout is how long an ExecIPSetter lets its command run, if no other timeout is given.
+const DefaultExecTimeout = time.Minute
+
+// ExecTempFailExitCode is the exit code with which a command run by an ExecIPSetter may indicate that it failed for a
+// transient reason, and should be retried. This is EX_TEMPFAIL from sysexits.h.
+const ExecTempFailExitCode = 75
+
+// maxExecOutputSize is the maximum number of bytes of a command's output that will be included in an error.
+const maxExecOutputSize = 1024
+
+func init() {
+	Register("exec", newExecIPSetterFromConfig)
+}
+
+// ExecIPSetter is an IPSetter that will run an external command to set records, so that providers can be added
+// without recompiling.
+//
+// The command is given the record to set both as environment variables (PINAMIC_RECORD_IP, PINAMIC_RECORD_DOMAIN,
+// PINAMIC_RECORD_NAME, and PINAMIC_RECORD_TTL), and as an ExecRequest, encoded as JSON on stdin. These are kept apart
+// from the PINAMIC_DNS_ variables that configure pinamic-dns, so that a command may run pinamic-dns itself. If the
+// command exits with a status of zero, the record is considered set. If it exits with ExecTempFailExitCode, it is
+// retried in correspondence with the setter's RetryPolicy. Optionally, the command may write an ExecResponse, encoded as
+// JSON, to stdout; if the response contains an error, the record is not considered set, regardless of the exit status.
+type ExecIPSetter struct {
+	command     string
+	args        []string
+	recordTTL   int
+	timeout     time.Duration
+	retryPolicy RetryPolicy
+}
+
+// ExecRequest is written to the stdin of the command run by an ExecIPSetter.
+type ExecRequest struct {
+	IP     string `json:"ip"`
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+// ExecResponse may be written to stdout by the command run by an ExecIPSetter.
+type ExecResponse struct {
+	// Error, if not empty, describes why the record could not be set.
+	Error string `json:"error"`
+}
+
+// execExitError is returned when the command run by an ExecIPSetter exits with a non-zero status.
+type execExitError struct {
+	command  string
+	exitCode int
+	stderr   string
+}
+
+// Error returns a description of the command's failure.
+func (err execExitError) Error() string {
+	if err.stderr == "" {
+		return fmt.Sprintf("%s exited with status %d", err.command, err.exitCode)
+	}
+
+	return fmt.Sprintf("%s exited with status %d: %s", err.command, err.exitCode, err.stderr)
+}
+
+// ExecArgs should be passed to NewExecIPSetter to give arguments to the command.
+func ExecArgs(args ...string) func(*ExecIPSetter) error {
+	return func(setter *ExecIPSetter) error {
+		setter.args = args
+		return nil
+	}
+}
+
+// ExecRecordTTL should be passed to NewExecIPSetter to pass a TTL to the command.
+func ExecRecordTTL(ttl int) func(*ExecIPSetter) error {
+	return func(setter *ExecIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// ExecTimeout should be passed to NewExecIPSetter to control how long the command may run before it is killed. If not
+// given, DefaultExecTimeout is used.
+func ExecTimeout(timeout time.Duration) func(*ExecIPSetter) error {
+	return func(setter *ExecIPSetter) error {
+		if timeout <= 0 {
+			return xerrors.New("timeout must be positive")
+		}
+
+		setter.timeout = timeout
+		return nil
+	}
+}
+
+// ExecRetryPolicy should be passed to NewExecIPSetter to control how the command is retried when it indicates that it
+// failed for a transient reason. If not given, DefaultRetryPolicy is used.
+func ExecRetryPolicy(policy RetryPolicy) func(*ExecIPSetter) error {
+	return func(setter *ExecIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// NewExecIPSetter makes a new ExecIPSetter, which will run the given command. If the command does not contain a path
+// separator, it is searched for in the PATH.
+func NewExecIPSetter(command string, options ...func(*ExecIPSetter) error) (ExecIPSetter, error) {
+	if command == "" {
+		return ExecIPSetter{}, xerrors.New("could not construct ExecIPSetter: command must be given")
+	}
+
+	setter := ExecIPSetter{
+		command:     command,
+		timeout:     DefaultExecTimeout,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return ExecIPSetter{}, xerrors.Errorf("could not construct ExecIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, by running the setter's command.
+func (setter ExecIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter ExecIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	request := ExecRequest{
+		IP:     ip.String(),
+		Domain: domain,
+		Name:   name,
+		TTL:    setter.recordTTL,
+	}
+
+	err := setter.retryPolicy.run(ctx, func() error {
+		return setter.run(ctx, request)
+	})
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// run runs the setter's command once, with the given request.
+func (setter ExecIPSetter) run(ctx context.Context, request ExecRequest) error {
+	rawRequest, err := json.Marshal(request)
+	if err != nil {
+		return xerrors.Errorf("could not encode request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, setter.timeout)
+	defer cancel()
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, setter.command, setter.args...)
+	cmd.Stdin = bytes.NewReader(rawRequest)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(
+		os.Environ(),
+		"PINAMIC_RECORD_IP="+request.IP,
+		"PINAMIC_RECORD_DOMAIN="+request.Domain,
+		"PINAMIC_RECORD_NAME="+request.Name,
+		"PINAMIC_RECORD_TTL="+strconv.Itoa(request.TTL),
+	)
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return xerrors.Errorf("%s did not finish within %s", setter.command, setter.timeout)
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		return execExitError{
+			command:  setter.command,
+			exitCode: exitErr.ExitCode(),
+			stderr:   truncatedOutput(stderr.Bytes()),
+		}
+	} else if err != nil {
+		return xerrors.Errorf("could not run %s: %w", setter.command, err)
+	}
+
+	rawResponse := bytes.TrimSpace(stdout.Bytes())
+	if len(rawResponse) == 0 {
+		return nil
+	}
+
+	response := ExecResponse{}
+	err = json.Unmarshal(rawResponse, &response)
+	if err != nil {
+		// Commands need not write a response, so anything else they write is not our concern.
+		return nil
+	} else if response.Error != "" {
+		return xerrors.Errorf("%s could not set record: %s", setter.command, response.Error)
+	}
+
+	return nil
+}
+
+// truncatedOutput gets the given output of a command, truncated so that it may be included in an error.
+func truncatedOutput(output []byte) string {
+	if len(output) > maxExecOutputSize {
+		output = output[:maxExecOutputSize]
+	}
+
+	return string(bytes.TrimSpace(output))
+}
+
+// execConfig represents the JSON config of an ExecIPSetter, for use with NewSetterFromConfig.
+type execConfig struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Timeout Duration `json:"timeout"`
+}
+
+// newExecIPSetterFromConfig makes an ExecIPSetter from the given JSON config and shared settings.
+func newExecIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := execConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.Command == "" {
+		return nil, xerrors.New("command must be given")
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*ExecIPSetter) error{
+		ExecArgs(config.Args...),
+		ExecRecordTTL(options.RecordTTL),
+		ExecRetryPolicy(options.retryPolicy()),
+	}
+	if config.Timeout != 0 {
+		setterOptions = append(setterOptions, ExecTimeout(time.Duration(config.Timeout)))
+	}
+
+	return NewExecIPSetter(config.Command, setterOptions...)
+}
@@ -0,0 +1,112 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os/exec"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultCommandIPSourceTimeout is how long a CommandIPSource lets its command run, if no other timeout is given.
+const DefaultCommandIPSourceTimeout = 30 * time.Second
+
+// commandIPSourceWaitDelay is how long a CommandIPSource waits for its command's output to be closed once the command
+// has exited or been killed.
+const commandIPSourceWaitDelay = time.Second
+
+// CommandIPSource is an IPSource that runs an external command to find the current IP address, such as a script that
+// reads it from a modem's status page. The command must write just the address to stdout and exit with a status of
+// zero.
+type CommandIPSource struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// CommandIPSourceArgs should be passed to NewCommandIPSource to give arguments to the command.
+func CommandIPSourceArgs(args ...string) func(*CommandIPSource) error {
+	return func(source *CommandIPSource) error {
+		source.args = args
+		return nil
+	}
+}
+
+// CommandIPSourceTimeout should be passed to NewCommandIPSource to control how long the command may run before it is
+// killed. If not given, DefaultCommandIPSourceTimeout is used.
+func CommandIPSourceTimeout(timeout time.Duration) func(*CommandIPSource) error {
+	return func(source *CommandIPSource) error {
+		if timeout <= 0 {
+			return xerrors.New("timeout must be positive")
+		}
+
+		source.timeout = timeout
+		return nil
+	}
+}
+
+// NewCommandIPSource makes a new CommandIPSource, which will run the given command. If the command does not contain a
+// path separator, it is searched for in the PATH.
+func NewCommandIPSource(command string, options ...func(*CommandIPSource) error) (CommandIPSource, error) {
+	if command == "" {
+		return CommandIPSource{}, xerrors.New("could not construct CommandIPSource: command must be given")
+	}
+
+	source := CommandIPSource{
+		command: command,
+		timeout: DefaultCommandIPSourceTimeout,
+	}
+
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return CommandIPSource{}, xerrors.Errorf("could not construct CommandIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the current public IP address by running the source's command.
+func (source CommandIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source CommandIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(ctx, source.timeout)
+	defer cancel()
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, source.command, source.args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Any children of the command may still hold its output open once it is killed, so don't wait long for them.
+	cmd.WaitDelay = commandIPSourceWaitDelay
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, xerrors.Errorf("%s did not finish within %s", source.command, source.timeout)
+	} else if ctx.Err() != nil {
+		return nil, xerrors.Errorf("%s was stopped: %w", source.command, ctx.Err())
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, execExitError{
+			command:  source.command,
+			exitCode: exitErr.ExitCode(),
+			stderr:   truncatedOutput(stderr.Bytes()),
+		}
+	} else if err != nil {
+		return nil, xerrors.Errorf("could not run %s: %w", source.command, err)
+	}
+
+	rawIP := truncatedOutput(stdout.Bytes())
+	ip := net.ParseIP(rawIP)
+	if ip == nil {
+		return nil, xerrors.Errorf("%s returned something that is not an IP address: %q", source.command, rawIP)
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,142 @@
+package pinamicdns
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/xerrors"
+)
+
+// FailoverSetter is an IPSetter that sets records with the first of several IPSetters that succeeds, such as to fall
+// back to a secondary provider when the primary one is having an outage. Setters are tried in the order they are given.
+type FailoverSetter struct {
+	setters     []NamedIPSetter
+	retryPolicy RetryPolicy
+	abortOn     func(error) bool
+}
+
+// FailoverRetryPolicy should be passed to NewFailoverSetter to control how many times each setter is tried, when it
+// fails for transient reasons, before falling back to the next. If not given, each setter is tried once; most setters
+// already retry their own calls.
+func FailoverRetryPolicy(policy RetryPolicy) func(*FailoverSetter) {
+	return func(setter *FailoverSetter) {
+		setter.retryPolicy = policy
+	}
+}
+
+// FailoverAbortOn should be passed to NewFailoverSetter to stop falling back when a setter returns an error for which
+// the given function returns true, such as one that the other setters would be certain to return as well.
+func FailoverAbortOn(shouldAbort func(error) bool) func(*FailoverSetter) {
+	return func(setter *FailoverSetter) {
+		setter.abortOn = shouldAbort
+	}
+}
+
+// FailoverAbortOnPermanentError should be passed to NewFailoverSetter to only fall back when a setter fails for a
+// transient reason, such as a timeout or a server error. Any other error is returned immediately.
+func FailoverAbortOnPermanentError() func(*FailoverSetter) {
+	return FailoverAbortOn(func(err error) bool {
+		return !isTransientError(err)
+	})
+}
+
+// NewFailoverSetter makes a new FailoverSetter, which will try the given setters in order. Each setter must have a
+// unique name, and at least one must be given.
+func NewFailoverSetter(setters []NamedIPSetter, options ...func(*FailoverSetter)) (FailoverSetter, error) {
+	if len(setters) == 0 {
+		return FailoverSetter{}, xerrors.New("could not construct FailoverSetter: no setters given")
+	}
+
+	names := map[string]bool{}
+	for _, setter := range setters {
+		if names[setter.Name] {
+			return FailoverSetter{}, xerrors.Errorf("could not construct FailoverSetter: name %q is used more than once", setter.Name)
+		}
+
+		names[setter.Name] = true
+	}
+
+	setter := FailoverSetter{
+		setters:     setters,
+		retryPolicy: RetryPolicy{MaxAttempts: 1},
+		abortOn:     func(error) bool { return false },
+	}
+
+	for _, option := range options {
+		option(&setter)
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, using the first of the setter's IPSetters
+// that succeeds. If an IPSetter is also an AccessChecker, its access is checked first. If every IPSetter fails, or
+// falling back is aborted, a MultiSetError holding each failure is returned.
+func (setter FailoverSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter FailoverSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	errs := MultiSetError{}
+	for _, namedSetter := range setter.setters {
+		if !namedSetter.sets(ip) {
+			continue
+		}
+
+		err := setter.retryPolicy.run(ctx, func() error {
+			return namedSetter.setIP(ctx, domain, name, ip)
+		})
+
+		if err == nil {
+			return nil
+		}
+
+		errs[namedSetter.Name] = err
+		if setter.abortOn(err) {
+			break
+		}
+	}
+
+	// No setter sets records of this type, so there was nothing to do.
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// PlanIP gets the changes that SetIP would make with the first of the setter's IPSetters that is able to plan them,
+// which, barring an outage, is the one that SetIP would use. If none are, a MultiSetError holding each failure is
+// returned.
+func (setter FailoverSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	errs := MultiSetError{}
+	for _, namedSetter := range setter.setters {
+		if !namedSetter.sets(ip) {
+			continue
+		}
+
+		changes, err := namedSetter.planIP(context.Background(), domain, name, ip)
+		if err == nil {
+			return changes, nil
+		}
+
+		errs[namedSetter.Name] = err
+		if setter.abortOn(err) {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return []RecordChange{}, nil
+	}
+
+	return nil, errs
+}
+
+// RemoveIP removes the records for the given domain and subdomain name using every one of the setter's IPSetters, as
+// any of them may have been the one to set them. Each IPSetter must also be an IPRemover. If any of them fail, a
+// MultiSetError is returned.
+func (setter FailoverSetter) RemoveIP(domain, name string) error {
+	return removeIPs(setter.setters, domain, name)
+}
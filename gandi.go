@@ -0,0 +1,225 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/xerrors"
+)
+
+const gandiAPIBaseURL = "https://api.gandi.net/v5/livedns"
+
+// gandiApexName is the name that Gandi gives the records at the apex of a domain.
+const gandiApexName = "@"
+
+func init() {
+	Register("gandi", newGandiIPSetterFromConfig)
+}
+
+// GandiIPSetter is an IPSetter that will update records with Gandi LiveDNS
+type GandiIPSetter struct {
+	apiToken        string
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+	duplicatePolicy DuplicateRecordPolicy
+}
+
+// gandiTransaction holds all elements necessary to talk to the Gandi LiveDNS API, in the context of a single
+// GandiIPSetter.SetIP call.
+type gandiTransaction struct {
+	client restClient
+}
+
+// gandiRRSet is a set of all of the records with a given name and type, as represented by the Gandi LiveDNS API.
+// Unlike most providers, Gandi does not identify individual records; the entire set is replaced at once.
+type gandiRRSet struct {
+	TTL    int      `json:"rrset_ttl,omitempty"`
+	Values []string `json:"rrset_values"`
+}
+
+// GandiRecordTTL should be passed to NewGandiIPSetter if a TTL is desired for the records it sets. Gandi does not
+// allow TTLs of less than 300 seconds. If not given, Gandi's default TTL is used.
+func GandiRecordTTL(ttl int) func(*GandiIPSetter) error {
+	return func(setter *GandiIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// GandiHTTPConfig should be passed to NewGandiIPSetter to control how the HTTP client that talks to the Gandi LiveDNS
+// API is constructed, such as its timeouts.
+func GandiHTTPConfig(config HTTPConfig) func(*GandiIPSetter) error {
+	return func(setter *GandiIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// GandiRetryPolicy should be passed to NewGandiIPSetter to control how calls to the Gandi LiveDNS API are retried
+// when they fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func GandiRetryPolicy(policy RetryPolicy) func(*GandiIPSetter) error {
+	return func(setter *GandiIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// GandiDuplicateRecordPolicy should be passed to NewGandiIPSetter to control what is done when the name already has
+// several addresses. Because Gandi holds these addresses in a single set, UpdateAllDuplicates and
+// ConsolidateDuplicates both replace the set with only the new address. If not given, UpdateFirstDuplicate is used.
+func GandiDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*GandiIPSetter) error {
+	return func(setter *GandiIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// NewGandiIPSetter makes a new Gandi LiveDNS IPSetter, which authenticates with the given personal access token. The
+// token must have permission to manage the domain's technical configuration.
+func NewGandiIPSetter(apiToken string, options ...func(*GandiIPSetter) error) (GandiIPSetter, error) {
+	setter := GandiIPSetter{
+		apiToken:    apiToken,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return GandiIPSetter{}, xerrors.Errorf("could not construct GandiIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeTransaction will make a new Gandi LiveDNS API transaction for the given setter.
+func (setter GandiIPSetter) makeTransaction(ctx context.Context) gandiTransaction {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+setter.apiToken)
+
+	return gandiTransaction{
+		client: newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, gandiAPIBaseURL, header),
+	}
+}
+
+// getRRSet gets the set of records for the given domain with the given name and type. If no such records exist, an
+// empty set is returned.
+func (transaction gandiTransaction) getRRSet(domain, name, recordType string) (gandiRRSet, error) {
+	rrset := gandiRRSet{}
+	err := transaction.client.do(http.MethodGet, gandiRRSetPath(domain, name, recordType), nil, &rrset)
+	if httpStatusCode(err) == http.StatusNotFound {
+		return gandiRRSet{}, nil
+	} else if err != nil {
+		return gandiRRSet{}, xerrors.Errorf("could not ask Gandi LiveDNS API for records: %w", err)
+	}
+
+	return rrset, nil
+}
+
+// putRRSet replaces the set of records for the given domain with the given name and type, creating it if it does not
+// exist.
+func (transaction gandiTransaction) putRRSet(domain, name, recordType string, rrset gandiRRSet) error {
+	err := transaction.client.do(http.MethodPut, gandiRRSetPath(domain, name, recordType), rrset, nil)
+	if err != nil {
+		return xerrors.Errorf("could not set records for domain: %w", err)
+	}
+
+	return nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with Gandi.
+func (setter GandiIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter GandiIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	transaction := setter.makeTransaction(ctx)
+	recordType := ipRecordType(ip)
+	existingRRSet, err := transaction.getRRSet(domain, name, recordType)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	desiredRRSet := gandiRRSet{
+		TTL:    setter.recordTTL,
+		Values: desiredRRSetValues(existingRRSet.Values, ip.String(), setter.duplicatePolicy),
+	}
+
+	if gandiRRSetUpToDate(existingRRSet, desiredRRSet) {
+		return nil
+	}
+
+	err = transaction.putRRSet(domain, name, recordType, desiredRRSet)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// CheckAccess confirms that the setter's token is able to access the given domain.
+func (setter GandiIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	err := transaction.client.do(http.MethodGet, "/domains/"+url.PathEscape(domain), nil, nil)
+	switch httpStatusCode(err) {
+	case 0:
+		return err
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return xerrors.Errorf("Gandi token lacks access to domain %s: %w", domain, err)
+	case http.StatusNotFound:
+		return xerrors.Errorf("domain %s does not exist in the Gandi account, or does not use LiveDNS: %w", domain, err)
+	default:
+		return xerrors.Errorf("could not check access to domain %s: %w", domain, err)
+	}
+}
+
+// gandiRRSetUpToDate checks whether or not the given existing rrset already matches the desired one. If the desired
+// rrset has no TTL, the existing TTL is not considered.
+func gandiRRSetUpToDate(existingRRSet, desiredRRSet gandiRRSet) bool {
+	if desiredRRSet.TTL != 0 && existingRRSet.TTL != desiredRRSet.TTL {
+		return false
+	}
+
+	return rrsetValuesEqual(existingRRSet.Values, desiredRRSet.Values)
+}
+
+// gandiRRSetPath gets the path of the rrset for the given domain with the given name and type.
+func gandiRRSetPath(domain, name, recordType string) string {
+	name = providerRecordName(domain, name, gandiApexName)
+
+	return "/domains/" + url.PathEscape(domain) + "/records/" + url.PathEscape(name) + "/" + recordType
+}
+
+// gandiConfig represents the JSON config of a GandiIPSetter, for use with NewSetterFromConfig.
+type gandiConfig struct {
+	AccessToken string `json:"access_token"`
+}
+
+// newGandiIPSetterFromConfig makes a GandiIPSetter from the given JSON config and shared settings.
+func newGandiIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := gandiConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGandiIPSetter(
+		config.AccessToken,
+		GandiRecordTTL(options.RecordTTL),
+		GandiHTTPConfig(options.HTTPConfig),
+		GandiRetryPolicy(options.retryPolicy()),
+		GandiDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+	)
+}
@@ -1,9 +1,14 @@
 module github.com/ollien/pinamic-dns
 
 require (
+	filippo.io/age v1.0.0
+	github.com/aws/aws-sdk-go v1.44.0
 	github.com/digitalocean/godo v1.22.0
+	github.com/miekg/dns v1.1.50
 	github.com/ogier/pflag v0.0.1
 	github.com/ollien/xtrace v0.2.0
+	golang.org/x/net v0.7.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
-	golang.org/x/xerrors v0.0.0-20191011141410-1b5146add898
+	golang.org/x/sys v0.5.0
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
@@ -0,0 +1,322 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/xerrors"
+)
+
+const hetznerAPIBaseURL = "https://dns.hetzner.com/api/v1"
+
+// hetznerApexName is the name that Hetzner gives the records at the apex of a zone.
+const hetznerApexName = "@"
+
+func init() {
+	Register("hetzner", newHetznerIPSetterFromConfig)
+}
+
+// HetznerIPSetter is an IPSetter that will update records with Hetzner DNS
+type HetznerIPSetter struct {
+	apiToken        string
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+	duplicatePolicy DuplicateRecordPolicy
+}
+
+// hetznerTransaction holds all elements necessary to talk to the Hetzner DNS API, in the context of a single
+// HetznerIPSetter.SetIP call.
+type hetznerTransaction struct {
+	client restClient
+}
+
+// hetznerZone is a zone, as represented by the Hetzner DNS API.
+type hetznerZone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// hetznerRecord is a DNS record, as represented by the Hetzner DNS API.
+type hetznerRecord struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+// hetznerMeta holds the pagination information of a Hetzner DNS API listing.
+type hetznerMeta struct {
+	Pagination struct {
+		Page     int `json:"page"`
+		LastPage int `json:"last_page"`
+	} `json:"pagination"`
+}
+
+// HetznerRecordTTL should be passed to NewHetznerIPSetter if a TTL is desired for the records it sets. If not given,
+// the zone's default TTL is used.
+func HetznerRecordTTL(ttl int) func(*HetznerIPSetter) error {
+	return func(setter *HetznerIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// HetznerHTTPConfig should be passed to NewHetznerIPSetter to control how the HTTP client that talks to the Hetzner
+// DNS API is constructed, such as its timeouts.
+func HetznerHTTPConfig(config HTTPConfig) func(*HetznerIPSetter) error {
+	return func(setter *HetznerIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// HetznerRetryPolicy should be passed to NewHetznerIPSetter to control how calls to the Hetzner DNS API are retried
+// when they fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func HetznerRetryPolicy(policy RetryPolicy) func(*HetznerIPSetter) error {
+	return func(setter *HetznerIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// HetznerDuplicateRecordPolicy should be passed to NewHetznerIPSetter to control what is done when several records
+// exist for the same name. If not given, UpdateFirstDuplicate is used.
+func HetznerDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*HetznerIPSetter) error {
+	return func(setter *HetznerIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// NewHetznerIPSetter makes a new Hetzner DNS IPSetter, which authenticates with the given API token.
+func NewHetznerIPSetter(apiToken string, options ...func(*HetznerIPSetter) error) (HetznerIPSetter, error) {
+	setter := HetznerIPSetter{
+		apiToken:    apiToken,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return HetznerIPSetter{}, xerrors.Errorf("could not construct HetznerIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeTransaction will make a new Hetzner DNS API transaction for the given setter.
+func (setter HetznerIPSetter) makeTransaction(ctx context.Context) hetznerTransaction {
+	header := http.Header{}
+	header.Set("Auth-API-Token", setter.apiToken)
+
+	return hetznerTransaction{
+		client: newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, hetznerAPIBaseURL, header),
+	}
+}
+
+// getZoneID gets the ID Hetzner has assigned to the zone for the given domain.
+func (transaction hetznerTransaction) getZoneID(domain string) (string, error) {
+	var response struct {
+		Zones []hetznerZone `json:"zones"`
+	}
+
+	err := transaction.client.do(http.MethodGet, "/zones?name="+url.QueryEscape(domain), nil, &response)
+	if httpStatusCode(err) == http.StatusNotFound {
+		return "", xerrors.Errorf("zone for %s does not exist in the Hetzner account", domain)
+	} else if err != nil {
+		return "", xerrors.Errorf("could not ask Hetzner DNS API for zone: %w", err)
+	}
+
+	for _, zone := range response.Zones {
+		if zone.Name == domain {
+			return zone.ID, nil
+		}
+	}
+
+	return "", xerrors.Errorf("zone for %s does not exist in the Hetzner account", domain)
+}
+
+// listIDRecords gets all of the records with the given type and name in the zone with the given ID.
+func (transaction hetznerTransaction) listIDRecords(zoneID, recordType, name string) ([]idRecord, error) {
+	records := []idRecord{}
+	for page := 1; ; page++ {
+		var response struct {
+			Records []hetznerRecord `json:"records"`
+			Meta    hetznerMeta     `json:"meta"`
+		}
+
+		path := fmt.Sprintf("/records?zone_id=%s&page=%d", url.QueryEscape(zoneID), page)
+		err := transaction.client.do(http.MethodGet, path, nil, &response)
+		if err != nil {
+			return nil, xerrors.Errorf("could not ask Hetzner DNS API for records: %w", err)
+		}
+
+		for _, record := range response.Records {
+			if record.Type == recordType && record.Name == name {
+				records = append(records, record.idRecord())
+			}
+		}
+
+		if response.Meta.Pagination.Page >= response.Meta.Pagination.LastPage {
+			return records, nil
+		}
+	}
+}
+
+// createIDRecord creates the given record in the zone with the given ID.
+func (transaction hetznerTransaction) createIDRecord(zoneID string, record idRecord) (idRecord, error) {
+	var response struct {
+		Record hetznerRecord `json:"record"`
+	}
+
+	err := transaction.client.create("/records", makeHetznerRecord(zoneID, record), &response)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not create record for zone: %w", err)
+	}
+
+	return response.Record.idRecord(), nil
+}
+
+// updateIDRecord replaces the record with the ID of the given record, in the zone with the given ID.
+func (transaction hetznerTransaction) updateIDRecord(zoneID string, record idRecord) (idRecord, error) {
+	var response struct {
+		Record hetznerRecord `json:"record"`
+	}
+
+	err := transaction.client.do(http.MethodPut, "/records/"+record.ID, makeHetznerRecord(zoneID, record), &response)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not update record for zone: %w", err)
+	}
+
+	return response.Record.idRecord(), nil
+}
+
+// deleteIDRecord deletes the record with the ID of the given record.
+func (transaction hetznerTransaction) deleteIDRecord(zoneID string, record idRecord) error {
+	err := transaction.client.do(http.MethodDelete, "/records/"+record.ID, nil, nil)
+	if err != nil {
+		return xerrors.Errorf("could not delete record for zone: %w", err)
+	}
+
+	return nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with Hetzner.
+func (setter HetznerIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter HetznerIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	transaction := setter.makeTransaction(ctx)
+	zoneID, err := transaction.getZoneID(domain)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	record := setter.ipRecord(domain, name, ip)
+	_, err = setIDRecord(transaction, zoneID, record, setter.duplicatePolicy)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// PlanIP gets the changes that SetIP would make to Hetzner's records, without making them.
+func (setter HetznerIPSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	transaction := setter.makeTransaction(context.Background())
+	zoneID, err := transaction.getZoneID(domain)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	target := Target{Domain: domain, Name: name}
+	changes, err := planIDRecord(transaction, zoneID, target, setter.ipRecord(domain, name, ip), setter.duplicatePolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	return changes, nil
+}
+
+// ipRecord makes the record that associates the given ip with the given domain and subdomain name.
+func (setter HetznerIPSetter) ipRecord(domain, name string, ip net.IP) idRecord {
+	return idRecord{
+		Type:  ipRecordType(ip),
+		Name:  providerRecordName(domain, name, hetznerApexName),
+		Value: ip.String(),
+		TTL:   setter.recordTTL,
+	}
+}
+
+// CheckAccess confirms that the setter's token is able to access the zone for the given domain.
+func (setter HetznerIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	_, err := transaction.getZoneID(domain)
+	switch httpStatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return xerrors.Errorf("Hetzner token lacks access to zone for %s: %w", domain, err)
+	default:
+		return err
+	}
+}
+
+// idRecord converts the Hetzner record into an idRecord.
+func (record hetznerRecord) idRecord() idRecord {
+	return idRecord{
+		ID:    record.ID,
+		Type:  record.Type,
+		Name:  record.Name,
+		Value: record.Value,
+		TTL:   record.TTL,
+	}
+}
+
+// makeHetznerRecord converts an idRecord into a Hetzner record in the zone with the given ID.
+func makeHetznerRecord(zoneID string, record idRecord) hetznerRecord {
+	return hetznerRecord{
+		ZoneID: zoneID,
+		Type:   record.Type,
+		Name:   record.Name,
+		Value:  record.Value,
+		TTL:    record.TTL,
+	}
+}
+
+// hetznerConfig represents the JSON config of a HetznerIPSetter, for use with NewSetterFromConfig.
+type hetznerConfig struct {
+	AccessToken string `json:"access_token"`
+}
+
+// newHetznerIPSetterFromConfig makes a HetznerIPSetter from the given JSON config and shared settings.
+func newHetznerIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := hetznerConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHetznerIPSetter(
+		config.AccessToken,
+		HetznerRecordTTL(options.RecordTTL),
+		HetznerHTTPConfig(options.HTTPConfig),
+		HetznerRetryPolicy(options.retryPolicy()),
+		HetznerDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+	)
+}
@@ -0,0 +1,114 @@
+package pinamicdns
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Timeouts that will be used by HTTPConfig if none are specified.
+const (
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultRequestTimeout = 30 * time.Second
+)
+
+// HTTPConfig describes how outbound HTTP clients should be constructed.
+// Any zero valued timeouts will be replaced with their defaults.
+type HTTPConfig struct {
+	// ConnectTimeout is the maximum amount of time that establishing a connection (including a TLS handshake) may take.
+	ConnectTimeout time.Duration
+	// RequestTimeout is the maximum amount of time that a request may take, including reading the response body.
+	RequestTimeout time.Duration
+	// Proxy is the URL of an HTTP, HTTPS, or SOCKS5 proxy that all requests will be made through. If nil, the proxy
+	// specified by the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables is used, if any.
+	Proxy *url.URL
+	// Network is the network that connections are made over: tcp4 or tcp6, to only connect over IPv4 or IPv6
+	// respectively. If empty, connections may be made over either.
+	Network string
+}
+
+// Client makes a new http.Client in correspondence with the config.
+func (config HTTPConfig) Client() *http.Client {
+	connectTimeout := config.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+
+	requestTimeout := config.RequestTimeout
+	if requestTimeout == 0 {
+		requestTimeout = DefaultRequestTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = http.ProxyURL(config.Proxy)
+	}
+
+	dialContext := dialer.DialContext
+	if config.Network != "" {
+		dialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, config.Network, address)
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: requestTimeout,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   requestTimeout,
+	}
+}
+
+// rateLimitWait determines how long to wait before retrying a request that was rejected for exceeding a rate limit,
+// based on the Retry-After and RateLimit-Reset headers of the response. If neither header carries a usable value,
+// false is returned.
+func rateLimitWait(header http.Header, now time.Time) (time.Duration, bool) {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		} else if retryTime, err := http.ParseTime(retryAfter); err == nil {
+			return nonNegativeDuration(retryTime.Sub(now)), true
+		}
+	}
+
+	if reset := header.Get("RateLimit-Reset"); reset != "" {
+		if resetUnix, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			return nonNegativeDuration(time.Unix(resetUnix, 0).Sub(now)), true
+		}
+	}
+
+	return 0, false
+}
+
+// nonNegativeDuration returns the given duration, or zero if it is negative.
+func nonNegativeDuration(duration time.Duration) time.Duration {
+	if duration < 0 {
+		return 0
+	}
+
+	return duration
+}
+
+// redactURLError replaces the URL held by the given error, if it is a *url.Error, with the given redacted URL. This
+// should be used when the URL of a request holds credentials, so that they do not end up in any logs.
+func redactURLError(err error, redactedURL string) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		urlErr.URL = redactedURL
+	}
+
+	return err
+}
@@ -0,0 +1,74 @@
+package pinamicdns
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Date(2026, time.January, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   http.Header
+		wantWait time.Duration
+		wantOK   bool
+	}{
+		{
+			name:   "no headers",
+			header: http.Header{},
+		},
+		{
+			name:     "Retry-After in seconds",
+			header:   http.Header{"Retry-After": {"30"}},
+			wantWait: 30 * time.Second,
+			wantOK:   true,
+		},
+		{
+			name:     "Retry-After as a date",
+			header:   http.Header{"Retry-After": {now.Add(time.Minute).Format(http.TimeFormat)}},
+			wantWait: time.Minute,
+			wantOK:   true,
+		},
+		{
+			name:   "Retry-After as a date that has passed",
+			header: http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}},
+			wantOK: true,
+		},
+		{
+			name:     "RateLimit-Reset",
+			header:   http.Header{"Ratelimit-Reset": {"1767366365"}},
+			wantWait: 2 * time.Minute,
+			wantOK:   true,
+		},
+		{
+			name:     "Retry-After is preferred to RateLimit-Reset",
+			header:   http.Header{"Retry-After": {"5"}, "Ratelimit-Reset": {"1767366365"}},
+			wantWait: 5 * time.Second,
+			wantOK:   true,
+		},
+		{
+			name:     "an unusable Retry-After falls back to RateLimit-Reset",
+			header:   http.Header{"Retry-After": {"soon"}, "Ratelimit-Reset": {"1767366365"}},
+			wantWait: 2 * time.Minute,
+			wantOK:   true,
+		},
+		{
+			name:   "negative Retry-After",
+			header: http.Header{"Retry-After": {"-5"}},
+		},
+		{
+			name:   "unusable RateLimit-Reset",
+			header: http.Header{"Ratelimit-Reset": {"later"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wait, ok := rateLimitWait(test.header, now)
+			if wait != test.wantWait || ok != test.wantOK {
+				t.Errorf("got (%s, %t), want (%s, %t)", wait, ok, test.wantWait, test.wantOK)
+			}
+		})
+	}
+}
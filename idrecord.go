@@ -0,0 +1,264 @@
+package pinamicdns
+
+import (
+	"sort"
+	"strconv"
+)
+
+// idRecord is a DNS record held by a provider that identifies its records by ID.
+type idRecord struct {
+	ID    string
+	Type  string
+	Name  string
+	Value string
+	TTL   int
+	// Priority is the priority of the record, for those types that have one, such as MX.
+	Priority int
+}
+
+// idRecordAPI is implemented by the transactions of providers whose records are listed, created, updated, and deleted
+// by ID. These providers all share the same flow of setting a record, which is implemented by setIDRecord. The zone
+// passed to each method identifies where the records reside, in whatever form the provider requires.
+type idRecordAPI interface {
+	// listIDRecords gets all of the records in the given zone with the given type and name.
+	listIDRecords(zone, recordType, name string) ([]idRecord, error)
+	// createIDRecord creates the given record in the given zone, returning the created record.
+	createIDRecord(zone string, record idRecord) (idRecord, error)
+	// updateIDRecord updates the record in the given zone with the ID of the given record to match it, returning the
+	// updated record.
+	updateIDRecord(zone string, record idRecord) (idRecord, error)
+	// deleteIDRecord deletes the record in the given zone with the ID of the given record.
+	deleteIDRecord(zone string, record idRecord) error
+}
+
+// setIDRecord sets the given record in the given zone using the given API. If no records with the same type and name
+// exist, one is created; otherwise, the existing records are brought up to date in correspondence with the given
+// DuplicateRecordPolicy. The record that holds the new value is returned.
+func setIDRecord(api idRecordAPI, zone string, record idRecord, policy DuplicateRecordPolicy) (idRecord, error) {
+	existingRecords, err := api.listIDRecords(zone, record.Type, record.Name)
+	if err != nil {
+		return idRecord{}, err
+	}
+
+	if len(existingRecords) == 0 {
+		return api.createIDRecord(zone, record)
+	}
+
+	sortIDRecords(existingRecords)
+	switch policy {
+	case UpdateAllDuplicates:
+		return updateAllIDRecords(api, zone, existingRecords, record)
+	case ConsolidateDuplicates:
+		return consolidateIDRecords(api, zone, existingRecords, record)
+	default:
+		return updateFirstIDRecord(api, zone, existingRecords, record)
+	}
+}
+
+// addIDRecord adds the given record to the given zone using the given API, alongside any existing records with the
+// same type and name. If one of them already holds the same data, nothing is added.
+func addIDRecord(api idRecordAPI, zone string, record idRecord) error {
+	existingRecords, err := api.listIDRecords(zone, record.Type, record.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, existingRecord := range existingRecords {
+		if existingRecord.sameData(record) {
+			return nil
+		}
+	}
+
+	_, err = api.createIDRecord(zone, record)
+
+	return err
+}
+
+// removeIDRecords removes the records in the given zone with the type and name of the given record, using the given
+// API. If the given record has a value, only those records holding the same data are removed. The number of records
+// removed is returned.
+func removeIDRecords(api idRecordAPI, zone string, record idRecord) (int, error) {
+	existingRecords, err := api.listIDRecords(zone, record.Type, record.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, existingRecord := range existingRecords {
+		if record.Value != "" && !existingRecord.sameData(record) {
+			continue
+		}
+
+		err := api.deleteIDRecord(zone, existingRecord)
+		if err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// setIDRecordValues ensures that the records in the given zone with the given type and name hold exactly the given
+// values, with the given TTL, using the given API. Existing records which hold one of the values are kept, existing
+// records which do not are reused for values that are missing, and any left over are deleted.
+func setIDRecordValues(api idRecordAPI, zone, recordType, name string, values []string, ttl int) error {
+	existingRecords, err := api.listIDRecords(zone, recordType, name)
+	if err != nil {
+		return err
+	}
+
+	sortIDRecords(existingRecords)
+	missingValues := map[string]bool{}
+	for _, value := range values {
+		missingValues[value] = true
+	}
+
+	unneededRecords := []idRecord{}
+	for _, existingRecord := range existingRecords {
+		if missingValues[existingRecord.Value] {
+			delete(missingValues, existingRecord.Value)
+			if existingRecord.TTL != ttl {
+				existingRecord.TTL = ttl
+				_, err := api.updateIDRecord(zone, existingRecord)
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		unneededRecords = append(unneededRecords, existingRecord)
+	}
+
+	for _, value := range values {
+		if !missingValues[value] {
+			continue
+		}
+
+		delete(missingValues, value)
+		record := idRecord{Type: recordType, Name: name, Value: value, TTL: ttl}
+		if len(unneededRecords) == 0 {
+			_, err = api.createIDRecord(zone, record)
+		} else {
+			record.ID = unneededRecords[0].ID
+			unneededRecords = unneededRecords[1:]
+			_, err = api.updateIDRecord(zone, record)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, unneededRecord := range unneededRecords {
+		err := api.deleteIDRecord(zone, unneededRecord)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateFirstIDRecord updates the first of the given existing records which does not have the value of the given
+// record. If all records have the same value, the first of them is updated only if its TTL differs from that of the
+// given record. The record that holds the new value is returned.
+func updateFirstIDRecord(api idRecordAPI, zone string, existingRecords []idRecord, record idRecord) (idRecord, error) {
+	for _, existingRecord := range existingRecords {
+		if !existingRecord.sameData(record) {
+			record.ID = existingRecord.ID
+			return api.updateIDRecord(zone, record)
+		}
+	}
+
+	if !existingRecords[0].upToDate(record) {
+		record.ID = existingRecords[0].ID
+		return api.updateIDRecord(zone, record)
+	}
+
+	return existingRecords[0], nil
+}
+
+// updateAllIDRecords updates all of the given existing records which do not have the value or TTL of the given record.
+// The first record that holds the new value is returned.
+func updateAllIDRecords(api idRecordAPI, zone string, existingRecords []idRecord, record idRecord) (idRecord, error) {
+	for i, existingRecord := range existingRecords {
+		if existingRecord.upToDate(record) {
+			continue
+		}
+
+		record.ID = existingRecord.ID
+		updatedRecord, err := api.updateIDRecord(zone, record)
+		if err != nil {
+			return idRecord{}, err
+		}
+
+		existingRecords[i] = updatedRecord
+	}
+
+	return existingRecords[0], nil
+}
+
+// consolidateIDRecords ensures that only one of the given existing records remains, holding the value of the given
+// record. A record which already has the value is preferred to be kept; otherwise, the first record is updated. The
+// kept record is also updated if its TTL differs from that of the given record. The remaining record is returned.
+func consolidateIDRecords(api idRecordAPI, zone string, existingRecords []idRecord, record idRecord) (idRecord, error) {
+	keptIndex := 0
+	for i, existingRecord := range existingRecords {
+		if existingRecord.sameData(record) {
+			keptIndex = i
+			break
+		}
+	}
+
+	keptRecord := existingRecords[keptIndex]
+	if !keptRecord.upToDate(record) {
+		record.ID = keptRecord.ID
+		var err error
+		keptRecord, err = api.updateIDRecord(zone, record)
+		if err != nil {
+			return idRecord{}, err
+		}
+	}
+
+	for i, existingRecord := range existingRecords {
+		if i == keptIndex {
+			continue
+		}
+
+		err := api.deleteIDRecord(zone, existingRecord)
+		if err != nil {
+			return idRecord{}, err
+		}
+	}
+
+	return keptRecord, nil
+}
+
+// sameData checks whether or not the record holds the same data as the other record, regardless of its ID or TTL.
+func (record idRecord) sameData(other idRecord) bool {
+	return record.Value == other.Value && record.Priority == other.Priority
+}
+
+// upToDate checks whether or not the record holds the same data as the desired record, with the same TTL. If the
+// desired record has no TTL, the provider chooses one, so the TTL is not compared.
+func (record idRecord) upToDate(desired idRecord) bool {
+	return record.sameData(desired) && (desired.TTL == 0 || record.TTL == desired.TTL)
+}
+
+// sortIDRecords sorts the given records by their IDs, so that the records chosen by setIDRecord are deterministic.
+// IDs that are entirely numeric are compared numerically.
+func sortIDRecords(records []idRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		iID, iErr := strconv.ParseInt(records[i].ID, 10, 64)
+		jID, jErr := strconv.ParseInt(records[j].ID, 10, 64)
+		if iErr == nil && jErr == nil {
+			return iID < jID
+		}
+
+		return records[i].ID < records[j].ID
+	})
+}
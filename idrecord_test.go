@@ -0,0 +1,212 @@
+package pinamicdns
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// fakeIDRecordAPI is an idRecordAPI that holds its records in memory, counting the writes made to it.
+type fakeIDRecordAPI struct {
+	records []idRecord
+	nextID  int
+	writes  int
+	// updateErr, if set, is returned by every update.
+	updateErr error
+}
+
+func (api *fakeIDRecordAPI) listIDRecords(zone, recordType, name string) ([]idRecord, error) {
+	records := []idRecord{}
+	for _, record := range api.records {
+		if record.Type == recordType && record.Name == name {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+func (api *fakeIDRecordAPI) createIDRecord(zone string, record idRecord) (idRecord, error) {
+	api.writes++
+	api.nextID++
+	record.ID = strconv.Itoa(100 + api.nextID)
+	api.records = append(api.records, record)
+
+	return record, nil
+}
+
+func (api *fakeIDRecordAPI) updateIDRecord(zone string, record idRecord) (idRecord, error) {
+	api.writes++
+	if api.updateErr != nil {
+		return idRecord{}, api.updateErr
+	}
+
+	for i, existingRecord := range api.records {
+		if existingRecord.ID == record.ID {
+			api.records[i] = record
+			return record, nil
+		}
+	}
+
+	return idRecord{}, errors.New("no such record")
+}
+
+func (api *fakeIDRecordAPI) deleteIDRecord(zone string, record idRecord) error {
+	api.writes++
+	for i, existingRecord := range api.records {
+		if existingRecord.ID == record.ID {
+			api.records = append(api.records[:i], api.records[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("no such record")
+}
+
+// testIDRecord makes an A record for home with the given ID, value, and TTL.
+func testIDRecord(id, value string, ttl int) idRecord {
+	return idRecord{ID: id, Type: "A", Name: "home", Value: value, TTL: ttl}
+}
+
+func TestSetIDRecord(t *testing.T) {
+	// The IDs sort differently as numbers than as strings, so that the first record is only chosen correctly if they
+	// are compared numerically.
+	stale := []idRecord{testIDRecord("10", "198.51.100.10", 300), testIDRecord("2", "198.51.100.2", 300)}
+	oneCurrent := []idRecord{testIDRecord("10", "203.0.113.1", 300), testIDRecord("2", "198.51.100.2", 300)}
+
+	tests := []struct {
+		name            string
+		existingRecords []idRecord
+		ttl             int
+		policy          DuplicateRecordPolicy
+		wantRecord      idRecord
+		wantRecords     []idRecord
+		wantWrites      int
+	}{
+		{
+			name:        "no records are created",
+			ttl:         300,
+			policy:      UpdateFirstDuplicate,
+			wantRecord:  testIDRecord("101", "203.0.113.1", 300),
+			wantRecords: []idRecord{testIDRecord("101", "203.0.113.1", 300)},
+			wantWrites:  1,
+		},
+		{
+			name:            "update first updates only the first stale record",
+			existingRecords: stale,
+			ttl:             300,
+			policy:          UpdateFirstDuplicate,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 300),
+			wantRecords: []idRecord{
+				testIDRecord("10", "198.51.100.10", 300),
+				testIDRecord("2", "203.0.113.1", 300),
+			},
+			wantWrites: 1,
+		},
+		{
+			name:            "update all updates every stale record",
+			existingRecords: stale,
+			ttl:             300,
+			policy:          UpdateAllDuplicates,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 300),
+			wantRecords:     []idRecord{testIDRecord("10", "203.0.113.1", 300), testIDRecord("2", "203.0.113.1", 300)},
+			wantWrites:      2,
+		},
+		{
+			name:            "update all leaves current records alone",
+			existingRecords: oneCurrent,
+			ttl:             300,
+			policy:          UpdateAllDuplicates,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 300),
+			wantRecords:     []idRecord{testIDRecord("10", "203.0.113.1", 300), testIDRecord("2", "203.0.113.1", 300)},
+			wantWrites:      1,
+		},
+		{
+			name:            "consolidate updates the first record and deletes the rest",
+			existingRecords: stale,
+			ttl:             300,
+			policy:          ConsolidateDuplicates,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 300),
+			wantRecords:     []idRecord{testIDRecord("2", "203.0.113.1", 300)},
+			wantWrites:      2,
+		},
+		{
+			name:            "consolidate keeps the record that is already current",
+			existingRecords: oneCurrent,
+			ttl:             300,
+			policy:          ConsolidateDuplicates,
+			wantRecord:      testIDRecord("10", "203.0.113.1", 300),
+			wantRecords:     []idRecord{testIDRecord("10", "203.0.113.1", 300)},
+			wantWrites:      1,
+		},
+		{
+			name:            "a current record is not written",
+			existingRecords: []idRecord{testIDRecord("2", "203.0.113.1", 300)},
+			ttl:             300,
+			policy:          UpdateFirstDuplicate,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 300),
+			wantRecords:     []idRecord{testIDRecord("2", "203.0.113.1", 300)},
+		},
+		{
+			name:            "a record with another TTL is updated",
+			existingRecords: []idRecord{testIDRecord("2", "203.0.113.1", 60)},
+			ttl:             300,
+			policy:          ConsolidateDuplicates,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 300),
+			wantRecords:     []idRecord{testIDRecord("2", "203.0.113.1", 300)},
+			wantWrites:      1,
+		},
+		{
+			name:            "a record's TTL is left alone if none is given",
+			existingRecords: []idRecord{testIDRecord("2", "203.0.113.1", 60)},
+			policy:          UpdateAllDuplicates,
+			wantRecord:      testIDRecord("2", "203.0.113.1", 60),
+			wantRecords:     []idRecord{testIDRecord("2", "203.0.113.1", 60)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeIDRecordAPI{records: append([]idRecord{}, test.existingRecords...)}
+			record, err := setIDRecord(api, "example.com", testIDRecord("", "203.0.113.1", test.ttl), test.policy)
+			if err != nil {
+				t.Fatalf("setIDRecord failed: %s", err)
+			}
+
+			sortIDRecords(api.records)
+			sortIDRecords(test.wantRecords)
+			if record != test.wantRecord {
+				t.Errorf("got record %+v, want %+v", record, test.wantRecord)
+			}
+
+			if !reflect.DeepEqual(api.records, test.wantRecords) {
+				t.Errorf("got records %+v, want %+v", api.records, test.wantRecords)
+			}
+
+			if api.writes != test.wantWrites {
+				t.Errorf("got %d writes, want %d", api.writes, test.wantWrites)
+			}
+		})
+	}
+}
+
+func TestSetIDRecordReturnsUpdateErrors(t *testing.T) {
+	updateErr := errors.New("update failed")
+	policies := []DuplicateRecordPolicy{UpdateFirstDuplicate, UpdateAllDuplicates, ConsolidateDuplicates}
+	for _, policy := range policies {
+		api := &fakeIDRecordAPI{
+			records:   []idRecord{testIDRecord("1", "198.51.100.1", 300), testIDRecord("2", "198.51.100.2", 300)},
+			updateErr: updateErr,
+		}
+
+		_, err := setIDRecord(api, "example.com", testIDRecord("", "203.0.113.1", 300), policy)
+		if !errors.Is(err, updateErr) {
+			t.Errorf("policy %d: got error %v, want %v", policy, err, updateErr)
+		}
+
+		if len(api.records) != 2 {
+			t.Errorf("policy %d: got %d records after a failed update, want 2", policy, len(api.records))
+		}
+	}
+}
@@ -1,12 +1,161 @@
 package pinamicdns
 
-import "net"
+import (
+	"context"
+	"net"
+	"strings"
+)
 
 // IPSetter associates the given ip with the given domain and subdomain name.
 // An example of such an association would be the setting of a DNS entry.
 type IPSetter interface {
 	// SetIP associates the given ip with the given domain and subdomain name.
-	// If a record already exists for the given subdomain name, only one record that does not have the same IP address will be updated.
+	// By default, if a record already exists for the given subdomain name, only one record that does not have the same IP address will be updated.
 	// If all records have the same IP address, no updating will be performed.
 	SetIP(domain, name string, ip net.IP) error
 }
+
+// ContextIPSetter is implemented by IPSetters that can give up on setting an IP partway through, such as when the
+// program is shutting down.
+type ContextIPSetter interface {
+	// SetIPContext associates the given ip with the given domain and subdomain name in the same manner as SetIP, giving
+	// up once the given context is done.
+	SetIPContext(ctx context.Context, domain, name string, ip net.IP) error
+}
+
+// SetIPContext associates the given ip with the given domain and subdomain name using the given setter. If the setter is
+// a ContextIPSetter, it gives up once the given context is done; otherwise, the context is only checked beforehand.
+func SetIPContext(ctx context.Context, setter IPSetter, domain, name string, ip net.IP) error {
+	if contextSetter, ok := setter.(ContextIPSetter); ok {
+		return contextSetter.SetIPContext(ctx, domain, name, ip)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return setter.SetIP(domain, name, ip)
+}
+
+// DomainLister lists the domains that an IPSetter is able to set records in, such as to confirm that its credentials
+// work before any domain is known.
+type DomainLister interface {
+	// Domains gets the name of each of the domains that records may be set in.
+	Domains() ([]string, error)
+}
+
+// RecordLister lists the DNS records that exist for a domain, such as to find out why a record was not matched.
+type RecordLister interface {
+	// Records gets all of the records in the given domain.
+	Records(domain string) ([]Record, error)
+}
+
+// IPRemover removes the records that associate IPs with a name, such as when a host is decommissioned.
+type IPRemover interface {
+	// RemoveIP removes all records that associate an IP with the given domain and subdomain name. It is not an error for
+	// there to be none.
+	RemoveIP(domain, name string) error
+}
+
+// IPSetSetter associates a set of IPs with a single name, such as to publish the addresses of several network links
+// at once.
+type IPSetSetter interface {
+	// SetIPSet associates exactly the given ips with the given domain and subdomain name. Records for the name holding
+	// addresses that are not given are removed, and records are added for those that are missing.
+	SetIPSet(domain, name string, ips []net.IP) error
+}
+
+// Record is a DNS record of any type, which may be set by a RecordSetter.
+type Record struct {
+	// Type is the type of the record, such as A, TXT, CNAME, or MX.
+	Type string
+	// Name is the subdomain name of the record.
+	Name string
+	// Value is the data of the record, such as an address, a hostname, or text.
+	Value string
+	// TTL is the TTL of the record. If zero, the setter chooses one.
+	TTL int
+	// Priority is the priority of the record, for those types that have one, such as MX.
+	Priority int
+}
+
+// RecordSetter sets DNS records of arbitrary types, rather than just those that hold IP addresses.
+type RecordSetter interface {
+	// SetRecord sets the given record in the given domain. Existing records with the same type and name are treated in
+	// the same way as by IPSetter.SetIP.
+	SetRecord(domain string, record Record) error
+}
+
+// RecordAdder adds DNS records alongside any others that already exist with the same type and name, such as to publish
+// several values for a TXT record at once.
+type RecordAdder interface {
+	// AddRecord adds the given record to the given domain. If a record with the same type, name, and data already
+	// exists, nothing is added.
+	AddRecord(domain string, record Record) error
+}
+
+// RecordRemover removes DNS records.
+type RecordRemover interface {
+	// RemoveRecord removes the records in the given domain with the type and name of the given record. If the record
+	// has a value, only the records with the same data are removed. It is not an error for no records to match.
+	RemoveRecord(domain string, record Record) error
+}
+
+// AccessChecker is implemented by IPSetters that can cheaply confirm that they are able to set records for a domain,
+// so that credential problems can be reported clearly before any records are written.
+type AccessChecker interface {
+	// CheckAccess returns an error describing why records for the given domain could not be set, if they cannot be.
+	CheckAccess(domain string) error
+}
+
+// DuplicateRecordPolicy describes what an IPSetter should do when several records already exist for the same name.
+type DuplicateRecordPolicy int
+
+// Possible values for DuplicateRecordPolicy
+const (
+	// UpdateFirstDuplicate updates a single record that does not have the same IP address, leaving all others alone.
+	UpdateFirstDuplicate DuplicateRecordPolicy = iota
+	// UpdateAllDuplicates updates every record that does not have the same IP address.
+	UpdateAllDuplicates
+	// ConsolidateDuplicates ensures only a single record with the IP address remains, deleting all others.
+	ConsolidateDuplicates
+)
+
+// ipRecordType gets the type of record that holds the given IP address: A for an IPv4 address, or AAAA for an IPv6
+// address.
+func ipRecordType(ip net.IP) string {
+	if ip.To4() == nil {
+		return AAAARecordType
+	}
+
+	return ARecordType
+}
+
+// ApexName is the subdomain name that refers to the apex of a domain, rather than a subdomain of it.
+const ApexName = "@"
+
+// fqdn gets the fully qualified name of the record with the given subdomain name in the given domain.
+func fqdn(domain, name string) string {
+	if isApexName(domain, name) {
+		return domain
+	}
+
+	return name + "." + domain
+}
+
+// providerRecordName gets the name that a provider knows the record with the given subdomain name in the given domain
+// by, which is the given apexName if the record is at the apex of the domain, however it was given.
+func providerRecordName(domain, name, apexName string) string {
+	if isApexName(domain, name) {
+		return apexName
+	}
+
+	return name
+}
+
+// isApexName checks whether or not the given subdomain name refers to the apex of the given domain. The apex may be
+// given as an empty name, "@", or the domain itself.
+func isApexName(domain, name string) bool {
+	return name == "" || name == ApexName || strings.EqualFold(strings.TrimSuffix(name, "."), domain)
+}
@@ -0,0 +1,457 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// maxIPResponseSize is the most of a response to an IP check that will be read. An IP address is far shorter, so
+// anything longer can't be one.
+const maxIPResponseSize = 1024
+
+// maxJSONIPResponseSize is the most of a JSON response to an IP check that will be read. Some services include much
+// more than the address in these, such as the location of the address.
+const maxJSONIPResponseSize = 64 * 1024
+
+// privateIPRanges are the ranges of addresses reserved for private networks, which can't be reached from the Internet.
+var privateIPRanges = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0), Mask: net.CIDRMask(16, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+	{IP: net.IP{0xfc, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(7, 128)},
+}
+
+// IPSource finds the current public IP address of the machine, so that it can be set with an IPSetter.
+type IPSource interface {
+	// IP gets the current public IP address.
+	IP() (net.IP, error)
+}
+
+// ContextIPSource is implemented by IPSources that can give up on finding the current IP address partway through,
+// such as when the program is shutting down.
+type ContextIPSource interface {
+	// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+	IPContext(ctx context.Context) (net.IP, error)
+}
+
+// IPContext gets the current public IP address from the given source. If the source is a ContextIPSource, it gives up
+// once the given context is done; otherwise, the context is only checked beforehand.
+func IPContext(ctx context.Context, source IPSource) (net.IP, error) {
+	if contextSource, ok := source.(ContextIPSource); ok {
+		return contextSource.IPContext(ctx)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return source.IP()
+}
+
+// HTTPIPSource is an IPSource that asks a web service for the address that its requests come from, such as
+// https://checkip.amazonaws.com/. The service must respond with just the address, unless a JSON field to read it from
+// is given.
+type HTTPIPSource struct {
+	url        string
+	httpConfig HTTPConfig
+	jsonField  []string
+}
+
+// FallbackIPSource is an IPSource that asks several other IPSources for the current IP address in turn, until one of
+// them succeeds. This prevents any one of them from being a single point of failure.
+type FallbackIPSource struct {
+	sources []IPSource
+}
+
+// HTTPIPSourceHTTPConfig should be passed to NewHTTPIPSource to control how the HTTP client that asks for the address
+// is constructed, such as its timeouts and proxy.
+func HTTPIPSourceHTTPConfig(config HTTPConfig) func(*HTTPIPSource) error {
+	return func(source *HTTPIPSource) error {
+		source.httpConfig = config
+		return nil
+	}
+}
+
+// HTTPIPSourceJSONField should be passed to NewHTTPIPSource if the service responds with a JSON object, rather than
+// just the address. The address is read from the given field of the object, such as "ip". Fields of nested objects
+// may be given by separating their names with dots, such as "client.ip".
+func HTTPIPSourceJSONField(field string) func(*HTTPIPSource) error {
+	return func(source *HTTPIPSource) error {
+		if field == "" {
+			return xerrors.New("JSON field must not be empty")
+		}
+
+		source.jsonField = strings.Split(field, ".")
+		return nil
+	}
+}
+
+// NewHTTPIPSource makes a new HTTPIPSource, which will ask the service at the given URL for the current IP address.
+func NewHTTPIPSource(rawURL string, options ...func(*HTTPIPSource) error) (HTTPIPSource, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return HTTPIPSource{}, xerrors.Errorf("could not construct HTTPIPSource: invalid URL: %w", err)
+	} else if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return HTTPIPSource{}, xerrors.New("could not construct HTTPIPSource: URL must be http or https")
+	}
+
+	source := HTTPIPSource{url: rawURL}
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return HTTPIPSource{}, xerrors.Errorf("could not construct HTTPIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the current public IP address from the source's service.
+func (source HTTPIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source HTTPIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	req, err := http.NewRequest(http.MethodGet, source.url, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("could not make request for %s: %w", source.url, err)
+	}
+
+	res, err := source.httpConfig.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, xerrors.Errorf("could not check IP with %s: %w", source.url, err)
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, xerrors.Errorf(
+			"could not check IP with %s: %w",
+			source.url,
+			httpStatusError{statusCode: res.StatusCode, header: res.Header},
+		)
+	}
+
+	var rawIP string
+	if source.jsonField == nil {
+		resData, err := ioutil.ReadAll(io.LimitReader(res.Body, maxIPResponseSize))
+		if err != nil {
+			return nil, xerrors.Errorf("could not read IP from %s: %w", source.url, err)
+		}
+
+		rawIP = string(resData)
+	} else {
+		rawIP, err = source.readJSONField(io.LimitReader(res.Body, maxJSONIPResponseSize))
+		if err != nil {
+			return nil, xerrors.Errorf("could not read IP from %s: %w", source.url, err)
+		}
+	}
+
+	rawIP = strings.TrimSpace(rawIP)
+	ip := net.ParseIP(rawIP)
+	if ip == nil {
+		return nil, xerrors.Errorf("%s returned something that is not an IP address: %q", source.url, rawIP)
+	}
+
+	return ip, nil
+}
+
+// readJSONField reads the value of the source's JSON field from the JSON object in the given reader.
+func (source HTTPIPSource) readJSONField(reader io.Reader) (string, error) {
+	var value interface{}
+	err := json.NewDecoder(reader).Decode(&value)
+	if err != nil {
+		return "", xerrors.Errorf("invalid JSON response: %w", err)
+	}
+
+	for _, fieldName := range source.jsonField {
+		object, ok := value.(map[string]interface{})
+		if ok {
+			value, ok = object[fieldName]
+		}
+
+		if !ok {
+			return "", xerrors.Errorf("response has no field %q", strings.Join(source.jsonField, "."))
+		}
+	}
+
+	rawIP, ok := value.(string)
+	if !ok {
+		return "", xerrors.Errorf("field %q of response is not a string", strings.Join(source.jsonField, "."))
+	}
+
+	return rawIP, nil
+}
+
+// NewFallbackIPSource makes a new FallbackIPSource, which will ask the given sources for the current IP address in the
+// order they are given.
+func NewFallbackIPSource(sources ...IPSource) FallbackIPSource {
+	return FallbackIPSource{sources: sources}
+}
+
+// IP gets the current public IP address from the first of the source's IPSources that succeeds. If none of them do, the
+// returned error describes why each of them failed.
+func (source FallbackIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source FallbackIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	if len(source.sources) == 0 {
+		return nil, xerrors.New("no IP sources to check with")
+	}
+
+	descriptions := make([]string, 0, len(source.sources))
+	for _, ipSource := range source.sources {
+		ip, err := IPContext(ctx, ipSource)
+		if err == nil {
+			return ip, nil
+		} else if ctx.Err() != nil {
+			// None of the others will have any more luck.
+			return nil, err
+		}
+
+		descriptions = append(descriptions, err.Error())
+	}
+
+	return nil, xerrors.Errorf("all IP sources failed: %s", strings.Join(descriptions, "; "))
+}
+
+// ConsensusIPSource is an IPSource that asks several other IPSources for the current IP address at once, and only
+// trusts an address that enough of them agree upon. This guards against a misbehaving or compromised source pointing
+// records at the wrong address.
+type ConsensusIPSource struct {
+	sources []IPSource
+	quorum  int
+}
+
+// ipSourceResult is the result of asking a single IPSource for the current IP address.
+type ipSourceResult struct {
+	ip  net.IP
+	err error
+}
+
+// ConsensusQuorum should be passed to NewConsensusIPSource to control how many of its sources must agree upon an
+// address. If not given, a majority of them must.
+func ConsensusQuorum(quorum int) func(*ConsensusIPSource) error {
+	return func(source *ConsensusIPSource) error {
+		if quorum < 1 || quorum > len(source.sources) {
+			return xerrors.Errorf("quorum must be between 1 and the number of sources, %d", len(source.sources))
+		}
+
+		source.quorum = quorum
+		return nil
+	}
+}
+
+// NewConsensusIPSource makes a new ConsensusIPSource, which will ask all of the given sources for the current IP
+// address.
+func NewConsensusIPSource(sources []IPSource, options ...func(*ConsensusIPSource) error) (ConsensusIPSource, error) {
+	if len(sources) == 0 {
+		return ConsensusIPSource{}, xerrors.New("could not construct ConsensusIPSource: no sources given")
+	}
+
+	source := ConsensusIPSource{
+		sources: sources,
+		quorum:  len(sources)/2 + 1,
+	}
+
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return ConsensusIPSource{}, xerrors.Errorf("could not construct ConsensusIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the current public IP address that at least the quorum of the source's IPSources agree upon. They are all
+// asked at once, so the sources must be safe for concurrent use. If no address is agreed upon, the returned error
+// describes what each source returned.
+func (source ConsensusIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source ConsensusIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	results := make([]ipSourceResult, len(source.sources))
+	wg := sync.WaitGroup{}
+	for i, ipSource := range source.sources {
+		wg.Add(1)
+		go func(i int, ipSource IPSource) {
+			defer wg.Done()
+			ip, err := IPContext(ctx, ipSource)
+			results[i] = ipSourceResult{ip: ip, err: err}
+		}(i, ipSource)
+	}
+
+	wg.Wait()
+
+	votes := map[string]int{}
+	descriptions := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.err != nil {
+			descriptions = append(descriptions, result.err.Error())
+			continue
+		}
+
+		votes[result.ip.String()]++
+		if votes[result.ip.String()] >= source.quorum {
+			return result.ip, nil
+		}
+
+		descriptions = append(descriptions, result.ip.String())
+	}
+
+	return nil, xerrors.Errorf(
+		"fewer than %d IP sources agreed upon an address: %s",
+		source.quorum,
+		strings.Join(descriptions, "; "),
+	)
+}
+
+// InterfaceIPSource is an IPSource that reads the current IP address from a network interface of the machine, for
+// machines that have a public address directly on an interface, such as with PPPoE. No other services are contacted.
+type InterfaceIPSource struct {
+	interfaceName string
+	ipv6          bool
+}
+
+// InterfaceIPv6 should be passed to NewInterfaceIPSource to read an IPv6 address from the interface, rather than an
+// IPv4 address.
+func InterfaceIPv6() func(*InterfaceIPSource) error {
+	return func(source *InterfaceIPSource) error {
+		source.ipv6 = true
+		return nil
+	}
+}
+
+// NewInterfaceIPSource makes a new InterfaceIPSource, which will read the current IP address from the interface with
+// the given name, such as eth0.
+func NewInterfaceIPSource(interfaceName string, options ...func(*InterfaceIPSource) error) (InterfaceIPSource, error) {
+	if interfaceName == "" {
+		return InterfaceIPSource{}, xerrors.New("could not construct InterfaceIPSource: no interface name given")
+	}
+
+	source := InterfaceIPSource{interfaceName: interfaceName}
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return InterfaceIPSource{}, xerrors.Errorf("could not construct InterfaceIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the current IP address of the source's interface. Only globally routable addresses are considered, and
+// if the interface has several, one outside of the private ranges is preferred.
+func (source InterfaceIPSource) IP() (net.IP, error) {
+	netInterface, err := net.InterfaceByName(source.interfaceName)
+	if err != nil {
+		return nil, xerrors.Errorf("could not find interface %s: %w", source.interfaceName, err)
+	}
+
+	addrs, err := netInterface.Addrs()
+	if err != nil {
+		return nil, xerrors.Errorf("could not get addresses of interface %s: %w", source.interfaceName, err)
+	}
+
+	var privateIP net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() || (ipNet.IP.To4() == nil) != source.ipv6 {
+			continue
+		}
+
+		if !isPrivateIP(ipNet.IP) {
+			return ipNet.IP, nil
+		} else if privateIP == nil {
+			privateIP = ipNet.IP
+		}
+	}
+
+	if privateIP == nil {
+		return nil, xerrors.Errorf("interface %s has no usable address", source.interfaceName)
+	}
+
+	return privateIP, nil
+}
+
+// isPrivateIP checks whether or not the given IP is within one of the ranges reserved for private networks.
+func isPrivateIP(ip net.IP) bool {
+	for _, privateRange := range privateIPRanges {
+		if privateRange.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StaticIPSource is an IPSource that always gives the same address, so that a known address can be published without
+// detecting it.
+type StaticIPSource struct {
+	ip net.IP
+}
+
+// NewStaticIPSource makes a new StaticIPSource, which will always give the given IP.
+func NewStaticIPSource(ip net.IP) StaticIPSource {
+	return StaticIPSource{ip: ip}
+}
+
+// IP gets the source's IP.
+func (source StaticIPSource) IP() (net.IP, error) {
+	if source.ip == nil {
+		return nil, xerrors.New("no static IP given")
+	}
+
+	return source.ip, nil
+}
+
+// RetryingIPSource is an IPSource that asks another IPSource for the current IP address again when it fails for a
+// transient reason, such as a timeout or a server error, in correspondence with a RetryPolicy.
+type RetryingIPSource struct {
+	source      IPSource
+	retryPolicy RetryPolicy
+}
+
+// NewRetryingIPSource makes a new RetryingIPSource, which will retry the given source with the given policy.
+func NewRetryingIPSource(source IPSource, retryPolicy RetryPolicy) RetryingIPSource {
+	return RetryingIPSource{source: source, retryPolicy: retryPolicy}
+}
+
+// IP gets the current public IP address from the source's IPSource, retrying it if need be. If every attempt fails,
+// the error from the last is returned.
+func (source RetryingIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source RetryingIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	var ip net.IP
+	err := source.retryPolicy.run(ctx, func() error {
+		var err error
+		ip, err = IPContext(ctx, source.source)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ip, nil
+}
@@ -0,0 +1,102 @@
+package pinamicdns
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// fakeIPSource is an IPSource that always gives the same address, or fails if it has none.
+type fakeIPSource struct {
+	ip net.IP
+}
+
+func (source fakeIPSource) IP() (net.IP, error) {
+	if source.ip == nil {
+		return nil, errors.New("source failed")
+	}
+
+	return source.ip, nil
+}
+
+func TestConsensusIPSource(t *testing.T) {
+	agreed := fakeIPSource{ip: net.ParseIP("203.0.113.1")}
+	other := fakeIPSource{ip: net.ParseIP("198.51.100.1")}
+	failed := fakeIPSource{}
+
+	tests := []struct {
+		name    string
+		sources []IPSource
+		// quorum is the quorum to give the source, or zero for the default.
+		quorum int
+		wantIP net.IP
+	}{
+		{
+			name:    "a single source is trusted",
+			sources: []IPSource{agreed},
+			wantIP:  agreed.ip,
+		},
+		{
+			name:    "a majority agrees by default",
+			sources: []IPSource{agreed, other, agreed},
+			wantIP:  agreed.ip,
+		},
+		{
+			name:    "half is not a majority",
+			sources: []IPSource{agreed, other, agreed, other},
+		},
+		{
+			name:    "failed sources count against the majority",
+			sources: []IPSource{agreed, failed, failed},
+		},
+		{
+			name:    "a lower quorum is enough",
+			sources: []IPSource{failed, other, agreed},
+			quorum:  1,
+			wantIP:  other.ip,
+		},
+		{
+			name:    "a quorum of every source needs every source",
+			sources: []IPSource{agreed, agreed, other},
+			quorum:  3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := []func(*ConsensusIPSource) error{}
+			if test.quorum != 0 {
+				options = append(options, ConsensusQuorum(test.quorum))
+			}
+
+			source, err := NewConsensusIPSource(test.sources, options...)
+			if err != nil {
+				t.Fatalf("NewConsensusIPSource failed: %s", err)
+			}
+
+			ip, err := source.IP()
+			if test.wantIP == nil && err == nil {
+				t.Errorf("got %s, want an error", ip)
+			} else if test.wantIP != nil && (err != nil || !ip.Equal(test.wantIP)) {
+				t.Errorf("got (%s, %v), want %s", ip, err, test.wantIP)
+			}
+		})
+	}
+}
+
+func TestConsensusQuorumLimits(t *testing.T) {
+	sources := []IPSource{fakeIPSource{}, fakeIPSource{}}
+	for _, quorum := range []int{-1, 0, 3} {
+		_, err := NewConsensusIPSource(sources, ConsensusQuorum(quorum))
+		if err == nil {
+			t.Errorf("quorum %d of %d sources was accepted", quorum, len(sources))
+		}
+	}
+
+	for _, quorum := range []int{1, 2} {
+		_, err := NewConsensusIPSource(sources, ConsensusQuorum(quorum))
+		if err != nil {
+			t.Errorf("quorum %d of %d sources was rejected: %s", quorum, len(sources), err)
+		}
+	}
+}
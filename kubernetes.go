@@ -0,0 +1,307 @@
+package pinamicdns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultKubernetesServiceAccountDir is the directory that a pod's service account credentials are mounted in, unless
+// another is given.
+const DefaultKubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// DefaultKubernetesNodeAddressType is the type of a node's address that a KubernetesIPSource reads, unless another is
+// given.
+const DefaultKubernetesNodeAddressType = "ExternalIP"
+
+// maxKubernetesResponseSize is the most of a response from the Kubernetes API that will be read. Nodes list every image
+// they hold in their status, so they can be far larger than other responses to IP checks.
+const maxKubernetesResponseSize = 4 * 1024 * 1024
+
+// KubernetesIPSource is an IPSource that reads an address from the Kubernetes API, using the credentials of the pod
+// that it runs in: either one of a node's addresses, or the address of a LoadBalancer Service. Run as a DaemonSet, this
+// keeps a name for each node pointing at it.
+type KubernetesIPSource struct {
+	// node is the name of the node whose address is read, if not reading a Service's.
+	node string
+	// namespace and service name the Service whose address is read, if not reading a node's. An empty namespace is
+	// the pod's own.
+	namespace      string
+	service        string
+	addressType    string
+	apiURL         string
+	serviceAccount string
+	ipv6           bool
+	httpConfig     HTTPConfig
+}
+
+// kubernetesNode is the part of a node that KubernetesIPSource reads.
+type kubernetesNode struct {
+	Status struct {
+		Addresses []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+		} `json:"addresses"`
+	} `json:"status"`
+}
+
+// kubernetesService is the part of a Service that KubernetesIPSource reads.
+type kubernetesService struct {
+	Status struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP string `json:"ip"`
+			} `json:"ingress"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+// KubernetesIPv6 should be passed to NewKubernetesNodeIPSource or NewKubernetesServiceIPSource to read an IPv6
+// address, rather than an IPv4 address.
+func KubernetesIPv6() func(*KubernetesIPSource) error {
+	return func(source *KubernetesIPSource) error {
+		source.ipv6 = true
+		return nil
+	}
+}
+
+// KubernetesNodeAddressType should be passed to NewKubernetesNodeIPSource to read another type of the node's address,
+// such as InternalIP. If not given, DefaultKubernetesNodeAddressType is used.
+func KubernetesNodeAddressType(addressType string) func(*KubernetesIPSource) error {
+	return func(source *KubernetesIPSource) error {
+		if source.node == "" {
+			return xerrors.New("address types may only be given for nodes")
+		} else if addressType == "" {
+			return xerrors.New("address type must not be empty")
+		}
+
+		source.addressType = addressType
+		return nil
+	}
+}
+
+// KubernetesAPIURL should be passed to NewKubernetesNodeIPSource or NewKubernetesServiceIPSource if the Kubernetes API
+// should be reached at a URL other than the one given to the pod by the KUBERNETES_SERVICE_HOST and
+// KUBERNETES_SERVICE_PORT environment variables.
+func KubernetesAPIURL(apiURL string) func(*KubernetesIPSource) error {
+	return func(source *KubernetesIPSource) error {
+		if apiURL == "" {
+			return xerrors.New("API URL must not be empty")
+		}
+
+		_, err := url.Parse(apiURL)
+		if err != nil {
+			return xerrors.Errorf("invalid API URL: %w", err)
+		}
+
+		source.apiURL = strings.TrimSuffix(apiURL, "/")
+		return nil
+	}
+}
+
+// KubernetesServiceAccountDir should be passed to NewKubernetesNodeIPSource or NewKubernetesServiceIPSource if the
+// pod's service account credentials are mounted somewhere other than DefaultKubernetesServiceAccountDir.
+func KubernetesServiceAccountDir(dir string) func(*KubernetesIPSource) error {
+	return func(source *KubernetesIPSource) error {
+		if dir == "" {
+			return xerrors.New("service account directory must not be empty")
+		}
+
+		source.serviceAccount = dir
+		return nil
+	}
+}
+
+// KubernetesHTTPConfig should be passed to NewKubernetesNodeIPSource or NewKubernetesServiceIPSource to control how
+// the HTTP client that reads from the Kubernetes API is constructed. The API is always reached directly, so any proxy
+// that is configured is ignored.
+func KubernetesHTTPConfig(config HTTPConfig) func(*KubernetesIPSource) error {
+	return func(source *KubernetesIPSource) error {
+		source.httpConfig = config
+		return nil
+	}
+}
+
+// NewKubernetesNodeIPSource makes a new KubernetesIPSource, which will read the address of the node with the given
+// name. The pod's service account must be allowed to get nodes.
+func NewKubernetesNodeIPSource(node string, options ...func(*KubernetesIPSource) error) (KubernetesIPSource, error) {
+	if node == "" {
+		return KubernetesIPSource{}, xerrors.New("could not construct KubernetesIPSource: node must not be empty")
+	}
+
+	return newKubernetesIPSource(KubernetesIPSource{node: node, addressType: DefaultKubernetesNodeAddressType}, options)
+}
+
+// NewKubernetesServiceIPSource makes a new KubernetesIPSource, which will read the address of the LoadBalancer Service
+// with the given name, in the given namespace, or in the pod's own if the namespace is empty. The pod's service account
+// must be allowed to get services.
+func NewKubernetesServiceIPSource(namespace, service string, options ...func(*KubernetesIPSource) error) (KubernetesIPSource, error) {
+	if service == "" {
+		return KubernetesIPSource{}, xerrors.New("could not construct KubernetesIPSource: service must not be empty")
+	}
+
+	return newKubernetesIPSource(KubernetesIPSource{namespace: namespace, service: service}, options)
+}
+
+// newKubernetesIPSource applies the given options to the given source, which has been told what to read the address
+// of, and finds the Kubernetes API if none of them gave its URL.
+func newKubernetesIPSource(source KubernetesIPSource, options []func(*KubernetesIPSource) error) (KubernetesIPSource, error) {
+	source.serviceAccount = DefaultKubernetesServiceAccountDir
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return KubernetesIPSource{}, xerrors.Errorf("could not construct KubernetesIPSource: %w", err)
+		}
+	}
+
+	if source.apiURL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return KubernetesIPSource{}, xerrors.New(
+				"could not construct KubernetesIPSource: not running in a Kubernetes pod, as KUBERNETES_SERVICE_HOST " +
+					"and KUBERNETES_SERVICE_PORT are not set",
+			)
+		}
+
+		source.apiURL = "https://" + net.JoinHostPort(host, port)
+	}
+
+	return source, nil
+}
+
+// IP gets the current address of the node or Service from the Kubernetes API.
+func (source KubernetesIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source KubernetesIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	if source.node != "" {
+		node := kubernetesNode{}
+		err := source.get(ctx, "/api/v1/nodes/"+url.PathEscape(source.node), &node)
+		if err != nil {
+			return nil, xerrors.Errorf("could not get node %s: %w", source.node, err)
+		}
+
+		for _, address := range node.Status.Addresses {
+			ip := net.ParseIP(address.Address)
+			if address.Type == source.addressType && ip != nil && (ip.To4() == nil) == source.ipv6 {
+				return ip, nil
+			}
+		}
+
+		return nil, xerrors.Errorf("node %s has no %s address of the right family", source.node, source.addressType)
+	}
+
+	namespace, err := source.serviceNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	service := kubernetesService{}
+	path := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/services/" + url.PathEscape(source.service)
+	err = source.get(ctx, path, &service)
+	if err != nil {
+		return nil, xerrors.Errorf("could not get service %s/%s: %w", namespace, source.service, err)
+	}
+
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		ip := net.ParseIP(ingress.IP)
+		if ip != nil && (ip.To4() == nil) == source.ipv6 {
+			return ip, nil
+		}
+	}
+
+	return nil, xerrors.Errorf(
+		"service %s/%s has no load balancer address of the right family; only addresses, not host names, can be used",
+		namespace,
+		source.service,
+	)
+}
+
+// serviceNamespace gets the namespace of the Service whose address is read, which is the pod's own if none was given.
+func (source KubernetesIPSource) serviceNamespace() (string, error) {
+	if source.namespace != "" {
+		return source.namespace, nil
+	}
+
+	namespace, err := ioutil.ReadFile(filepath.Join(source.serviceAccount, "namespace"))
+	if err != nil {
+		return "", xerrors.Errorf("could not read pod's namespace: %w", err)
+	}
+
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// get decodes the object at the given path of the Kubernetes API into the given value, authenticating as the pod's
+// service account. The token is read again for each request, as Kubernetes rotates it.
+func (source KubernetesIPSource) get(ctx context.Context, path string, value interface{}) error {
+	token, err := ioutil.ReadFile(filepath.Join(source.serviceAccount, "token"))
+	if err != nil {
+		return xerrors.Errorf("could not read service account token: %w", err)
+	}
+
+	client := source.httpConfig.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.Proxy = nil
+	if strings.HasPrefix(source.apiURL, "https:") {
+		rootCAs, err := source.rootCAs()
+		if err != nil {
+			return err
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, source.apiURL+path, nil)
+	if err != nil {
+		return xerrors.Errorf("could not make request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return xerrors.Errorf("Kubernetes API returned status %s", res.Status)
+	}
+
+	err = json.NewDecoder(io.LimitReader(res.Body, maxKubernetesResponseSize)).Decode(value)
+	if err != nil {
+		return xerrors.Errorf("could not decode response: %w", err)
+	}
+
+	return nil
+}
+
+// rootCAs gets the certificates that the Kubernetes API's certificate must be signed by, which are mounted alongside
+// the service account's token.
+func (source KubernetesIPSource) rootCAs() (*x509.CertPool, error) {
+	caPath := filepath.Join(source.serviceAccount, "ca.crt")
+	ca, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		return nil, xerrors.Errorf("could not read cluster CA: %w", err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(ca) {
+		return nil, xerrors.Errorf("%s holds no certificates", caPath)
+	}
+
+	return rootCAs, nil
+}
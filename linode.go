@@ -0,0 +1,332 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+const linodeAPIBaseURL = "https://api.linode.com/v4"
+
+// linodePageSize is the number of results requested per page from the Linode API. This is the largest it allows.
+const linodePageSize = 500
+
+// linodeApexName is the name that Linode gives the records at the apex of a domain.
+const linodeApexName = ""
+
+func init() {
+	Register("linode", newLinodeIPSetterFromConfig)
+}
+
+// LinodeIPSetter is an IPSetter that will update records in Linode's DNS Manager
+type LinodeIPSetter struct {
+	apiToken        string
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+	duplicatePolicy DuplicateRecordPolicy
+}
+
+// linodeTransaction holds all elements necessary to talk to the Linode API, in the context of a single
+// LinodeIPSetter.SetIP call.
+type linodeTransaction struct {
+	client restClient
+}
+
+// linodeDomain is a domain, as represented by the Linode API.
+type linodeDomain struct {
+	ID     int    `json:"id"`
+	Domain string `json:"domain"`
+}
+
+// linodeRecord is a DNS record, as represented by the Linode API.
+type linodeRecord struct {
+	ID     int    `json:"id,omitempty"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTL    int    `json:"ttl_sec"`
+}
+
+// linodePage holds the pagination information of a Linode API listing.
+type linodePage struct {
+	Page  int `json:"page"`
+	Pages int `json:"pages"`
+}
+
+// LinodeRecordTTL should be passed to NewLinodeIPSetter if a TTL is desired for the records it sets. Linode will
+// round the TTL to the nearest value that it supports.
+func LinodeRecordTTL(ttl int) func(*LinodeIPSetter) error {
+	return func(setter *LinodeIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// LinodeHTTPConfig should be passed to NewLinodeIPSetter to control how the HTTP client that talks to the Linode API
+// is constructed, such as its timeouts.
+func LinodeHTTPConfig(config HTTPConfig) func(*LinodeIPSetter) error {
+	return func(setter *LinodeIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// LinodeRetryPolicy should be passed to NewLinodeIPSetter to control how calls to the Linode API are retried when they
+// fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func LinodeRetryPolicy(policy RetryPolicy) func(*LinodeIPSetter) error {
+	return func(setter *LinodeIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// LinodeDuplicateRecordPolicy should be passed to NewLinodeIPSetter to control what is done when several records
+// exist for the same name. If not given, UpdateFirstDuplicate is used.
+func LinodeDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*LinodeIPSetter) error {
+	return func(setter *LinodeIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// NewLinodeIPSetter makes a new Linode IPSetter, which authenticates with the given personal access token. The token
+// must have read/write access to Domains.
+func NewLinodeIPSetter(apiToken string, options ...func(*LinodeIPSetter) error) (LinodeIPSetter, error) {
+	setter := LinodeIPSetter{
+		apiToken:    apiToken,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return LinodeIPSetter{}, xerrors.Errorf("could not construct LinodeIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeTransaction will make a new Linode API transaction for the given setter.
+func (setter LinodeIPSetter) makeTransaction(ctx context.Context) linodeTransaction {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+setter.apiToken)
+
+	return linodeTransaction{
+		client: newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, linodeAPIBaseURL, header),
+	}
+}
+
+// getDomainID gets the ID Linode has assigned to the given domain.
+func (transaction linodeTransaction) getDomainID(domain string) (string, error) {
+	for page := 1; ; page++ {
+		var response struct {
+			linodePage
+			Data []linodeDomain `json:"data"`
+		}
+
+		err := transaction.client.do(http.MethodGet, linodePagePath("/domains", page), nil, &response)
+		if err != nil {
+			return "", xerrors.Errorf("could not ask Linode API for domains: %w", err)
+		}
+
+		for _, linodeDomain := range response.Data {
+			if linodeDomain.Domain == domain {
+				return strconv.Itoa(linodeDomain.ID), nil
+			}
+		}
+
+		if response.Page >= response.Pages {
+			return "", xerrors.Errorf("domain %s does not exist in the Linode account", domain)
+		}
+	}
+}
+
+// listIDRecords gets all of the records with the given type and name for the domain with the given ID.
+func (transaction linodeTransaction) listIDRecords(domainID, recordType, name string) ([]idRecord, error) {
+	records := []idRecord{}
+	for page := 1; ; page++ {
+		var response struct {
+			linodePage
+			Data []linodeRecord `json:"data"`
+		}
+
+		err := transaction.client.do(http.MethodGet, linodePagePath("/domains/"+domainID+"/records", page), nil, &response)
+		if err != nil {
+			return nil, xerrors.Errorf("could not ask Linode API for records: %w", err)
+		}
+
+		for _, record := range response.Data {
+			if record.Type == recordType && record.Name == name {
+				records = append(records, record.idRecord())
+			}
+		}
+
+		if response.Page >= response.Pages {
+			return records, nil
+		}
+	}
+}
+
+// createIDRecord creates the given record for the domain with the given ID.
+func (transaction linodeTransaction) createIDRecord(domainID string, record idRecord) (idRecord, error) {
+	createdRecord := linodeRecord{}
+	err := transaction.client.create("/domains/"+domainID+"/records", makeLinodeRecord(record), &createdRecord)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not create record for domain: %w", err)
+	}
+
+	return createdRecord.idRecord(), nil
+}
+
+// updateIDRecord updates the target and TTL of the record with the ID of the given record, for the domain with the
+// given ID.
+func (transaction linodeTransaction) updateIDRecord(domainID string, record idRecord) (idRecord, error) {
+	update := struct {
+		Target string `json:"target"`
+		TTL    int    `json:"ttl_sec"`
+	}{
+		Target: record.Value,
+		TTL:    record.TTL,
+	}
+
+	updatedRecord := linodeRecord{}
+	err := transaction.client.do(http.MethodPut, "/domains/"+domainID+"/records/"+record.ID, update, &updatedRecord)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not update record for domain: %w", err)
+	}
+
+	return updatedRecord.idRecord(), nil
+}
+
+// deleteIDRecord deletes the record with the ID of the given record, for the domain with the given ID.
+func (transaction linodeTransaction) deleteIDRecord(domainID string, record idRecord) error {
+	err := transaction.client.do(http.MethodDelete, "/domains/"+domainID+"/records/"+record.ID, nil, nil)
+	if err != nil {
+		return xerrors.Errorf("could not delete record for domain: %w", err)
+	}
+
+	return nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with Linode.
+func (setter LinodeIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter LinodeIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	transaction := setter.makeTransaction(ctx)
+	domainID, err := transaction.getDomainID(domain)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	record := setter.ipRecord(domain, name, ip)
+	_, err = setIDRecord(transaction, domainID, record, setter.duplicatePolicy)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// PlanIP gets the changes that SetIP would make to Linode's records, without making them.
+func (setter LinodeIPSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	transaction := setter.makeTransaction(context.Background())
+	domainID, err := transaction.getDomainID(domain)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	target := Target{Domain: domain, Name: name}
+	changes, err := planIDRecord(transaction, domainID, target, setter.ipRecord(domain, name, ip), setter.duplicatePolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	return changes, nil
+}
+
+// ipRecord makes the record that associates the given ip with the given domain and subdomain name.
+func (setter LinodeIPSetter) ipRecord(domain, name string, ip net.IP) idRecord {
+	return idRecord{
+		Type:  ipRecordType(ip),
+		Name:  providerRecordName(domain, name, linodeApexName),
+		Value: ip.String(),
+		TTL:   setter.recordTTL,
+	}
+}
+
+// CheckAccess confirms that the setter's token is able to access the given domain.
+func (setter LinodeIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	_, err := transaction.getDomainID(domain)
+	switch httpStatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return xerrors.Errorf("Linode token lacks access to domain %s: %w", domain, err)
+	default:
+		return err
+	}
+}
+
+// idRecord converts the Linode record into an idRecord.
+func (record linodeRecord) idRecord() idRecord {
+	return idRecord{
+		ID:    strconv.Itoa(record.ID),
+		Type:  record.Type,
+		Name:  record.Name,
+		Value: record.Target,
+		TTL:   record.TTL,
+	}
+}
+
+// makeLinodeRecord converts an idRecord into a Linode record, for creation.
+func makeLinodeRecord(record idRecord) linodeRecord {
+	return linodeRecord{
+		Type:   record.Type,
+		Name:   record.Name,
+		Target: record.Value,
+		TTL:    record.TTL,
+	}
+}
+
+// linodePagePath gets the path of the given page of the listing at the given path.
+func linodePagePath(path string, page int) string {
+	return fmt.Sprintf("%s?page=%d&page_size=%d", path, page, linodePageSize)
+}
+
+// linodeConfig represents the JSON config of a LinodeIPSetter, for use with NewSetterFromConfig.
+type linodeConfig struct {
+	AccessToken string `json:"access_token"`
+}
+
+// newLinodeIPSetterFromConfig makes a LinodeIPSetter from the given JSON config and shared settings.
+func newLinodeIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := linodeConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLinodeIPSetter(
+		config.AccessToken,
+		LinodeRecordTTL(options.RecordTTL),
+		LinodeHTTPConfig(options.HTTPConfig),
+		LinodeRetryPolicy(options.retryPolicy()),
+		LinodeDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+	)
+}
@@ -0,0 +1,264 @@
+package pinamicdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// NamedIPSetter is an IPSetter, along with a name that identifies it in errors.
+type NamedIPSetter struct {
+	Name   string
+	Setter IPSetter
+	// Target, if not nil, is the record that this setter sets, rather than the one given to SetIP. This allows the same
+	// address to be kept under different names, such as a backup hostname with another provider.
+	Target *Target
+	// RecordType, if not empty, is the only type of record that this setter sets: either A or AAAA. Addresses that
+	// belong in the other are skipped.
+	RecordType string
+	// RateLimiter, if not nil, limits how often a MultiSetter calls this setter. Setters that use the same provider may
+	// share one, so that they are limited together.
+	RateLimiter *RateLimiter
+}
+
+// MultiSetter is an IPSetter that sets records with several IPSetters, such as to keep records with more than one
+// provider. A failure of one setter does not prevent the others from being used.
+type MultiSetter struct {
+	setters []NamedIPSetter
+	workers int
+}
+
+// MultiSetError is returned by MultiSetter when any of its setters fail. It holds the error returned by each setter that
+// failed, by name.
+type MultiSetError map[string]error
+
+// MultiSetterWorkers should be passed to NewMultiSetter to control how many of its setters may be used at once. If not
+// given, each setter is used in turn. With more than one worker, the setters, and anything they depend upon, such as a
+// RecordIDCache, must be safe for concurrent use.
+func MultiSetterWorkers(workers int) func(*MultiSetter) error {
+	return func(setter *MultiSetter) error {
+		if workers < 1 {
+			return xerrors.New("workers must be positive")
+		}
+
+		setter.workers = workers
+		return nil
+	}
+}
+
+// NewMultiSetter makes a new MultiSetter, which will use the given setters. Each setter must have a unique name.
+func NewMultiSetter(setters []NamedIPSetter, options ...func(*MultiSetter) error) (MultiSetter, error) {
+	names := map[string]bool{}
+	for _, setter := range setters {
+		if names[setter.Name] {
+			return MultiSetter{}, xerrors.Errorf("could not construct MultiSetter: name %q is used more than once", setter.Name)
+		}
+
+		names[setter.Name] = true
+	}
+
+	setter := MultiSetter{setters: setters, workers: 1}
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return MultiSetter{}, xerrors.Errorf("could not construct MultiSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, using each of the setter's IPSetters. If an
+// IPSetter is also an AccessChecker, its access is checked first. If any of them fail, a MultiSetError is returned.
+func (setter MultiSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done. Up to the setter's
+// number of workers are used at once.
+func (setter MultiSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	// A MultiSetter that was not made with NewMultiSetter has no workers, but must still use its setters.
+	workers := setter.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	setterChan := make(chan NamedIPSetter)
+	errs := MultiSetError{}
+	// errsLock guards errs
+	errsLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for namedSetter := range setterChan {
+				err := namedSetter.setIP(ctx, domain, name, ip)
+				if err == nil {
+					continue
+				}
+
+				errsLock.Lock()
+				errs[namedSetter.Name] = err
+				errsLock.Unlock()
+			}
+		}()
+	}
+
+	for _, namedSetter := range setter.setters {
+		if namedSetter.sets(ip) {
+			setterChan <- namedSetter
+		}
+	}
+
+	close(setterChan)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// PlanIP gets the changes that SetIP would make with each of the setter's IPSetters, attributed to the name of each. If
+// any of them can't plan their changes, the changes of the others are returned along with a MultiSetError.
+func (setter MultiSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	ctx := context.Background()
+	changes := []RecordChange{}
+	errs := MultiSetError{}
+	for _, namedSetter := range setter.setters {
+		if !namedSetter.sets(ip) {
+			continue
+		}
+
+		setterChanges, err := namedSetter.planIP(ctx, domain, name, ip)
+		if err != nil {
+			errs[namedSetter.Name] = err
+			continue
+		}
+
+		changes = append(changes, setterChanges...)
+	}
+
+	if len(errs) > 0 {
+		return changes, errs
+	}
+
+	return changes, nil
+}
+
+// RemoveIP removes the records for the given domain and subdomain name, using each of the setter's IPSetters. Each
+// IPSetter must also be an IPRemover. If any of them fail, a MultiSetError is returned.
+func (setter MultiSetter) RemoveIP(domain, name string) error {
+	return removeIPs(setter.setters, domain, name)
+}
+
+// Error returns a description of each failed setter's error, in order of their names.
+func (err MultiSetError) Error() string {
+	names := make([]string, 0, len(err))
+	for name := range err {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	descriptions := make([]string, 0, len(err))
+	for _, name := range names {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", name, err[name]))
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+// sets checks whether or not the setter sets records of the type that the given address belongs in.
+func (namedSetter NamedIPSetter) sets(ip net.IP) bool {
+	return namedSetter.RecordType == "" || namedSetter.RecordType == ipRecordType(ip)
+}
+
+// target gets the record that the setter sets, given the domain and subdomain name that were asked to be set.
+func (namedSetter NamedIPSetter) target(domain, name string) Target {
+	if namedSetter.Target != nil {
+		return *namedSetter.Target
+	}
+
+	return Target{Domain: domain, Name: name}
+}
+
+// setIP associates the given ip with the setter's target, or else the given domain and subdomain name, once its rate
+// limit allows it.
+func (namedSetter NamedIPSetter) setIP(ctx context.Context, domain, name string, ip net.IP) error {
+	err := namedSetter.RateLimiter.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := namedSetter.target(domain, name)
+
+	return checkAndSetIP(ctx, namedSetter.Setter, target.Domain, target.Name, ip)
+}
+
+// planIP plans the changes that the setter would make to associate the given ip with its target, or else the given
+// domain and subdomain name, attributing them to the setter's name. Planning is limited by the setter's rate limit, as
+// records are still looked up.
+func (namedSetter NamedIPSetter) planIP(ctx context.Context, domain, name string, ip net.IP) ([]RecordChange, error) {
+	err := namedSetter.RateLimiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target := namedSetter.target(domain, name)
+	changes, err := PlanIP(namedSetter.Setter, target.Domain, target.Name, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range changes {
+		changes[i].Setter = namedSetter.Name
+	}
+
+	return changes, nil
+}
+
+// removeIPs removes the records for the given domain and subdomain name using each of the given setters, in the same way
+// as MultiSetter.RemoveIP.
+func removeIPs(setters []NamedIPSetter, domain, name string) error {
+	errs := MultiSetError{}
+	for _, namedSetter := range setters {
+		target := namedSetter.target(domain, name)
+		remover, ok := namedSetter.Setter.(IPRemover)
+		if !ok {
+			errs[namedSetter.Name] = xerrors.New("removing records is not supported")
+			continue
+		}
+
+		err := remover.RemoveIP(target.Domain, target.Name)
+		if err != nil {
+			errs[namedSetter.Name] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// checkAndSetIP checks that the given setter is able to set records for the given domain, if it is an AccessChecker, and
+// then sets the given record with it.
+func checkAndSetIP(ctx context.Context, setter IPSetter, domain, name string, ip net.IP) error {
+	if accessChecker, ok := setter.(AccessChecker); ok {
+		err := accessChecker.CheckAccess(domain)
+		if err != nil {
+			return err
+		}
+	}
+
+	return SetIPContext(ctx, setter, domain, name, ip)
+}
@@ -0,0 +1,218 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const namecheapUpdateURL = "https://dynamicdns.park-your-domain.com/update"
+
+// namecheapApexName is the host that Namecheap gives the records at the apex of a domain.
+const namecheapApexName = "@"
+
+// DefaultNamecheapVerifyTimeout is how long a NamecheapIPSetter waits for Namecheap's nameservers to serve a new
+// address, if no other timeout is given.
+const DefaultNamecheapVerifyTimeout = 5 * time.Minute
+
+// namecheapNameservers are the nameservers that serve domains using Namecheap's BasicDNS.
+var namecheapNameservers = []string{"dns1.registrar-servers.com", "dns2.registrar-servers.com"}
+
+func init() {
+	Register("namecheap", newNamecheapIPSetterFromConfig)
+}
+
+// NamecheapIPSetter is an IPSetter that will update records using Namecheap's dynamic DNS service. As this service
+// cannot list records, each update is confirmed by waiting for Namecheap's nameservers to serve the new address.
+type NamecheapIPSetter struct {
+	password      string
+	httpConfig    HTTPConfig
+	retryPolicy   RetryPolicy
+	nameservers   []string
+	verifyTimeout time.Duration
+}
+
+// namecheapResponse is the response to a dynamic DNS update, as sent by Namecheap.
+type namecheapResponse struct {
+	ErrCount int `xml:"ErrCount"`
+	Errors   struct {
+		Errors []string `xml:",any"`
+	} `xml:"errors"`
+}
+
+// NamecheapHTTPConfig should be passed to NewNamecheapIPSetter to control how the HTTP client that talks to Namecheap
+// is constructed, such as its timeouts.
+func NamecheapHTTPConfig(config HTTPConfig) func(*NamecheapIPSetter) error {
+	return func(setter *NamecheapIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// NamecheapRetryPolicy should be passed to NewNamecheapIPSetter to control how updates are retried when they fail for
+// transient reasons. If not given, DefaultRetryPolicy is used.
+func NamecheapRetryPolicy(policy RetryPolicy) func(*NamecheapIPSetter) error {
+	return func(setter *NamecheapIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// NamecheapNameservers should be passed to NewNamecheapIPSetter if the domain is not served by Namecheap's BasicDNS
+// nameservers, such as when using PremiumDNS.
+func NamecheapNameservers(nameservers ...string) func(*NamecheapIPSetter) error {
+	return func(setter *NamecheapIPSetter) error {
+		if len(nameservers) == 0 {
+			return xerrors.New("at least one nameserver must be given")
+		}
+
+		setter.nameservers = nameservers
+		return nil
+	}
+}
+
+// NamecheapVerifyTimeout should be passed to NewNamecheapIPSetter to control how long to wait for Namecheap's
+// nameservers to serve a new address. If not given, DefaultNamecheapVerifyTimeout is used.
+func NamecheapVerifyTimeout(timeout time.Duration) func(*NamecheapIPSetter) error {
+	return func(setter *NamecheapIPSetter) error {
+		if timeout <= 0 {
+			return xerrors.New("verify timeout must be positive")
+		}
+
+		setter.verifyTimeout = timeout
+		return nil
+	}
+}
+
+// NewNamecheapIPSetter makes a new Namecheap IPSetter, which authenticates with the given dynamic DNS password. This
+// is the password shown in the domain's Advanced DNS settings, not the password to the Namecheap account.
+func NewNamecheapIPSetter(password string, options ...func(*NamecheapIPSetter) error) (NamecheapIPSetter, error) {
+	setter := NamecheapIPSetter{
+		password:      password,
+		retryPolicy:   DefaultRetryPolicy,
+		nameservers:   namecheapNameservers,
+		verifyTimeout: DefaultNamecheapVerifyTimeout,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return NamecheapIPSetter{}, xerrors.Errorf("could not construct NamecheapIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, by sending a dynamic DNS update to Namecheap
+// and waiting for its nameservers to serve the new address.
+func (setter NamecheapIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter NamecheapIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	if ipRecordType(ip) != ARecordType {
+		return xerrors.Errorf("Could not set IP: Namecheap's dynamic DNS can only set A records, not %s", ip)
+	}
+
+	err := setter.retryPolicy.run(ctx, func() error {
+		return setter.sendUpdate(ctx, domain, name, ip)
+	})
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	err = waitForNameservers(ctx, setter.nameservers, fqdn(domain, name), ip, setter.verifyTimeout)
+	if err != nil {
+		return xerrors.Errorf("Could not confirm IP was set: %w", err)
+	}
+
+	return nil
+}
+
+// sendUpdate sends a single dynamic DNS update to Namecheap, associating the given ip with the given domain and name.
+func (setter NamecheapIPSetter) sendUpdate(ctx context.Context, domain, name string, ip net.IP) error {
+	query := url.Values{}
+	query.Set("host", providerRecordName(domain, name, namecheapApexName))
+	query.Set("domain", domain)
+	query.Set("password", setter.password)
+	query.Set("ip", ip.String())
+
+	req, err := http.NewRequest(http.MethodGet, namecheapUpdateURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return xerrors.Errorf("could not build request: %w", err)
+	}
+
+	res, err := setter.httpConfig.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		// The URL holds the password, so it must not end up in any logs.
+		return redactURLError(err, namecheapUpdateURL)
+	}
+
+	defer res.Body.Close()
+	rawResponse, err := readResponse(res)
+	if err != nil {
+		return err
+	}
+
+	response := namecheapResponse{}
+	err = xml.Unmarshal(rawResponse, &response)
+	if err != nil {
+		return xerrors.Errorf("could not decode response: %w", err)
+	} else if response.ErrCount > 0 {
+		return xerrors.Errorf("Namecheap refused update: %s", strings.Join(response.Errors.Errors, "; "))
+	}
+
+	return nil
+}
+
+// namecheapConfig represents the JSON config of a NamecheapIPSetter, for use with NewSetterFromConfig. The access token
+// is the dynamic DNS password.
+type namecheapConfig struct {
+	AccessToken   string   `json:"access_token"`
+	Nameservers   []string `json:"nameservers"`
+	VerifyTimeout Duration `json:"verify_timeout"`
+}
+
+// newNamecheapIPSetterFromConfig makes a NamecheapIPSetter from the given JSON config and shared settings. The record
+// TTL is ignored, as Namecheap's dynamic DNS service does not support it.
+func newNamecheapIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := namecheapConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" {
+		return nil, xerrors.New("access_token must be given")
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*NamecheapIPSetter) error{
+		NamecheapHTTPConfig(options.HTTPConfig),
+		NamecheapRetryPolicy(options.retryPolicy()),
+	}
+	if len(config.Nameservers) > 0 {
+		setterOptions = append(setterOptions, NamecheapNameservers(config.Nameservers...))
+	}
+	if config.VerifyTimeout != 0 {
+		setterOptions = append(setterOptions, NamecheapVerifyTimeout(time.Duration(config.VerifyTimeout)))
+	}
+
+	return NewNamecheapIPSetter(config.AccessToken, setterOptions...)
+}
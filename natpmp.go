@@ -0,0 +1,153 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultNATPMPTimeout is how long a NATPMPIPSource waits for the router to respond, if no other timeout is given.
+const DefaultNATPMPTimeout = 5 * time.Second
+
+// natPMPPort is the port that routers listen for NAT-PMP requests on.
+const natPMPPort = "5351"
+
+// natPMPInitialRetransmitWait is how long to wait for a response to the first NAT-PMP request before sending it again.
+// As RFC 6886 specifies, each later request waits twice as long as the last.
+const natPMPInitialRetransmitWait = 250 * time.Millisecond
+
+// Opcodes of NAT-PMP messages
+const (
+	natPMPExternalAddressOpcode         = 0
+	natPMPExternalAddressResponseOpcode = 128
+)
+
+// natPMPResultDescriptions describe the non-successful result codes a router may respond to a NAT-PMP request with.
+var natPMPResultDescriptions = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// NATPMPIPSource is an IPSource that asks the local router for its external address using NAT-PMP, which many home
+// routers support. This is often both faster and more accurate than asking a web service, as no requests leave the
+// local network.
+type NATPMPIPSource struct {
+	gateway string
+	timeout time.Duration
+}
+
+// NATPMPTimeout should be passed to NewNATPMPIPSource to control how long to wait for the router to respond. If not
+// given, DefaultNATPMPTimeout is used.
+func NATPMPTimeout(timeout time.Duration) func(*NATPMPIPSource) error {
+	return func(source *NATPMPIPSource) error {
+		if timeout <= 0 {
+			return xerrors.New("timeout must be positive")
+		}
+
+		source.timeout = timeout
+		return nil
+	}
+}
+
+// NewNATPMPIPSource makes a new NATPMPIPSource, which will ask the router at the given IP address, usually the
+// default gateway of the local network, for its external address.
+func NewNATPMPIPSource(gateway string, options ...func(*NATPMPIPSource) error) (NATPMPIPSource, error) {
+	if net.ParseIP(gateway) == nil {
+		return NATPMPIPSource{}, xerrors.Errorf("could not construct NATPMPIPSource: invalid gateway address %q", gateway)
+	}
+
+	source := NATPMPIPSource{
+		gateway: net.JoinHostPort(gateway, natPMPPort),
+		timeout: DefaultNATPMPTimeout,
+	}
+
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return NATPMPIPSource{}, xerrors.Errorf("could not construct NATPMPIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the current external IP address of the source's router. As NAT-PMP is sent over UDP, the request is sent
+// again each time the router is slow to respond, until the source's timeout passes.
+func (source NATPMPIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source NATPMPIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", source.gateway)
+	if err != nil {
+		return nil, xerrors.Errorf("could not connect to router at %s: %w", source.gateway, err)
+	}
+
+	defer conn.Close()
+	deadline := time.Now().Add(source.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	wait := natPMPInitialRetransmitWait
+	res := make([]byte, 16)
+	for {
+		_, err = conn.Write([]byte{0, natPMPExternalAddressOpcode})
+		if err != nil {
+			return nil, xerrors.Errorf("could not send NAT-PMP request to %s: %w", source.gateway, err)
+		}
+
+		readDeadline := time.Now().Add(wait)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+
+		err = conn.SetReadDeadline(readDeadline)
+		if err != nil {
+			return nil, xerrors.Errorf("could not send NAT-PMP request to %s: %w", source.gateway, err)
+		}
+
+		var n int
+		n, err = conn.Read(res)
+		if err == nil {
+			return parseNATPMPExternalAddress(res[:n])
+		}
+
+		netErr, ok := err.(net.Error)
+		if !ok || !netErr.Timeout() || !time.Now().Before(deadline) {
+			return nil, xerrors.Errorf("could not get NAT-PMP response from %s: %w", source.gateway, err)
+		} else if ctx.Err() != nil {
+			// The request is only retransmitted after short waits, so there's no need to interrupt them.
+			return nil, xerrors.Errorf("gave up on NAT-PMP response from %s: %w", source.gateway, ctx.Err())
+		}
+
+		wait *= 2
+	}
+}
+
+// parseNATPMPExternalAddress gets the external address from the given response to a NAT-PMP external address request.
+func parseNATPMPExternalAddress(res []byte) (net.IP, error) {
+	if len(res) < 12 || res[0] != 0 || res[1] != natPMPExternalAddressResponseOpcode {
+		return nil, xerrors.New("router returned a malformed NAT-PMP response")
+	}
+
+	resultCode := binary.BigEndian.Uint16(res[2:4])
+	if resultCode != 0 {
+		description, ok := natPMPResultDescriptions[resultCode]
+		if !ok {
+			description = "unknown error"
+		}
+
+		return nil, xerrors.Errorf("router refused NAT-PMP request: %s (%d)", description, resultCode)
+	}
+
+	return net.IPv4(res[8], res[9], res[10], res[11]), nil
+}
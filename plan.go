@@ -0,0 +1,132 @@
+package pinamicdns
+
+import "net"
+
+// Actions that a RecordChange may describe
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	// ChangeSet describes what a setter that can't plan its changes would set, without knowing whether that would
+	// create, update, or delete any records.
+	ChangeSet = "set"
+)
+
+// RecordChange is a change to a record that setting an IP would make, as planned by PlanIP.
+type RecordChange struct {
+	Action string
+	// Setter is the name of the NamedIPSetter that would make the change, if it would be made by one.
+	Setter string
+	Domain string
+	Type   string
+	// Name is the subdomain name of the record, as given to the setter.
+	Name string
+	// OldValue and OldTTL are those of the record before the change, unless it would be created.
+	OldValue string
+	OldTTL   int
+	// NewValue and NewTTL are those of the record after the change, unless it would be deleted. If NewTTL is zero, the
+	// setter chooses one.
+	NewValue string
+	NewTTL   int
+}
+
+// IPPlanner is implemented by IPSetters that can tell what setting an IP would change without changing anything, such
+// as to try out a config before it touches any records.
+type IPPlanner interface {
+	// PlanIP gets the changes that SetIP would make to records to associate the given ip with the given domain and
+	// subdomain name. Records may be read, but none are written.
+	PlanIP(domain, name string, ip net.IP) ([]RecordChange, error)
+}
+
+// PlanIP gets the changes that the given setter would make to associate the given ip with the given domain and
+// subdomain name, without making them. If the setter is not an IPPlanner, the only change given is what it would set,
+// with the ChangeSet action.
+func PlanIP(setter IPSetter, domain, name string, ip net.IP) ([]RecordChange, error) {
+	if planner, ok := setter.(IPPlanner); ok {
+		return planner.PlanIP(domain, name, ip)
+	}
+
+	change := RecordChange{Action: ChangeSet, Domain: domain, Type: ipRecordType(ip), Name: name, NewValue: ip.String()}
+
+	return []RecordChange{change}, nil
+}
+
+// idRecordPlanner is an idRecordAPI that lists records with another idRecordAPI, but only notes the changes that would
+// be made to them, so that the changes made by functions such as setIDRecord can be planned without being made.
+type idRecordPlanner struct {
+	api idRecordAPI
+	// target is the record being planned for, as it was given to PlanIP.
+	target Target
+	// listed holds each record that has been listed, by ID, as it would be once the planned changes were made.
+	listed  map[string]idRecord
+	changes []RecordChange
+}
+
+// planIDRecord plans the changes that setIDRecord would make to set the given record in the given zone with the
+// given API, which is for the given target.
+func planIDRecord(api idRecordAPI, zone string, target Target, record idRecord, policy DuplicateRecordPolicy) ([]RecordChange, error) {
+	planner := &idRecordPlanner{api: api, target: target, listed: map[string]idRecord{}, changes: []RecordChange{}}
+	_, err := setIDRecord(planner, zone, record, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return planner.changes, nil
+}
+
+// listIDRecords lists the records with the planner's API, noting them so that changes to them can be described.
+func (planner *idRecordPlanner) listIDRecords(zone, recordType, name string) ([]idRecord, error) {
+	records, err := planner.api.listIDRecords(zone, recordType, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		planner.listed[record.ID] = record
+	}
+
+	return records, nil
+}
+
+// createIDRecord notes that the given record would be created.
+func (planner *idRecordPlanner) createIDRecord(zone string, record idRecord) (idRecord, error) {
+	planner.note(ChangeCreate, idRecord{}, record)
+
+	return record, nil
+}
+
+// updateIDRecord notes that the record with the ID of the given record would be updated to match it.
+func (planner *idRecordPlanner) updateIDRecord(zone string, record idRecord) (idRecord, error) {
+	planner.note(ChangeUpdate, planner.listed[record.ID], record)
+	planner.listed[record.ID] = record
+
+	return record, nil
+}
+
+// deleteIDRecord notes that the record with the ID of the given record would be deleted.
+func (planner *idRecordPlanner) deleteIDRecord(zone string, record idRecord) error {
+	planner.note(ChangeDelete, planner.listed[record.ID], idRecord{})
+	delete(planner.listed, record.ID)
+
+	return nil
+}
+
+// note notes a change with the given action from the given old record to the given new one, either of which is empty
+// if there is no such record.
+func (planner *idRecordPlanner) note(action string, oldRecord idRecord, newRecord idRecord) {
+	recordType := newRecord.Type
+	if recordType == "" {
+		recordType = oldRecord.Type
+	}
+
+	planner.changes = append(planner.changes, RecordChange{
+		Action:   action,
+		Domain:   planner.target.Domain,
+		Type:     recordType,
+		Name:     planner.target.Name,
+		OldValue: oldRecord.Value,
+		OldTTL:   oldRecord.TTL,
+		NewValue: newRecord.Value,
+		NewTTL:   newRecord.TTL,
+	})
+}
@@ -0,0 +1,348 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+const porkbunAPIBaseURL = "https://api.porkbun.com/api/json/v3"
+
+// porkbunSuccessStatus is the status Porkbun gives in the body of every successful response.
+const porkbunSuccessStatus = "SUCCESS"
+
+// porkbunApexName is the subdomain that Porkbun gives the records at the apex of a domain.
+const porkbunApexName = ""
+
+func init() {
+	Register("porkbun", newPorkbunIPSetterFromConfig)
+}
+
+// PorkbunIPSetter is an IPSetter that will update records with Porkbun
+type PorkbunIPSetter struct {
+	apiKey          string
+	secretAPIKey    string
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+	duplicatePolicy DuplicateRecordPolicy
+}
+
+// porkbunTransaction holds all elements necessary to talk to the Porkbun API, in the context of a single
+// PorkbunIPSetter.SetIP call.
+type porkbunTransaction struct {
+	client       restClient
+	apiKey       string
+	secretAPIKey string
+}
+
+// porkbunRequest is the body of a request to the Porkbun API. Porkbun takes credentials in the body of every request,
+// rather than in a header.
+type porkbunRequest struct {
+	APIKey       string `json:"apikey"`
+	SecretAPIKey string `json:"secretapikey"`
+	Name         string `json:"name,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Content      string `json:"content,omitempty"`
+	TTL          string `json:"ttl,omitempty"`
+}
+
+// porkbunResponse holds the fields common to every response from the Porkbun API.
+type porkbunResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// porkbunRecord is a DNS record, as represented by the Porkbun API. Porkbun inconsistently sends numbers as strings,
+// so they are held as json.Numbers.
+type porkbunRecord struct {
+	ID      json.Number `json:"id"`
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Content string      `json:"content"`
+	TTL     json.Number `json:"ttl"`
+}
+
+// PorkbunRecordTTL should be passed to NewPorkbunIPSetter if a TTL is desired for the records it sets. Porkbun does
+// not allow TTLs of less than 600 seconds.
+func PorkbunRecordTTL(ttl int) func(*PorkbunIPSetter) error {
+	return func(setter *PorkbunIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// PorkbunHTTPConfig should be passed to NewPorkbunIPSetter to control how the HTTP client that talks to the Porkbun
+// API is constructed, such as its timeouts.
+func PorkbunHTTPConfig(config HTTPConfig) func(*PorkbunIPSetter) error {
+	return func(setter *PorkbunIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// PorkbunRetryPolicy should be passed to NewPorkbunIPSetter to control how calls to the Porkbun API are retried when
+// they fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func PorkbunRetryPolicy(policy RetryPolicy) func(*PorkbunIPSetter) error {
+	return func(setter *PorkbunIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// PorkbunDuplicateRecordPolicy should be passed to NewPorkbunIPSetter to control what is done when several records
+// exist for the same name. If not given, UpdateFirstDuplicate is used.
+func PorkbunDuplicateRecordPolicy(policy DuplicateRecordPolicy) func(*PorkbunIPSetter) error {
+	return func(setter *PorkbunIPSetter) error {
+		setter.duplicatePolicy = policy
+		return nil
+	}
+}
+
+// NewPorkbunIPSetter makes a new Porkbun IPSetter, which authenticates with the given API key and secret API key. API
+// access must be enabled for the domain in Porkbun's domain management.
+func NewPorkbunIPSetter(apiKey, secretAPIKey string, options ...func(*PorkbunIPSetter) error) (PorkbunIPSetter, error) {
+	setter := PorkbunIPSetter{
+		apiKey:       apiKey,
+		secretAPIKey: secretAPIKey,
+		retryPolicy:  DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return PorkbunIPSetter{}, xerrors.Errorf("could not construct PorkbunIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeTransaction will make a new Porkbun API transaction for the given setter.
+func (setter PorkbunIPSetter) makeTransaction(ctx context.Context) porkbunTransaction {
+	return porkbunTransaction{
+		client:       newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, porkbunAPIBaseURL, http.Header{}),
+		apiKey:       setter.apiKey,
+		secretAPIKey: setter.secretAPIKey,
+	}
+}
+
+// do makes a request to the given path of the Porkbun API with the given body, to which credentials are added. The
+// JSON response is decoded into out, if it is not nil.
+func (transaction porkbunTransaction) do(path string, body porkbunRequest, out interface{}) error {
+	return transaction.request(path, body, out, false)
+}
+
+// create makes a request that creates a record in the same manner as do, except that, like restClient.create, it is
+// only retried if it was never applied.
+func (transaction porkbunTransaction) create(path string, body porkbunRequest, out interface{}) error {
+	return transaction.request(path, body, out, true)
+}
+
+// request makes a request in the same manner as do, with the client's create if it creates something.
+func (transaction porkbunTransaction) request(path string, body porkbunRequest, out interface{}, create bool) error {
+	body.APIKey = transaction.apiKey
+	body.SecretAPIKey = transaction.secretAPIKey
+
+	rawResponse := json.RawMessage{}
+	var err error
+	if create {
+		err = transaction.client.create(path, body, &rawResponse)
+	} else {
+		err = transaction.client.do(http.MethodPost, path, body, &rawResponse)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	response := porkbunResponse{}
+	err = json.Unmarshal(rawResponse, &response)
+	if err != nil {
+		return xerrors.Errorf("could not decode response: %w", err)
+	} else if response.Status != porkbunSuccessStatus {
+		return xerrors.Errorf("Porkbun API responded with status %s: %s", response.Status, response.Message)
+	} else if out == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(rawResponse, out)
+	if err != nil {
+		return xerrors.Errorf("could not decode response: %w", err)
+	}
+
+	return nil
+}
+
+// listIDRecords gets all of the records for the given domain with the given type and name.
+func (transaction porkbunTransaction) listIDRecords(domain, recordType, name string) ([]idRecord, error) {
+	var response struct {
+		Records []porkbunRecord `json:"records"`
+	}
+
+	path := "/dns/retrieveByNameType/" + url.PathEscape(domain) + "/" + recordType + "/" + url.PathEscape(name)
+	err := transaction.do(path, porkbunRequest{}, &response)
+	if err != nil {
+		return nil, xerrors.Errorf("could not ask Porkbun API for records: %w", err)
+	}
+
+	records := make([]idRecord, 0, len(response.Records))
+	for _, record := range response.Records {
+		// Porkbun gives the full name of each record, but only the subdomain may be given when editing it.
+		records = append(records, record.idRecord(name))
+	}
+
+	return records, nil
+}
+
+// createIDRecord creates the given record for the given domain.
+func (transaction porkbunTransaction) createIDRecord(domain string, record idRecord) (idRecord, error) {
+	var response struct {
+		ID json.Number `json:"id"`
+	}
+
+	err := transaction.create("/dns/create/"+url.PathEscape(domain), makePorkbunRequest(record), &response)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not create record for domain: %w", err)
+	}
+
+	record.ID = response.ID.String()
+	return record, nil
+}
+
+// updateIDRecord updates the record for the given domain with the ID of the given record to match it.
+func (transaction porkbunTransaction) updateIDRecord(domain string, record idRecord) (idRecord, error) {
+	path := "/dns/edit/" + url.PathEscape(domain) + "/" + url.PathEscape(record.ID)
+	err := transaction.do(path, makePorkbunRequest(record), nil)
+	if err != nil {
+		return idRecord{}, xerrors.Errorf("could not update record for domain: %w", err)
+	}
+
+	return record, nil
+}
+
+// deleteIDRecord deletes the record for the given domain with the ID of the given record.
+func (transaction porkbunTransaction) deleteIDRecord(domain string, record idRecord) error {
+	path := "/dns/delete/" + url.PathEscape(domain) + "/" + url.PathEscape(record.ID)
+	err := transaction.do(path, porkbunRequest{}, nil)
+	if err != nil {
+		return xerrors.Errorf("could not delete record for domain: %w", err)
+	}
+
+	return nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with Porkbun.
+func (setter PorkbunIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter PorkbunIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	transaction := setter.makeTransaction(ctx)
+	record := setter.ipRecord(domain, name, ip)
+	_, err := setIDRecord(transaction, domain, record, setter.duplicatePolicy)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// PlanIP gets the changes that SetIP would make to Porkbun's records, without making them.
+func (setter PorkbunIPSetter) PlanIP(domain, name string, ip net.IP) ([]RecordChange, error) {
+	transaction := setter.makeTransaction(context.Background())
+	target := Target{Domain: domain, Name: name}
+	changes, err := planIDRecord(transaction, domain, target, setter.ipRecord(domain, name, ip), setter.duplicatePolicy)
+	if err != nil {
+		return nil, xerrors.Errorf("Could not plan IP: %w", err)
+	}
+
+	return changes, nil
+}
+
+// ipRecord makes the record that associates the given ip with the given domain and subdomain name.
+func (setter PorkbunIPSetter) ipRecord(domain, name string, ip net.IP) idRecord {
+	return idRecord{
+		Type:  ipRecordType(ip),
+		Name:  providerRecordName(domain, name, porkbunApexName),
+		Value: ip.String(),
+		TTL:   setter.recordTTL,
+	}
+}
+
+// CheckAccess confirms that the setter's keys are able to access the given domain.
+func (setter PorkbunIPSetter) CheckAccess(domain string) error {
+	transaction := setter.makeTransaction(context.Background())
+	err := transaction.do("/dns/retrieve/"+url.PathEscape(domain), porkbunRequest{}, nil)
+	if err != nil {
+		return xerrors.Errorf("Porkbun keys lack access to domain %s, or API access is not enabled for it: %w", domain, err)
+	}
+
+	return nil
+}
+
+// idRecord converts the Porkbun record into an idRecord with the given subdomain name.
+func (record porkbunRecord) idRecord(name string) idRecord {
+	// A TTL that can't be understood is left as zero, which is never the TTL we want, so the record will be updated.
+	ttl, _ := strconv.Atoi(record.TTL.String())
+
+	return idRecord{
+		ID:    record.ID.String(),
+		Type:  record.Type,
+		Name:  name,
+		Value: record.Content,
+		TTL:   ttl,
+	}
+}
+
+// makePorkbunRequest converts an idRecord into the body of a request to create or edit it.
+func makePorkbunRequest(record idRecord) porkbunRequest {
+	request := porkbunRequest{
+		Name:    record.Name,
+		Type:    record.Type,
+		Content: record.Value,
+	}
+
+	if record.TTL != 0 {
+		request.TTL = strconv.Itoa(record.TTL)
+	}
+
+	return request
+}
+
+// porkbunConfig represents the JSON config of a PorkbunIPSetter, for use with NewSetterFromConfig.
+type porkbunConfig struct {
+	APIKey       string `json:"api_key"`
+	SecretAPIKey string `json:"secret_api_key"`
+}
+
+// newPorkbunIPSetterFromConfig makes a PorkbunIPSetter from the given JSON config and shared settings.
+func newPorkbunIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := porkbunConfig{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.APIKey == "" || config.SecretAPIKey == "" {
+		return nil, xerrors.New("api_key and secret_api_key must be given")
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPorkbunIPSetter(
+		config.APIKey,
+		config.SecretAPIKey,
+		PorkbunRecordTTL(options.RecordTTL),
+		PorkbunHTTPConfig(options.HTTPConfig),
+		PorkbunRetryPolicy(options.retryPolicy()),
+		PorkbunDuplicateRecordPolicy(options.DuplicateRecordPolicy),
+	)
+}
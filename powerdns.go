@@ -0,0 +1,224 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultPowerDNSServerID is the ID of the server that a PowerDNSIPSetter updates, if no other is given. PowerDNS
+// always uses this ID for the server it is running on.
+const DefaultPowerDNSServerID = "localhost"
+
+func init() {
+	Register("powerdns", newPowerDNSIPSetterFromConfig)
+}
+
+// PowerDNSIPSetter is an IPSetter that will update records using the HTTP API of a PowerDNS Authoritative Server. Each
+// update replaces all of the A or AAAA records for the name, so the records are always consolidated into one.
+type PowerDNSIPSetter struct {
+	apiURL      string
+	apiKey      string
+	serverID    string
+	zone        string
+	recordTTL   int
+	httpConfig  HTTPConfig
+	retryPolicy RetryPolicy
+}
+
+// powerDNSRRSetChange is a change to a set of records, as represented by the PowerDNS API.
+type powerDNSRRSetChange struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	TTL        int              `json:"ttl"`
+	ChangeType string           `json:"changetype"`
+	Records    []powerDNSRecord `json:"records"`
+}
+
+// powerDNSRecord is a single record in a set of records, as represented by the PowerDNS API.
+type powerDNSRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+// PowerDNSServerID should be passed to NewPowerDNSIPSetter if the zone is not held by the server with the ID
+// DefaultPowerDNSServerID.
+func PowerDNSServerID(serverID string) func(*PowerDNSIPSetter) error {
+	return func(setter *PowerDNSIPSetter) error {
+		setter.serverID = serverID
+		return nil
+	}
+}
+
+// PowerDNSZone should be passed to NewPowerDNSIPSetter if the zone that is updated is not the domain passed to SetIP,
+// such as when the domain is delegated from a zone further up.
+func PowerDNSZone(zone string) func(*PowerDNSIPSetter) error {
+	return func(setter *PowerDNSIPSetter) error {
+		setter.zone = zone
+		return nil
+	}
+}
+
+// PowerDNSRecordTTL should be passed to NewPowerDNSIPSetter if a TTL is desired for the records it sets.
+func PowerDNSRecordTTL(ttl int) func(*PowerDNSIPSetter) error {
+	return func(setter *PowerDNSIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// PowerDNSHTTPConfig should be passed to NewPowerDNSIPSetter to control how the HTTP client that talks to the PowerDNS
+// API is constructed, such as its timeouts.
+func PowerDNSHTTPConfig(config HTTPConfig) func(*PowerDNSIPSetter) error {
+	return func(setter *PowerDNSIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// PowerDNSRetryPolicy should be passed to NewPowerDNSIPSetter to control how calls to the PowerDNS API are retried when
+// they fail for transient reasons. If not given, DefaultRetryPolicy is used.
+func PowerDNSRetryPolicy(policy RetryPolicy) func(*PowerDNSIPSetter) error {
+	return func(setter *PowerDNSIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// NewPowerDNSIPSetter makes a new PowerDNS IPSetter, which will talk to the API at the given URL, such as
+// http://localhost:8081, and authenticate with the given API key.
+func NewPowerDNSIPSetter(apiURL, apiKey string, options ...func(*PowerDNSIPSetter) error) (PowerDNSIPSetter, error) {
+	parsedURL, err := url.Parse(apiURL)
+	if err != nil {
+		return PowerDNSIPSetter{}, xerrors.Errorf("could not construct PowerDNSIPSetter: invalid API URL: %w", err)
+	} else if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return PowerDNSIPSetter{}, xerrors.Errorf("could not construct PowerDNSIPSetter: API URL must be http or https")
+	}
+
+	setter := PowerDNSIPSetter{
+		apiURL:      strings.TrimSuffix(apiURL, "/"),
+		apiKey:      apiKey,
+		serverID:    DefaultPowerDNSServerID,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return PowerDNSIPSetter{}, xerrors.Errorf("could not construct PowerDNSIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// makeClient will make a new client for the PowerDNS API of the given setter.
+func (setter PowerDNSIPSetter) makeClient(ctx context.Context) restClient {
+	header := http.Header{}
+	header.Set("X-API-Key", setter.apiKey)
+
+	return newRESTClient(ctx, setter.httpConfig, setter.retryPolicy, setter.apiURL+"/api/v1", header)
+}
+
+// zonePath gets the path of the zone that holds the given domain, relative to the PowerDNS API.
+func (setter PowerDNSIPSetter) zonePath(domain string) string {
+	zone := setter.zone
+	if zone == "" {
+		zone = domain
+	}
+
+	return "/servers/" + url.PathEscape(setter.serverID) + "/zones/" + url.PathEscape(canonicalDomain(zone))
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record with PowerDNS.
+func (setter PowerDNSIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter PowerDNSIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	change := powerDNSRRSetChange{
+		Name:       canonicalDomain(fqdn(domain, name)),
+		Type:       ipRecordType(ip),
+		TTL:        setter.recordTTL,
+		ChangeType: "REPLACE",
+		Records:    []powerDNSRecord{{Content: ip.String()}},
+	}
+
+	body := struct {
+		RRSets []powerDNSRRSetChange `json:"rrsets"`
+	}{
+		RRSets: []powerDNSRRSetChange{change},
+	}
+
+	client := setter.makeClient(ctx)
+	err := client.do(http.MethodPatch, setter.zonePath(domain), body, nil)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// CheckAccess confirms that the setter's API key is able to access the zone for the given domain.
+func (setter PowerDNSIPSetter) CheckAccess(domain string) error {
+	client := setter.makeClient(context.Background())
+	err := client.do(http.MethodGet, setter.zonePath(domain), nil, nil)
+	switch httpStatusCode(err) {
+	case 0:
+		return err
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return xerrors.Errorf("PowerDNS API key was refused: %w", err)
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return xerrors.Errorf("zone for %s does not exist on PowerDNS server %s: %w", domain, setter.serverID, err)
+	default:
+		return xerrors.Errorf("could not check access to zone for %s: %w", domain, err)
+	}
+}
+
+// powerDNSConfig represents the JSON config of a PowerDNSIPSetter, for use with NewSetterFromConfig. The access token is
+// the API key.
+type powerDNSConfig struct {
+	AccessToken string `json:"access_token"`
+	APIURL      string `json:"api_url"`
+	ServerID    string `json:"server_id"`
+	Zone        string `json:"zone"`
+}
+
+// newPowerDNSIPSetterFromConfig makes a PowerDNSIPSetter from the given JSON config and shared settings.
+func newPowerDNSIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := powerDNSConfig{ServerID: DefaultPowerDNSServerID}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.AccessToken == "" || config.APIURL == "" {
+		return nil, xerrors.New("access_token and api_url must be given")
+	} else if options.RecordTTL == 0 {
+		return nil, xerrors.New("a record TTL must be given")
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPowerDNSIPSetter(
+		config.APIURL,
+		config.AccessToken,
+		PowerDNSServerID(config.ServerID),
+		PowerDNSZone(config.Zone),
+		PowerDNSRecordTTL(options.RecordTTL),
+		PowerDNSHTTPConfig(options.HTTPConfig),
+		PowerDNSRetryPolicy(options.retryPolicy()),
+	)
+}
@@ -0,0 +1,53 @@
+package pinamicdns
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Target identifies a single record that an IP should be set for.
+type Target struct {
+	Domain string
+	Name   string
+}
+
+// RateLimiter limits how frequently calls may be made to a provider, so that many concurrent calls will not exceed its
+// API limits. It may be shared by several NamedIPSetters that use the same provider, and is safe for concurrent use.
+type RateLimiter struct {
+	minInterval time.Duration
+	// lock guards nextCall
+	lock     sync.Mutex
+	nextCall time.Time
+}
+
+// NewRateLimiter makes a new RateLimiter that will wait at least minInterval between the start of any two calls.
+func NewRateLimiter(minInterval time.Duration) *RateLimiter {
+	return &RateLimiter{minInterval: minInterval}
+}
+
+// Wait waits until the rate limit allows another call to be made, giving up once the given context is done. A nil
+// RateLimiter never waits.
+func (limiter *RateLimiter) Wait(ctx context.Context) error {
+	if limiter == nil {
+		return ctx.Err()
+	}
+
+	return sleep(ctx, limiter.reserveCall())
+}
+
+// reserveCall reserves the next available time slot for a call, returning how long the caller must wait for it.
+func (limiter *RateLimiter) reserveCall() time.Duration {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+	callTime := limiter.nextCall
+	if callTime.Before(now) {
+		callTime = now
+	}
+
+	limiter.nextCall = callTime.Add(limiter.minInterval)
+
+	return callTime.Sub(now)
+}
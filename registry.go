@@ -0,0 +1,152 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SetterFactory makes an IPSetter from the given JSON config, whose contents are specific to the provider, along with
+// the given settings that are shared by all providers.
+type SetterFactory func(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error)
+
+// SetterOptions holds the settings that are shared by all providers made with NewSetterFromConfig. A provider that does
+// not support a setting will refuse to be made if it is given, with the exception of the caches, which are only used
+// by providers that are able to.
+type SetterOptions struct {
+	RecordTTL             int
+	HTTPConfig            HTTPConfig
+	DuplicateRecordPolicy DuplicateRecordPolicy
+	ConvergenceCheck      ConvergenceCheck
+	RecordIDCache         RecordIDCache
+	ResponseCache         ResponseCache
+	// RetryPolicy controls how calls to the provider are retried when they fail for transient reasons. If zero,
+	// DefaultRetryPolicy is used.
+	RetryPolicy RetryPolicy
+}
+
+// Duration is a time.Duration that is represented in JSON as a string, such as "30s".
+type Duration time.Duration
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]SetterFactory{}
+)
+
+// Register makes the provider with the given name available to NewSetterFromConfig, which will use the given factory
+// to make its IPSetters. All providers in this package are registered automatically. Register panics if a provider
+// with the same name has already been registered.
+func Register(providerName string, factory SetterFactory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if factory == nil {
+		panic("pinamicdns: Register factory is nil")
+	} else if _, exists := factories[providerName]; exists {
+		panic("pinamicdns: Register called twice for provider " + providerName)
+	}
+
+	factories[providerName] = factory
+}
+
+// Providers gets the names of all registered providers, in sorted order.
+func Providers() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	providerNames := make([]string, 0, len(factories))
+	for providerName := range factories {
+		providerNames = append(providerNames, providerName)
+	}
+
+	sort.Strings(providerNames)
+
+	return providerNames
+}
+
+// NewSetterFromConfig makes an IPSetter for the registered provider with the given name, from the given JSON config
+// and shared settings.
+func NewSetterFromConfig(providerName string, rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	factoriesLock.RLock()
+	factory, exists := factories[providerName]
+	factoriesLock.RUnlock()
+
+	if !exists {
+		return nil, xerrors.Errorf("unknown provider %q", providerName)
+	}
+
+	setter, err := factory(rawConfig, options)
+	if err != nil {
+		return nil, xerrors.Errorf("could not configure %s provider: %w", providerName, err)
+	}
+
+	return setter, nil
+}
+
+// UnmarshalJSON parses a JSON string into a Duration.
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var rawDuration string
+	err := json.Unmarshal(data, &rawDuration)
+	if err != nil {
+		return err
+	}
+
+	parsedDuration, err := time.ParseDuration(rawDuration)
+	if err != nil {
+		return err
+	}
+
+	*duration = Duration(parsedDuration)
+
+	return nil
+}
+
+// retryPolicy gets the RetryPolicy that providers should be made with.
+func (options SetterOptions) retryPolicy() RetryPolicy {
+	if options.RetryPolicy == (RetryPolicy{}) {
+		return DefaultRetryPolicy
+	}
+
+	return options.RetryPolicy
+}
+
+// rejectDuplicateRecordPolicy returns an error if the options ask for duplicate records to be handled other than by
+// updating only the first of them. It should be used by providers that are unable to do so.
+func (options SetterOptions) rejectDuplicateRecordPolicy() error {
+	if options.DuplicateRecordPolicy != UpdateFirstDuplicate {
+		return xerrors.New("handling of duplicate records is not supported")
+	}
+
+	return nil
+}
+
+// rejectConvergenceCheck returns an error if the options ask for a ConvergenceCheck. It should be used by providers that
+// are unable to perform one.
+func (options SetterOptions) rejectConvergenceCheck() error {
+	if options.ConvergenceCheck != (ConvergenceCheck{}) {
+		return xerrors.New("verification of updates is not supported")
+	}
+
+	return nil
+}
+
+// decodeSetterConfig decodes the given raw JSON config into the given struct. Fields that the struct does not have are
+// rejected, so that a misspelled field is not silently ignored. If there is no config, the struct is left alone.
+func decodeSetterConfig(rawConfig json.RawMessage, config interface{}) error {
+	if len(rawConfig) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawConfig))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return xerrors.Errorf("provider_config: %w", err)
+	}
+
+	return nil
+}
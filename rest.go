@@ -0,0 +1,191 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// maxRESTRateLimitWait is the longest that a restClient will wait for a provider's rate limits to reset before giving up.
+const maxRESTRateLimitWait = 15 * time.Minute
+
+// maxErrorBodySize is the maximum number of bytes of an unsuccessful response's body that will be included in an error.
+const maxErrorBodySize = 1024
+
+// restClient makes requests to a provider's JSON HTTP API, in the context of a single IPSetter call.
+type restClient struct {
+	ctx         context.Context
+	client      *http.Client
+	baseURL     string
+	header      http.Header
+	retryPolicy RetryPolicy
+}
+
+// httpStatusError is returned when a provider's API responds with an unsuccessful status code.
+type httpStatusError struct {
+	statusCode int
+	header     http.Header
+	body       string
+}
+
+// Error returns a description of the unsuccessful response.
+func (err httpStatusError) Error() string {
+	if err.body == "" {
+		return fmt.Sprintf("API responded with status %d", err.statusCode)
+	}
+
+	return fmt.Sprintf("API responded with status %d: %s", err.statusCode, err.body)
+}
+
+// newRESTClient makes a new restClient which will make requests relative to the given base URL, with the given headers
+// attached to every request.
+func newRESTClient(ctx context.Context, httpConfig HTTPConfig, retryPolicy RetryPolicy, baseURL string, header http.Header) restClient {
+	return restClient{
+		ctx:         ctx,
+		client:      httpConfig.Client(),
+		baseURL:     baseURL,
+		header:      header,
+		retryPolicy: retryPolicy,
+	}
+}
+
+// do makes a request with the given method to the given path, relative to the client's base URL. If body is not nil,
+// it is encoded as the JSON body of the request. If out is not nil, the JSON response is decoded into it. The request
+// is retried in correspondence with the client's retry policy, and if the provider indicates we have exceeded its rate
+// limit, the request is retried once the limit resets.
+func (client restClient) do(method, path string, body, out interface{}) error {
+	return client.request(method, path, body, out, client.retryPolicy.run)
+}
+
+// create makes a POST request to the given path that creates something, such as a record, in the same manner as do.
+// As making it again after it was applied would create a duplicate, it is only retried if it was never applied.
+func (client restClient) create(path string, body, out interface{}) error {
+	return client.request(http.MethodPost, path, body, out, client.retryPolicy.runUnapplied)
+}
+
+// request makes a request in the same manner as do, retrying it with the given function of the client's retry policy.
+func (client restClient) request(method, path string, body, out interface{}, retry func(context.Context, func() error) error) error {
+	var rawBody []byte
+	if body != nil {
+		var err error
+		rawBody, err = json.Marshal(body)
+		if err != nil {
+			return xerrors.Errorf("could not encode request body: %w", err)
+		}
+	}
+
+	// Holds the total amount of time we have spent waiting for rate limits to reset
+	var rateLimitWaited time.Duration
+	for {
+		var rawResponse []byte
+		err := retry(client.ctx, func() error {
+			var err error
+			rawResponse, err = client.doOnce(method, path, rawBody)
+
+			return err
+		})
+
+		var statusErr httpStatusError
+		if !xerrors.As(err, &statusErr) || statusErr.statusCode != http.StatusTooManyRequests {
+			if err != nil {
+				return err
+			} else if out == nil || len(rawResponse) == 0 {
+				return nil
+			} else if decodeErr := json.Unmarshal(rawResponse, out); decodeErr != nil {
+				return xerrors.Errorf("could not decode response: %w", decodeErr)
+			}
+
+			return nil
+		}
+
+		wait, haveWait := rateLimitWait(statusErr.header, time.Now())
+		if !haveWait {
+			wait = time.Minute
+		}
+
+		if rateLimitWaited+wait > maxRESTRateLimitWait {
+			return xerrors.Errorf("rate limited for longer than %s: %w", maxRESTRateLimitWait, err)
+		}
+
+		err = sleep(client.ctx, wait)
+		if err != nil {
+			return xerrors.Errorf("could not wait for rate limit to reset: %w", err)
+		}
+
+		rateLimitWaited += wait
+	}
+}
+
+// doOnce makes a single request with the given method to the given path, with the given raw JSON body, and returns the
+// raw response body.
+func (client restClient) doOnce(method, path string, rawBody []byte) ([]byte, error) {
+	var bodyReader io.Reader
+	if rawBody != nil {
+		bodyReader = bytes.NewReader(rawBody)
+	}
+
+	req, err := http.NewRequest(method, client.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, xerrors.Errorf("could not build request: %w", err)
+	}
+
+	req = req.WithContext(client.ctx)
+	for key, values := range client.header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if rawBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	return readResponse(res)
+}
+
+// readResponse reads the body of the given response. If the response has an unsuccessful status code, an
+// httpStatusError is returned.
+func readResponse(res *http.Response) ([]byte, error) {
+	rawResponse, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("could not read response: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		errorBody := rawResponse
+		if len(errorBody) > maxErrorBodySize {
+			errorBody = errorBody[:maxErrorBodySize]
+		}
+
+		return nil, httpStatusError{
+			statusCode: res.StatusCode,
+			header:     res.Header,
+			body:       string(bytes.TrimSpace(errorBody)),
+		}
+	}
+
+	return rawResponse, nil
+}
+
+// httpStatusCode gets the HTTP status code of the unsuccessful response that caused the given error. If the error was
+// not caused by an unsuccessful response, zero is returned.
+func httpStatusCode(err error) int {
+	var statusErr httpStatusError
+	if !xerrors.As(err, &statusErr) {
+		return 0
+	}
+
+	return statusErr.statusCode
+}
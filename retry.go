@@ -0,0 +1,150 @@
+package pinamicdns
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"golang.org/x/xerrors"
+)
+
+// DefaultRetryPolicy is the RetryPolicy that setters will use if none is specified.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+var (
+	jitterRandLock sync.Mutex
+	jitterRand     = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// RetryPolicy describes how calls to a provider's API should be retried when they fail for transient reasons, such as
+// timeouts or server errors. Between attempts, the policy waits an exponentially increasing, jittered amount of time.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a call will be attempted. Values less than one are treated as one.
+	MaxAttempts int
+	// InitialBackoff is the amount of time to wait after the first failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum amount of time to wait between any two attempts.
+	MaxBackoff time.Duration
+	// MaxElapsed, if given, is the longest that a call may go on for, across all of its attempts. No attempt is made
+	// once waiting for it would take the call past this.
+	MaxElapsed time.Duration
+}
+
+// run calls fn until it succeeds, it returns an error that is not transient, or the policy's attempts or time are
+// exhausted. The last error returned by fn is returned.
+func (policy RetryPolicy) run(ctx context.Context, fn func() error) error {
+	return policy.runWhile(ctx, fn, isTransientError)
+}
+
+// runUnapplied calls fn in the same manner as run, except that it is only called again if it fails in a way that shows
+// its call was never applied. This is safe for calls that must not be applied twice, such as those that create records,
+// which may have been applied by a provider even if it timed out or dropped the connection before it responded.
+func (policy RetryPolicy) runUnapplied(ctx context.Context, fn func() error) error {
+	return policy.runWhile(ctx, fn, isUnappliedError)
+}
+
+// runWhile calls fn until it succeeds, it returns an error for which retryable is false, or the policy's attempts or
+// time are exhausted. The last error returned by fn is returned.
+func (policy RetryPolicy) runWhile(ctx context.Context, fn func() error, retryable func(error) bool) error {
+	start := time.Now()
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		wait := jitter(backoff)
+		if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+			return err
+		}
+
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			return err
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// isTransientError determines whether or not the given error is the result of an issue that may resolve itself if the
+// call is retried, such as a network error or a server error.
+func isTransientError(err error) bool {
+	var errResponse *godo.ErrorResponse
+	if xerrors.As(err, &errResponse) {
+		return errResponse.Response != nil && errResponse.Response.StatusCode >= 500
+	}
+
+	var statusErr httpStatusError
+	if xerrors.As(err, &statusErr) {
+		return statusErr.statusCode >= 500
+	}
+
+	var exitErr execExitError
+	if xerrors.As(err, &exitErr) {
+		return exitErr.exitCode == ExecTempFailExitCode
+	}
+
+	var netErr net.Error
+
+	return xerrors.As(err, &netErr)
+}
+
+// isUnappliedError determines whether or not the given error shows that the call was never applied, as the provider said
+// it was unavailable, or the request could not be sent at all. Rate limiting is not included, as callers wait for the
+// limit to reset instead.
+func isUnappliedError(err error) bool {
+	var errResponse *godo.ErrorResponse
+	if xerrors.As(err, &errResponse) {
+		return errResponse.Response != nil && errResponse.Response.StatusCode == http.StatusServiceUnavailable
+	}
+
+	var statusErr httpStatusError
+	if xerrors.As(err, &statusErr) {
+		return statusErr.statusCode == http.StatusServiceUnavailable
+	}
+
+	// If the provider's address could not be found, or it refused the connection, no request was made.
+	var dnsErr *net.DNSError
+
+	return xerrors.As(err, &dnsErr) || xerrors.Is(err, syscall.ECONNREFUSED)
+}
+
+// jitter returns a random duration between half of the given duration and the full duration.
+func jitter(duration time.Duration) time.Duration {
+	halfDuration := int64(duration / 2)
+	if halfDuration <= 0 {
+		return duration
+	}
+
+	jitterRandLock.Lock()
+	defer jitterRandLock.Unlock()
+
+	return time.Duration(halfDuration + jitterRand.Int63n(halfDuration))
+}
+
+// sleep waits for the given duration, or until the context is done. If the context finishes first, its error is
+// returned.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,252 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/xerrors"
+)
+
+// DefaultRFC2136Timeout is how long an RFC2136IPSetter waits for the nameserver to respond to an update, if no other
+// timeout is given.
+const DefaultRFC2136Timeout = 10 * time.Second
+
+// rfc2136TSIGFudge is the number of seconds that the time in an update's TSIG signature may differ from the
+// nameserver's clock.
+const rfc2136TSIGFudge = 300
+
+// rfc2136TSIGAlgorithms are the TSIG algorithms that updates may be signed with.
+var rfc2136TSIGAlgorithms = []string{dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512}
+
+func init() {
+	Register("rfc2136", newRFC2136IPSetterFromConfig)
+}
+
+// RFC2136IPSetter is an IPSetter that will update records by sending RFC 2136 dynamic updates to a primary nameserver,
+// such as BIND, Knot, or PowerDNS. Each update replaces all of the A or AAAA records for the name, so the records are
+// always consolidated into one.
+type RFC2136IPSetter struct {
+	server      string
+	zone        string
+	recordTTL   int
+	tsigKey     *rfc2136TSIGKey
+	timeout     time.Duration
+	retryPolicy RetryPolicy
+}
+
+// rfc2136TSIGKey is a key used to sign dynamic updates.
+type rfc2136TSIGKey struct {
+	name      string
+	algorithm string
+	secret    string
+}
+
+// RFC2136Zone should be passed to NewRFC2136IPSetter if the zone that is updated is not the domain passed to SetIP,
+// such as when the domain is delegated from a zone further up.
+func RFC2136Zone(zone string) func(*RFC2136IPSetter) error {
+	return func(setter *RFC2136IPSetter) error {
+		setter.zone = zone
+		return nil
+	}
+}
+
+// RFC2136RecordTTL should be passed to NewRFC2136IPSetter if a TTL is desired for the records it sets.
+func RFC2136RecordTTL(ttl int) func(*RFC2136IPSetter) error {
+	return func(setter *RFC2136IPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// RFC2136TSIGKey should be passed to NewRFC2136IPSetter to sign updates with the given TSIG key. The algorithm is
+// given in the form nsupdate uses, such as "hmac-sha256", and the secret is base64 encoded.
+func RFC2136TSIGKey(name, algorithm, secret string) func(*RFC2136IPSetter) error {
+	return func(setter *RFC2136IPSetter) error {
+		algorithm = dns.Fqdn(strings.ToLower(algorithm))
+		if !isRFC2136TSIGAlgorithm(algorithm) {
+			return xerrors.Errorf("unsupported TSIG algorithm %s", algorithm)
+		} else if name == "" || secret == "" {
+			return xerrors.New("TSIG key name and secret must be given")
+		}
+
+		setter.tsigKey = &rfc2136TSIGKey{
+			name:      dns.Fqdn(strings.ToLower(name)),
+			algorithm: algorithm,
+			secret:    secret,
+		}
+
+		return nil
+	}
+}
+
+// RFC2136Timeout should be passed to NewRFC2136IPSetter to control how long to wait for the nameserver to respond to
+// an update. If not given, DefaultRFC2136Timeout is used.
+func RFC2136Timeout(timeout time.Duration) func(*RFC2136IPSetter) error {
+	return func(setter *RFC2136IPSetter) error {
+		if timeout <= 0 {
+			return xerrors.New("timeout must be positive")
+		}
+
+		setter.timeout = timeout
+		return nil
+	}
+}
+
+// RFC2136RetryPolicy should be passed to NewRFC2136IPSetter to control how updates are retried when they fail for
+// transient reasons. If not given, DefaultRetryPolicy is used.
+func RFC2136RetryPolicy(policy RetryPolicy) func(*RFC2136IPSetter) error {
+	return func(setter *RFC2136IPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// NewRFC2136IPSetter makes a new RFC 2136 IPSetter, which will send updates to the given primary nameserver. If the
+// server has no port, port 53 is used.
+func NewRFC2136IPSetter(server string, options ...func(*RFC2136IPSetter) error) (RFC2136IPSetter, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	setter := RFC2136IPSetter{
+		server:      server,
+		timeout:     DefaultRFC2136Timeout,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return RFC2136IPSetter{}, xerrors.Errorf("could not construct RFC2136IPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, by sending a dynamic update to the setter's
+// nameserver.
+func (setter RFC2136IPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter RFC2136IPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	zone := setter.zone
+	if zone == "" {
+		zone = domain
+	}
+
+	header := dns.RR_Header{
+		Name:   dns.Fqdn(fqdn(domain, name)),
+		Rrtype: dns.TypeA,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(setter.recordTTL),
+	}
+
+	var rrset, record dns.RR
+	if ipRecordType(ip) == AAAARecordType {
+		header.Rrtype = dns.TypeAAAA
+		rrset, record = &dns.AAAA{Hdr: header}, &dns.AAAA{Hdr: header, AAAA: ip}
+	} else {
+		rrset, record = &dns.A{Hdr: header}, &dns.A{Hdr: header, A: ip.To4()}
+	}
+
+	update := &dns.Msg{}
+	update.SetUpdate(dns.Fqdn(zone))
+	update.RemoveRRset([]dns.RR{rrset})
+	update.Insert([]dns.RR{record})
+
+	err := setter.retryPolicy.run(ctx, func() error {
+		return setter.sendUpdate(ctx, update)
+	})
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// sendUpdate sends the given update to the setter's nameserver, signing it if the setter has a TSIG key. The update
+// itself is left as it was, so that it can be sent again: a message may only hold a single TSIG record, so each attempt
+// must sign a copy of its own.
+func (setter RFC2136IPSetter) sendUpdate(ctx context.Context, update *dns.Msg) error {
+	client := dns.Client{Timeout: setter.timeout}
+	update = update.Copy()
+	if setter.tsigKey != nil {
+		client.TsigSecret = map[string]string{setter.tsigKey.name: setter.tsigKey.secret}
+		update.SetTsig(setter.tsigKey.name, setter.tsigKey.algorithm, rfc2136TSIGFudge, time.Now().Unix())
+	}
+
+	response, _, err := client.ExchangeContext(ctx, update, setter.server)
+	if err != nil {
+		return xerrors.Errorf("could not send update to %s: %w", setter.server, err)
+	} else if response.Rcode != dns.RcodeSuccess {
+		return xerrors.Errorf("%s refused update: %s", setter.server, dns.RcodeToString[response.Rcode])
+	}
+
+	return nil
+}
+
+// isRFC2136TSIGAlgorithm checks whether or not the given TSIG algorithm may be used to sign updates.
+func isRFC2136TSIGAlgorithm(algorithm string) bool {
+	for _, knownAlgorithm := range rfc2136TSIGAlgorithms {
+		if algorithm == knownAlgorithm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rfc2136Config represents the JSON config of an RFC2136IPSetter, for use with NewSetterFromConfig.
+type rfc2136Config struct {
+	Server        string   `json:"server"`
+	Zone          string   `json:"zone"`
+	TSIGKeyName   string   `json:"tsig_key_name"`
+	TSIGAlgorithm string   `json:"tsig_algorithm"`
+	TSIGSecret    string   `json:"tsig_secret"`
+	Timeout       Duration `json:"timeout"`
+}
+
+// newRFC2136IPSetterFromConfig makes an RFC2136IPSetter from the given JSON config and shared settings. If a TSIG key
+// is given without an algorithm, hmac-sha256 is used.
+func newRFC2136IPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := rfc2136Config{TSIGAlgorithm: dns.HmacSHA256}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.Server == "" {
+		return nil, xerrors.New("server must be given")
+	} else if options.RecordTTL == 0 {
+		return nil, xerrors.New("a record TTL must be given")
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*RFC2136IPSetter) error{
+		RFC2136Zone(config.Zone),
+		RFC2136RecordTTL(options.RecordTTL),
+		RFC2136RetryPolicy(options.retryPolicy()),
+	}
+	if config.TSIGKeyName != "" || config.TSIGSecret != "" {
+		setterOptions = append(setterOptions, RFC2136TSIGKey(config.TSIGKeyName, config.TSIGAlgorithm, config.TSIGSecret))
+	}
+	if config.Timeout != 0 {
+		setterOptions = append(setterOptions, RFC2136Timeout(time.Duration(config.Timeout)))
+	}
+
+	return NewRFC2136IPSetter(config.Server, setterOptions...)
+}
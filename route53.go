@@ -0,0 +1,251 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"golang.org/x/xerrors"
+)
+
+// defaultRoute53RecordTTL is the TTL that will be used for records if none is given, as Route53 requires one.
+const defaultRoute53RecordTTL = 300
+
+func init() {
+	Register("route53", newRoute53IPSetterFromConfig)
+}
+
+// Route53IPSetter is an IPSetter that will update records in an AWS Route53 hosted zone. Credentials are taken from
+// the standard AWS credential chain (environment variables, shared config and credentials files, and instance roles).
+type Route53IPSetter struct {
+	client       *route53.Route53
+	hostedZoneID string
+	recordTTL    int
+	httpConfig   HTTPConfig
+	retryPolicy  RetryPolicy
+}
+
+// Route53HostedZoneID should be passed to NewRoute53IPSetter if the ID of the hosted zone that records should be set in
+// is known. If not given, the hosted zone is found by the domain name passed to SetIP.
+func Route53HostedZoneID(hostedZoneID string) func(*Route53IPSetter) error {
+	return func(setter *Route53IPSetter) error {
+		setter.hostedZoneID = hostedZoneID
+		return nil
+	}
+}
+
+// Route53RecordTTL should be passed to NewRoute53IPSetter if a TTL is desired for the records it sets.
+func Route53RecordTTL(ttl int) func(*Route53IPSetter) error {
+	return func(setter *Route53IPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// Route53HTTPConfig should be passed to NewRoute53IPSetter to control how the HTTP client that talks to the Route53
+// API is constructed, such as its timeouts.
+func Route53HTTPConfig(config HTTPConfig) func(*Route53IPSetter) error {
+	return func(setter *Route53IPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// Route53RetryPolicy should be passed to NewRoute53IPSetter to control how many times calls to the Route53 API are
+// attempted. The AWS SDK performs its own backoff, so only the policy's MaxAttempts is used.
+func Route53RetryPolicy(policy RetryPolicy) func(*Route53IPSetter) error {
+	return func(setter *Route53IPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// NewRoute53IPSetter makes a new Route53 IPSetter
+func NewRoute53IPSetter(options ...func(*Route53IPSetter) error) (Route53IPSetter, error) {
+	setter := Route53IPSetter{
+		recordTTL:   defaultRoute53RecordTTL,
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return Route53IPSetter{}, xerrors.Errorf("could not construct Route53IPSetter: %w", err)
+		}
+	}
+
+	maxRetries := setter.retryPolicy.MaxAttempts - 1
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	awsSession, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			HTTPClient: setter.httpConfig.Client(),
+			MaxRetries: aws.Int(maxRetries),
+		},
+	})
+	if err != nil {
+		return Route53IPSetter{}, xerrors.Errorf("could not construct Route53IPSetter: could not load AWS config: %w", err)
+	}
+
+	setter.client = route53.New(awsSession)
+
+	return setter, nil
+}
+
+// getHostedZoneID gets the ID of the hosted zone that records for the given domain should be set in. If the setter was
+// not given a hosted zone ID, the public hosted zone with the domain's name is used.
+func (setter Route53IPSetter) getHostedZoneID(ctx context.Context, domain string) (string, error) {
+	if setter.hostedZoneID != "" {
+		return setter.hostedZoneID, nil
+	}
+
+	zoneName := canonicalDomain(domain)
+	output, err := setter.client.ListHostedZonesByNameWithContext(ctx, &route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(zoneName),
+	})
+	if err != nil {
+		return "", xerrors.Errorf("could not ask Route53 API for hosted zones: %w", err)
+	}
+
+	for _, zone := range output.HostedZones {
+		isPrivate := zone.Config != nil && aws.BoolValue(zone.Config.PrivateZone)
+		if aws.StringValue(zone.Name) == zoneName && !isPrivate {
+			return aws.StringValue(zone.Id), nil
+		}
+	}
+
+	return "", xerrors.Errorf("no public Route53 hosted zone exists for domain %s", domain)
+}
+
+// recordUpToDate checks whether or not the given hosted zone already has a record set of the type for the given IP
+// with the given name that holds only the given IP with the setter's TTL.
+func (setter Route53IPSetter) recordUpToDate(ctx context.Context, hostedZoneID, name string, ip net.IP) (bool, error) {
+	output, err := setter.client.ListResourceRecordSetsWithContext(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: aws.String(ipRecordType(ip)),
+		MaxItems:        aws.String("1"),
+	})
+	if err != nil {
+		return false, xerrors.Errorf("could not ask Route53 API for records: %w", err)
+	}
+
+	// Listing starts at the given name, but the record set that is returned may belong to a later name if ours
+	// does not exist.
+	if len(output.ResourceRecordSets) == 0 {
+		return false, nil
+	}
+
+	recordSet := output.ResourceRecordSets[0]
+	if unescapeRoute53Name(aws.StringValue(recordSet.Name)) != name || aws.StringValue(recordSet.Type) != ipRecordType(ip) {
+		return false, nil
+	} else if aws.Int64Value(recordSet.TTL) != int64(setter.recordTTL) || len(recordSet.ResourceRecords) != 1 {
+		return false, nil
+	}
+
+	return aws.StringValue(recordSet.ResourceRecords[0].Value) == ip.String(), nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, in the form of a DNS record in a Route53
+// hosted zone. Route53 holds all records with the same name and type in a single record set, which will be replaced
+// so that it holds only the given IP.
+func (setter Route53IPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter Route53IPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	hostedZoneID, err := setter.getHostedZoneID(ctx, domain)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	recordName := canonicalDomain(fqdn(domain, name))
+	upToDate, err := setter.recordUpToDate(ctx, hostedZoneID, recordName, ip)
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	} else if upToDate {
+		return nil
+	}
+
+	_, err = setter.client.ChangeResourceRecordSetsWithContext(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String("Updated by pinamic-dns"),
+			Changes: []*route53.Change{
+				{
+					Action: aws.String(route53.ChangeActionUpsert),
+					ResourceRecordSet: &route53.ResourceRecordSet{
+						Name: aws.String(recordName),
+						Type: aws.String(ipRecordType(ip)),
+						TTL:  aws.Int64(int64(setter.recordTTL)),
+						ResourceRecords: []*route53.ResourceRecord{
+							{Value: aws.String(ip.String())},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: could not change Route53 record set: %w", err)
+	}
+
+	return nil
+}
+
+// unescapeRoute53Name converts a record name returned by Route53 into the form it was given in. Route53 returns the
+// asterisk of a wildcard name in its octal escaped form.
+func unescapeRoute53Name(name string) string {
+	return strings.Replace(name, `\052`, "*", -1)
+}
+
+// canonicalDomain gets the given domain name in the fully qualified form that Route53 uses, with a trailing dot.
+func canonicalDomain(domain string) string {
+	return strings.TrimSuffix(domain, ".") + "."
+}
+
+// route53Config represents the JSON config of a Route53IPSetter, for use with NewSetterFromConfig. Credentials are taken
+// from the standard AWS credential chain, rather than the config.
+type route53Config struct {
+	HostedZoneID string `json:"hosted_zone_id"`
+}
+
+// newRoute53IPSetterFromConfig makes a Route53IPSetter from the given JSON config and shared settings.
+func newRoute53IPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := route53Config{}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*Route53IPSetter) error{
+		Route53HostedZoneID(config.HostedZoneID),
+		Route53HTTPConfig(options.HTTPConfig),
+		Route53RetryPolicy(options.retryPolicy()),
+	}
+
+	// Without a TTL of its own, the record is given defaultRoute53RecordTTL, rather than a TTL of zero.
+	if options.RecordTTL != 0 {
+		setterOptions = append(setterOptions, Route53RecordTTL(options.RecordTTL))
+	}
+
+	return NewRoute53IPSetter(setterOptions...)
+}
@@ -0,0 +1,398 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultFritzBoxHost is the host that a FritzBoxIPSource asks, if no other is given. FRITZ!Boxes resolve this name to
+// themselves for any device on their network.
+const DefaultFritzBoxHost = "fritz.box"
+
+// maxRouterResponseSize is the most of a response from a router that will be read.
+const maxRouterResponseSize = 64 * 1024
+
+// fritzBoxUPnPPort is the port that FRITZ!Boxes serve UPnP IGD requests on.
+const fritzBoxUPnPPort = "49000"
+
+// fritzBoxControlPath is the path of the WANIPConnection service on a FRITZ!Box.
+const fritzBoxControlPath = "/igdupnp/control/WANIPConn1"
+
+// fritzBoxService is the UPnP service type of the WANIPConnection service.
+const fritzBoxService = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+// Actions of the WANIPConnection service that get the external address
+const (
+	fritzBoxIPv4Action = "GetExternalIPAddress"
+	fritzBoxIPv6Action = "X_AVM_DE_GetExternalIPv6Address"
+)
+
+// fritzBoxRequestTemplate is the SOAP request that calls an action of the WANIPConnection service, with the action and
+// service to be filled in.
+const fritzBoxRequestTemplate = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<s:Envelope s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" ` +
+	`xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">` +
+	`<s:Body><u:%s xmlns:u="%s"/></s:Body>` +
+	`</s:Envelope>`
+
+// Interfaces that an OpenWrtIPSource reads addresses from, if no other is given
+const (
+	DefaultOpenWrtInterface     = "wan"
+	DefaultOpenWrtIPv6Interface = "wan6"
+)
+
+// openWrtAnonymousSession is the ubus session ID used to log in.
+const openWrtAnonymousSession = "00000000000000000000000000000000"
+
+// FritzBoxIPSource is an IPSource that asks a FRITZ!Box router for its external address, using the UPnP IGD service
+// it serves to its local network. Detecting from the router means that the correct address is found even if this
+// machine has several routes to the Internet.
+type FritzBoxIPSource struct {
+	controlURL string
+	ipv6       bool
+	httpConfig HTTPConfig
+}
+
+// fritzBoxResponse is the SOAP response to a WANIPConnection action that gets the external address.
+type fritzBoxResponse struct {
+	Body struct {
+		Response struct {
+			IP   string `xml:"NewExternalIPAddress"`
+			IPv6 string `xml:"NewExternalIPv6Address"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// OpenWrtIPSource is an IPSource that asks an OpenWrt router for the address of its WAN interface, using the ubus
+// JSON-RPC API that it serves to LuCI. The user that it logs in as must be allowed to call network.interface's status
+// method. Detecting from the router means that the correct address is found even if this machine has several routes to
+// the Internet.
+type OpenWrtIPSource struct {
+	url           string
+	username      string
+	password      string
+	interfaceName string
+	ipv6          bool
+	httpConfig    HTTPConfig
+}
+
+// openWrtRPCRequest is a JSON-RPC request to call a ubus method.
+type openWrtRPCRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// openWrtRPCResponse is a JSON-RPC response to a ubus method call. The result holds the ubus status code, followed by
+// the data that the method returned, if it succeeded.
+type openWrtRPCResponse struct {
+	Result []json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// openWrtLoginData is the data returned by ubus's session login method.
+type openWrtLoginData struct {
+	Session string `json:"ubus_rpc_session"`
+}
+
+// openWrtInterfaceStatus is the data returned by a network interface's ubus status method.
+type openWrtInterfaceStatus struct {
+	IPv4Addresses []openWrtInterfaceAddress `json:"ipv4-address"`
+	IPv6Addresses []openWrtInterfaceAddress `json:"ipv6-address"`
+}
+
+// openWrtInterfaceAddress is an address of an OpenWrt network interface.
+type openWrtInterfaceAddress struct {
+	Address string `json:"address"`
+}
+
+// FritzBoxHost should be passed to NewFritzBoxIPSource to ask the FRITZ!Box with the given host name or address. If
+// not given, DefaultFritzBoxHost is used.
+func FritzBoxHost(host string) func(*FritzBoxIPSource) error {
+	return func(source *FritzBoxIPSource) error {
+		if host == "" {
+			return xerrors.New("host must not be empty")
+		}
+
+		source.controlURL = fritzBoxControlURL(host)
+		return nil
+	}
+}
+
+// FritzBoxIPv6 should be passed to NewFritzBoxIPSource to ask for the FRITZ!Box's external IPv6 address, rather than
+// its IPv4 address.
+func FritzBoxIPv6() func(*FritzBoxIPSource) error {
+	return func(source *FritzBoxIPSource) error {
+		source.ipv6 = true
+		return nil
+	}
+}
+
+// FritzBoxHTTPConfig should be passed to NewFritzBoxIPSource to control how the HTTP client that asks for the address
+// is constructed.
+func FritzBoxHTTPConfig(config HTTPConfig) func(*FritzBoxIPSource) error {
+	return func(source *FritzBoxIPSource) error {
+		source.httpConfig = config
+		return nil
+	}
+}
+
+// NewFritzBoxIPSource makes a new FritzBoxIPSource.
+func NewFritzBoxIPSource(options ...func(*FritzBoxIPSource) error) (FritzBoxIPSource, error) {
+	source := FritzBoxIPSource{controlURL: fritzBoxControlURL(DefaultFritzBoxHost)}
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return FritzBoxIPSource{}, xerrors.Errorf("could not construct FritzBoxIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets the current external IP address of the source's FRITZ!Box.
+func (source FritzBoxIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source FritzBoxIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	action := fritzBoxIPv4Action
+	if source.ipv6 {
+		action = fritzBoxIPv6Action
+	}
+
+	body := fmt.Sprintf(fritzBoxRequestTemplate, action, fritzBoxService)
+	req, err := http.NewRequest(http.MethodPost, source.controlURL, strings.NewReader(body))
+	if err != nil {
+		return nil, xerrors.Errorf("could not make request to FRITZ!Box: %w", err)
+	}
+
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, fritzBoxService, action))
+
+	res, err := source.httpConfig.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, xerrors.Errorf("could not ask FRITZ!Box at %s for its address: %w", source.controlURL, err)
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, xerrors.Errorf(
+			"could not ask FRITZ!Box at %s for its address: got status %s",
+			source.controlURL,
+			res.Status,
+		)
+	}
+
+	response := fritzBoxResponse{}
+	err = xml.NewDecoder(io.LimitReader(res.Body, maxRouterResponseSize)).Decode(&response)
+	if err != nil {
+		return nil, xerrors.Errorf("could not read response from FRITZ!Box: %w", err)
+	}
+
+	rawIP := response.Body.Response.IP
+	if source.ipv6 {
+		rawIP = response.Body.Response.IPv6
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(rawIP))
+	if ip == nil || ip.IsUnspecified() {
+		// FRITZ!Boxes report an address of 0.0.0.0 or an empty address while they are not connected.
+		return nil, xerrors.Errorf("FRITZ!Box at %s has no external address", source.controlURL)
+	}
+
+	return ip, nil
+}
+
+// fritzBoxControlURL gets the URL of the WANIPConnection service of the FRITZ!Box with the given host.
+func fritzBoxControlURL(host string) string {
+	controlURL := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, fritzBoxUPnPPort),
+		Path:   fritzBoxControlPath,
+	}
+
+	return controlURL.String()
+}
+
+// OpenWrtInterface should be passed to NewOpenWrtIPSource to read the address of the OpenWrt network interface with
+// the given name, such as wan. If not given, DefaultOpenWrtInterface is used, or DefaultOpenWrtIPv6Interface to read
+// an IPv6 address.
+func OpenWrtInterface(interfaceName string) func(*OpenWrtIPSource) error {
+	return func(source *OpenWrtIPSource) error {
+		if interfaceName == "" {
+			return xerrors.New("interface name must not be empty")
+		}
+
+		source.interfaceName = interfaceName
+		return nil
+	}
+}
+
+// OpenWrtIPv6 should be passed to NewOpenWrtIPSource to read an IPv6 address of the interface, rather than an IPv4
+// address.
+func OpenWrtIPv6() func(*OpenWrtIPSource) error {
+	return func(source *OpenWrtIPSource) error {
+		source.ipv6 = true
+		return nil
+	}
+}
+
+// OpenWrtHTTPConfig should be passed to NewOpenWrtIPSource to control how the HTTP client that asks for the address is
+// constructed.
+func OpenWrtHTTPConfig(config HTTPConfig) func(*OpenWrtIPSource) error {
+	return func(source *OpenWrtIPSource) error {
+		source.httpConfig = config
+		return nil
+	}
+}
+
+// NewOpenWrtIPSource makes a new OpenWrtIPSource, which will call the ubus API at the given URL, such as
+// http://192.168.1.1/ubus, logging in with the given username and password.
+func NewOpenWrtIPSource(rawURL, username, password string, options ...func(*OpenWrtIPSource) error) (OpenWrtIPSource, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return OpenWrtIPSource{}, xerrors.Errorf("could not construct OpenWrtIPSource: invalid URL: %w", err)
+	} else if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return OpenWrtIPSource{}, xerrors.New("could not construct OpenWrtIPSource: URL must be http or https")
+	} else if username == "" {
+		return OpenWrtIPSource{}, xerrors.New("could not construct OpenWrtIPSource: username must be given")
+	}
+
+	source := OpenWrtIPSource{
+		url:      rawURL,
+		username: username,
+		password: password,
+	}
+
+	for _, option := range options {
+		err = option(&source)
+		if err != nil {
+			return OpenWrtIPSource{}, xerrors.Errorf("could not construct OpenWrtIPSource: %w", err)
+		}
+	}
+
+	if source.interfaceName == "" && source.ipv6 {
+		source.interfaceName = DefaultOpenWrtIPv6Interface
+	} else if source.interfaceName == "" {
+		source.interfaceName = DefaultOpenWrtInterface
+	}
+
+	return source, nil
+}
+
+// IP gets the current address of the source's interface on the OpenWrt router. If the interface has several, the first
+// is used.
+func (source OpenWrtIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source OpenWrtIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	client := source.httpConfig.Client()
+	loginData := openWrtLoginData{}
+	err := source.call(
+		ctx,
+		client,
+		openWrtAnonymousSession,
+		"session",
+		"login",
+		map[string]string{"username": source.username, "password": source.password},
+		&loginData,
+	)
+	if err != nil {
+		return nil, xerrors.Errorf("could not log in to OpenWrt at %s: %w", source.url, err)
+	}
+
+	status := openWrtInterfaceStatus{}
+	err = source.call(ctx, client, loginData.Session, "network.interface."+source.interfaceName, "status", struct{}{}, &status)
+	if err != nil {
+		return nil, xerrors.Errorf("could not get status of OpenWrt interface %s: %w", source.interfaceName, err)
+	}
+
+	addresses := status.IPv4Addresses
+	if source.ipv6 {
+		addresses = status.IPv6Addresses
+	}
+
+	for _, address := range addresses {
+		ip := net.ParseIP(address.Address)
+		if ip != nil {
+			return ip, nil
+		}
+	}
+
+	return nil, xerrors.Errorf("OpenWrt interface %s has no address", source.interfaceName)
+}
+
+// call calls the given ubus method of the given object with the given session, decoding the data it returns into
+// result.
+func (source OpenWrtIPSource) call(ctx context.Context, client *http.Client, session, object, method string, args, result interface{}) error {
+	rawRequest, err := json.Marshal(openWrtRPCRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "call",
+		Params:  []interface{}{session, object, method, args},
+	})
+	if err != nil {
+		return xerrors.Errorf("could not encode request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, source.url, bytes.NewReader(rawRequest))
+	if err != nil {
+		return xerrors.Errorf("could not make request to call %s %s: %w", object, method, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return xerrors.Errorf("could not call %s %s: %w", object, method, err)
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return xerrors.Errorf("could not call %s %s: got status %s", object, method, res.Status)
+	}
+
+	response := openWrtRPCResponse{}
+	err = json.NewDecoder(io.LimitReader(res.Body, maxRouterResponseSize)).Decode(&response)
+	if err != nil {
+		return xerrors.Errorf("invalid response to %s %s: %w", object, method, err)
+	} else if response.Error != nil {
+		return xerrors.Errorf("%s %s failed: %s", object, method, response.Error.Message)
+	} else if len(response.Result) == 0 {
+		return xerrors.Errorf("invalid response to %s %s: no result", object, method)
+	}
+
+	statusCode := 0
+	err = json.Unmarshal(response.Result[0], &statusCode)
+	if err != nil {
+		return xerrors.Errorf("invalid response to %s %s: %w", object, method, err)
+	} else if statusCode != 0 {
+		// Most often, this is 6, which means that the user is not allowed to call the method.
+		return xerrors.Errorf("%s %s failed with ubus status %d", object, method, statusCode)
+	} else if len(response.Result) < 2 {
+		return xerrors.Errorf("invalid response to %s %s: no data", object, method)
+	}
+
+	err = json.Unmarshal(response.Result[1], result)
+	if err != nil {
+		return xerrors.Errorf("invalid response to %s %s: %w", object, method, err)
+	}
+
+	return nil
+}
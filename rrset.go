@@ -0,0 +1,49 @@
+package pinamicdns
+
+// desiredRRSetValues gets the values that an rrset with the given existing values should have in order to hold the
+// given value, in correspondence with the given DuplicateRecordPolicy. Because an rrset holds every record with a name
+// and type at once, UpdateAllDuplicates and ConsolidateDuplicates both leave only the given value.
+func desiredRRSetValues(existingValues []string, value string, policy DuplicateRecordPolicy) []string {
+	if len(existingValues) == 0 || policy != UpdateFirstDuplicate {
+		return []string{value}
+	}
+
+	// As with other providers, the first value that differs is replaced. The set can't hold the same value twice, so
+	// the new value must be included only once.
+	desiredValues := make([]string, 0, len(existingValues))
+	replaced := false
+	haveValue := false
+	for _, existingValue := range existingValues {
+		if existingValue != value && !replaced {
+			existingValue = value
+			replaced = true
+		}
+
+		if existingValue == value {
+			if haveValue {
+				continue
+			}
+
+			haveValue = true
+		}
+
+		desiredValues = append(desiredValues, existingValue)
+	}
+
+	return desiredValues
+}
+
+// rrsetValuesEqual checks whether or not the given sets of rrset values are the same, in the same order.
+func rrsetValuesEqual(values, otherValues []string) bool {
+	if len(values) != len(otherValues) {
+		return false
+	}
+
+	for i, value := range values {
+		if otherValues[i] != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,60 @@
+package pinamicdns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDesiredRRSetValues(t *testing.T) {
+	tests := []struct {
+		name           string
+		existingValues []string
+		policy         DuplicateRecordPolicy
+		want           []string
+	}{
+		{
+			name:   "an empty rrset gets the value",
+			policy: UpdateFirstDuplicate,
+			want:   []string{"203.0.113.1"},
+		},
+		{
+			name:           "update first replaces the first other value",
+			existingValues: []string{"198.51.100.1", "198.51.100.2"},
+			policy:         UpdateFirstDuplicate,
+			want:           []string{"203.0.113.1", "198.51.100.2"},
+		},
+		{
+			name:           "update first replaces another value even if the set holds the value",
+			existingValues: []string{"203.0.113.1", "198.51.100.2", "198.51.100.3"},
+			policy:         UpdateFirstDuplicate,
+			want:           []string{"203.0.113.1", "198.51.100.3"},
+		},
+		{
+			name:           "update first does not hold the value twice",
+			existingValues: []string{"198.51.100.1", "203.0.113.1"},
+			policy:         UpdateFirstDuplicate,
+			want:           []string{"203.0.113.1"},
+		},
+		{
+			name:           "update all leaves only the value",
+			existingValues: []string{"198.51.100.1", "198.51.100.2"},
+			policy:         UpdateAllDuplicates,
+			want:           []string{"203.0.113.1"},
+		},
+		{
+			name:           "consolidate leaves only the value",
+			existingValues: []string{"198.51.100.1", "203.0.113.1"},
+			policy:         ConsolidateDuplicates,
+			want:           []string{"203.0.113.1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := desiredRRSetValues(test.existingValues, "203.0.113.1", test.policy)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package pinamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// DefaultTailscaleSocket is the path of the socket that tailscaled serves its local API on, if no other is given.
+const DefaultTailscaleSocket = "/var/run/tailscale/tailscaled.sock"
+
+// DefaultTailscaleTimeout is how long a TailscaleIPSource waits for tailscaled to respond, if no other timeout is given.
+const DefaultTailscaleTimeout = 5 * time.Second
+
+// tailscaleStatusURL is the URL of tailscaled's status endpoint. The host is never resolved, as requests are always made
+// over the socket, but tailscaled rejects requests with any other.
+const tailscaleStatusURL = "http://local-tailscaled.sock/localapi/v0/status?peers=false"
+
+// TailscaleIPSource is an IPSource that asks the local tailscaled for this node's Tailscale address, so that names can
+// be kept pointing at hosts on a tailnet. tailscaled's local API is only served over a Unix socket on Linux and the BSDs.
+type TailscaleIPSource struct {
+	socket  string
+	ipv6    bool
+	timeout time.Duration
+}
+
+// tailscaleStatus is the part of tailscaled's status that TailscaleIPSource reads.
+type tailscaleStatus struct {
+	BackendState string `json:"BackendState"`
+	Self         struct {
+		TailscaleIPs []string `json:"TailscaleIPs"`
+	} `json:"Self"`
+}
+
+// TailscaleSocket should be passed to NewTailscaleIPSource to control the path of the socket that tailscaled's local
+// API is served on. If not given, DefaultTailscaleSocket is used.
+func TailscaleSocket(socket string) func(*TailscaleIPSource) error {
+	return func(source *TailscaleIPSource) error {
+		if socket == "" {
+			return xerrors.New("socket must not be empty")
+		}
+
+		source.socket = socket
+		return nil
+	}
+}
+
+// TailscaleIPv6 should be passed to NewTailscaleIPSource to get the node's Tailscale IPv6 address, rather than its IPv4
+// address.
+func TailscaleIPv6() func(*TailscaleIPSource) error {
+	return func(source *TailscaleIPSource) error {
+		source.ipv6 = true
+		return nil
+	}
+}
+
+// TailscaleTimeout should be passed to NewTailscaleIPSource to control how long to wait for tailscaled to respond. If
+// not given, DefaultTailscaleTimeout is used.
+func TailscaleTimeout(timeout time.Duration) func(*TailscaleIPSource) error {
+	return func(source *TailscaleIPSource) error {
+		if timeout <= 0 {
+			return xerrors.New("timeout must be positive")
+		}
+
+		source.timeout = timeout
+		return nil
+	}
+}
+
+// NewTailscaleIPSource makes a new TailscaleIPSource.
+func NewTailscaleIPSource(options ...func(*TailscaleIPSource) error) (TailscaleIPSource, error) {
+	source := TailscaleIPSource{socket: DefaultTailscaleSocket, timeout: DefaultTailscaleTimeout}
+	for _, option := range options {
+		err := option(&source)
+		if err != nil {
+			return TailscaleIPSource{}, xerrors.Errorf("could not construct TailscaleIPSource: %w", err)
+		}
+	}
+
+	return source, nil
+}
+
+// IP gets this node's current Tailscale address from tailscaled.
+func (source TailscaleIPSource) IP() (net.IP, error) {
+	return source.IPContext(context.Background())
+}
+
+// IPContext gets the current public IP address in the same manner as IP, giving up once the given context is done.
+func (source TailscaleIPSource) IPContext(ctx context.Context) (net.IP, error) {
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", source.socket)
+			},
+		},
+		Timeout: source.timeout,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, tailscaleStatusURL, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("could not make request to tailscaled: %w", err)
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, xerrors.Errorf("could not get status from tailscaled at %s: %w", source.socket, err)
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("tailscaled returned status %s", res.Status)
+	}
+
+	status := tailscaleStatus{}
+	err = json.NewDecoder(io.LimitReader(res.Body, maxJSONIPResponseSize)).Decode(&status)
+	if err != nil {
+		return nil, xerrors.Errorf("could not decode status from tailscaled: %w", err)
+	}
+
+	for _, rawIP := range status.Self.TailscaleIPs {
+		ip := net.ParseIP(rawIP)
+		if ip != nil && (ip.To4() == nil) == source.ipv6 {
+			return ip, nil
+		}
+	}
+
+	return nil, xerrors.Errorf("tailscaled has no address for this node (backend state is %s)", status.BackendState)
+}
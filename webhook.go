@@ -0,0 +1,248 @@
+package pinamicdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	Register("webhook", newWebhookIPSetterFromConfig)
+}
+
+// WebhookIPSetter is an IPSetter that will send a templated HTTP request, so that records can be set with providers
+// and services that have no dedicated IPSetter. Templates use the syntax of text/template, and are given a
+// WebhookTemplateData.
+type WebhookIPSetter struct {
+	method          string
+	urlTemplate     *template.Template
+	headerTemplates map[string]*template.Template
+	bodyTemplate    *template.Template
+	recordTTL       int
+	httpConfig      HTTPConfig
+	retryPolicy     RetryPolicy
+}
+
+// WebhookTemplateData holds the values that may be used in the templates of a WebhookIPSetter.
+type WebhookTemplateData struct {
+	IP     string
+	Domain string
+	Name   string
+	TTL    int
+}
+
+// WebhookHeader should be passed to NewWebhookIPSetter to add a header with the given name to the request. The value of
+// the header is a template.
+func WebhookHeader(name, valueTemplate string) func(*WebhookIPSetter) error {
+	return func(setter *WebhookIPSetter) error {
+		parsedTemplate, err := template.New(name).Parse(valueTemplate)
+		if err != nil {
+			return xerrors.Errorf("invalid template for header %s: %w", name, err)
+		}
+
+		setter.headerTemplates[http.CanonicalHeaderKey(name)] = parsedTemplate
+		return nil
+	}
+}
+
+// WebhookBody should be passed to NewWebhookIPSetter to give the request a body, which is a template. If not given,
+// the request has no body.
+func WebhookBody(bodyTemplate string) func(*WebhookIPSetter) error {
+	return func(setter *WebhookIPSetter) error {
+		parsedTemplate, err := template.New("body").Parse(bodyTemplate)
+		if err != nil {
+			return xerrors.Errorf("invalid template for body: %w", err)
+		}
+
+		setter.bodyTemplate = parsedTemplate
+		return nil
+	}
+}
+
+// WebhookRecordTTL should be passed to NewWebhookIPSetter to make a TTL available to its templates.
+func WebhookRecordTTL(ttl int) func(*WebhookIPSetter) error {
+	return func(setter *WebhookIPSetter) error {
+		setter.recordTTL = ttl
+		return nil
+	}
+}
+
+// WebhookHTTPConfig should be passed to NewWebhookIPSetter to control how the HTTP client that sends the request is
+// constructed, such as its timeouts.
+func WebhookHTTPConfig(config HTTPConfig) func(*WebhookIPSetter) error {
+	return func(setter *WebhookIPSetter) error {
+		setter.httpConfig = config
+		return nil
+	}
+}
+
+// WebhookRetryPolicy should be passed to NewWebhookIPSetter to control how the request is retried when it fails for
+// transient reasons. If not given, DefaultRetryPolicy is used.
+func WebhookRetryPolicy(policy RetryPolicy) func(*WebhookIPSetter) error {
+	return func(setter *WebhookIPSetter) error {
+		setter.retryPolicy = policy
+		return nil
+	}
+}
+
+// NewWebhookIPSetter makes a new WebhookIPSetter, which will send a request with the given method to the URL produced
+// by the given template. Values placed in the URL should usually be escaped with urlquery, such as in
+// https://example.com/update?ip={{urlquery .IP}}. Any response with a 2xx status is considered a success.
+func NewWebhookIPSetter(method, urlTemplate string, options ...func(*WebhookIPSetter) error) (WebhookIPSetter, error) {
+	parsedURLTemplate, err := template.New("url").Parse(urlTemplate)
+	if err != nil {
+		return WebhookIPSetter{}, xerrors.Errorf("could not construct WebhookIPSetter: invalid template for URL: %w", err)
+	}
+
+	setter := WebhookIPSetter{
+		method:          strings.ToUpper(method),
+		urlTemplate:     parsedURLTemplate,
+		headerTemplates: map[string]*template.Template{},
+		retryPolicy:     DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		err := option(&setter)
+		if err != nil {
+			return WebhookIPSetter{}, xerrors.Errorf("could not construct WebhookIPSetter: %w", err)
+		}
+	}
+
+	return setter, nil
+}
+
+// SetIP associates the given ip with the given domain and subdomain name, by sending the setter's request.
+func (setter WebhookIPSetter) SetIP(domain, name string, ip net.IP) error {
+	return setter.SetIPContext(context.Background(), domain, name, ip)
+}
+
+// SetIPContext sets the IP in the same manner as SetIP, giving up once the given context is done.
+func (setter WebhookIPSetter) SetIPContext(ctx context.Context, domain, name string, ip net.IP) error {
+	data := WebhookTemplateData{
+		IP:     ip.String(),
+		Domain: domain,
+		Name:   name,
+		TTL:    setter.recordTTL,
+	}
+
+	err := setter.retryPolicy.run(ctx, func() error {
+		return setter.sendRequest(ctx, data)
+	})
+	if err != nil {
+		return xerrors.Errorf("Could not set IP: %w", err)
+	}
+
+	return nil
+}
+
+// sendRequest sends a single request, with its templates filled using the given data.
+func (setter WebhookIPSetter) sendRequest(ctx context.Context, data WebhookTemplateData) error {
+	rawURL, err := executeTemplate(setter.urlTemplate, data)
+	if err != nil {
+		return err
+	}
+
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		// The error would include the URL, which may hold credentials.
+		return xerrors.New("template produced an invalid URL")
+	}
+
+	var body io.Reader
+	if setter.bodyTemplate != nil {
+		rawBody, err := executeTemplate(setter.bodyTemplate, data)
+		if err != nil {
+			return err
+		}
+
+		body = strings.NewReader(rawBody)
+	}
+
+	req, err := http.NewRequest(setter.method, rawURL, body)
+	if err != nil {
+		return xerrors.Errorf("could not build request: %w", err)
+	}
+
+	for name, headerTemplate := range setter.headerTemplates {
+		value, err := executeTemplate(headerTemplate, data)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set(name, value)
+	}
+
+	res, err := setter.httpConfig.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		// The URL may hold credentials, so only its host is safe to end up in any logs.
+		return redactURLError(err, requestURL.Scheme+"://"+requestURL.Host)
+	}
+
+	defer res.Body.Close()
+	_, err = readResponse(res)
+
+	return err
+}
+
+// executeTemplate executes the given template with the given data, returning the result.
+func executeTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	buffer := bytes.Buffer{}
+	err := tmpl.Execute(&buffer, data)
+	if err != nil {
+		return "", xerrors.Errorf("could not execute template %s: %w", tmpl.Name(), err)
+	}
+
+	return buffer.String(), nil
+}
+
+// webhookConfig represents the JSON config of a WebhookIPSetter, for use with NewSetterFromConfig.
+type webhookConfig struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    *string           `json:"body"`
+}
+
+// newWebhookIPSetterFromConfig makes a WebhookIPSetter from the given JSON config and shared settings. If no method is
+// given, GET is used.
+func newWebhookIPSetterFromConfig(rawConfig json.RawMessage, options SetterOptions) (IPSetter, error) {
+	config := webhookConfig{Method: http.MethodGet}
+	err := decodeSetterConfig(rawConfig, &config)
+	if err != nil {
+		return nil, err
+	} else if config.URL == "" {
+		return nil, xerrors.New("url must be given")
+	}
+
+	err = options.rejectDuplicateRecordPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	err = options.rejectConvergenceCheck()
+	if err != nil {
+		return nil, err
+	}
+
+	setterOptions := []func(*WebhookIPSetter) error{
+		WebhookRecordTTL(options.RecordTTL),
+		WebhookHTTPConfig(options.HTTPConfig),
+		WebhookRetryPolicy(options.retryPolicy()),
+	}
+	for name, value := range config.Headers {
+		setterOptions = append(setterOptions, WebhookHeader(name, value))
+	}
+	if config.Body != nil {
+		setterOptions = append(setterOptions, WebhookBody(*config.Body))
+	}
+
+	return NewWebhookIPSetter(config.Method, config.URL, setterOptions...)
+}